@@ -0,0 +1,168 @@
+package directory
+
+import (
+	"context"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+)
+
+type augmentConfig struct {
+	allUsersGroupID    string
+	deterministicOrder bool
+	groupNameTransform func(string) string
+}
+
+// An AugmentOption customizes an AugmentingProvider.
+type AugmentOption func(cfg *augmentConfig)
+
+// WithAllUsersGroup adds a synthetic group with the given id, of which every synced user is a member. It
+// allows policies to refer to every directory user the same way regardless of the provider.
+func WithAllUsersGroup(id string) AugmentOption {
+	return func(cfg *augmentConfig) {
+		cfg.allUsersGroupID = id
+	}
+}
+
+// WithDeterministicOrder sorts the groups and users by id, and the group ids of every user, before they
+// are passed to the group name transform and again before they are returned. The transform is called, and
+// the results are returned, in the same order for every call regardless of the order the inner provider
+// returned them in, such as the iteration order of a map. Which of the groups merged by the transform is
+// kept is then stable too. It allows the transform and the results to be compared with golden files.
+func WithDeterministicOrder(deterministicOrder bool) AugmentOption {
+	return func(cfg *augmentConfig) {
+		cfg.deterministicOrder = deterministicOrder
+	}
+}
+
+// WithGroupNameTransform applies a transform, such as lowercasing, to the ids, names and alternative ids
+// of every group, and to the group ids of every user, so policies can rely on a canonical form. Groups
+// which are the same after the transform are merged. The all users group id is used as is.
+func WithGroupNameTransform(transform func(string) string) AugmentOption {
+	return func(cfg *augmentConfig) {
+		cfg.groupNameTransform = transform
+	}
+}
+
+// An AugmentingProvider is a Provider which adds synthetic data to the users and groups of an inner
+// provider, or transforms them. The results of the inner provider are copied rather than modified.
+type AugmentingProvider struct {
+	inner Provider
+	cfg   *augmentConfig
+}
+
+// NewAugmentingProvider creates a new AugmentingProvider.
+func NewAugmentingProvider(inner Provider, options ...AugmentOption) *AugmentingProvider {
+	cfg := new(augmentConfig)
+	for _, option := range options {
+		option(cfg)
+	}
+	return &AugmentingProvider{
+		inner: inner,
+		cfg:   cfg,
+	}
+}
+
+// UserGroups returns the users and groups of the inner provider with the synthetic data added.
+func (p *AugmentingProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	groups, users, err := p.inner.UserGroups(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.cfg.deterministicOrder {
+		groups, users = sortUserGroups(groups, users)
+	}
+	if p.cfg.groupNameTransform != nil {
+		groups, users = transformGroupNames(groups, users, p.cfg.groupNameTransform)
+	}
+	if p.cfg.allUsersGroupID != "" {
+		groups, users = addAllUsersGroup(groups, users, p.cfg.allUsersGroupID)
+	}
+	if p.cfg.deterministicOrder && (p.cfg.groupNameTransform != nil || p.cfg.allUsersGroupID != "") {
+		// the transform and the all users group may change the order
+		groups, users = sortUserGroups(groups, users)
+	}
+	return groups, users, nil
+}
+
+func sortUserGroups(groups []*Group, users []*User) ([]*Group, []*User) {
+	sortedGroups := append([]*Group(nil), groups...)
+	sort.SliceStable(sortedGroups, func(i, j int) bool {
+		return sortedGroups[i].Id < sortedGroups[j].Id
+	})
+
+	sortedUsers := make([]*User, len(users))
+	for i, user := range users {
+		sortedUsers[i] = proto.Clone(user).(*User)
+		sort.Strings(sortedUsers[i].GroupIds)
+	}
+	sort.SliceStable(sortedUsers, func(i, j int) bool {
+		return sortedUsers[i].Id < sortedUsers[j].Id
+	})
+	return sortedGroups, sortedUsers
+}
+
+func transformGroupNames(groups []*Group, users []*User, transform func(string) string) ([]*Group, []*User) {
+	transformedGroups := make([]*Group, 0, len(groups))
+	seen := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		id := transform(group.Id)
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		transformed := proto.Clone(group).(*Group)
+		transformed.Id = id
+		transformed.Name = transform(group.Name)
+		for i, altID := range transformed.AltIds {
+			transformed.AltIds[i] = transform(altID)
+		}
+		transformedGroups = append(transformedGroups, transformed)
+	}
+
+	transformedUsers := make([]*User, len(users))
+	for i, user := range users {
+		var groupIDs []string
+		for _, groupID := range user.GroupIds {
+			groupIDs = addGroupID(groupIDs, transform(groupID))
+		}
+		transformedUsers[i] = proto.Clone(user).(*User)
+		transformedUsers[i].GroupIds = groupIDs
+	}
+	return transformedGroups, transformedUsers
+}
+
+func addAllUsersGroup(groups []*Group, users []*User, id string) ([]*Group, []*User) {
+	augmentedUsers := make([]*User, len(users))
+	for i, user := range users {
+		augmentedUsers[i] = proto.Clone(user).(*User)
+		augmentedUsers[i].GroupIds = addGroupID(user.GroupIds, id)
+	}
+
+	augmentedGroups := make([]*Group, 0, len(groups)+1)
+	for _, group := range groups {
+		if group.Id != id {
+			augmentedGroups = append(augmentedGroups, group)
+		}
+	}
+	augmentedGroups = append(augmentedGroups, &Group{
+		Id:          id,
+		Name:        id,
+		MemberCount: int64(len(users)),
+	})
+	return augmentedGroups, augmentedUsers
+}
+
+// addGroupID returns a sorted copy of groupIDs which contains id.
+func addGroupID(groupIDs []string, id string) []string {
+	added := make([]string, 0, len(groupIDs)+1)
+	for _, groupID := range groupIDs {
+		if groupID != id {
+			added = append(added, groupID)
+		}
+	}
+	added = append(added, id)
+	sort.Strings(added)
+	return added
+}
@@ -0,0 +1,183 @@
+package directory
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAugmentingProvider(t *testing.T) {
+	inner := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			return []*Group{
+				{Id: "admin", Name: "admin"},
+				{Id: "user", Name: "user"},
+			}, []*User{
+				{Id: "okta/user1", GroupIds: []string{"admin", "user"}},
+				{Id: "okta/user2", GroupIds: []string{"user"}},
+				{Id: "okta/user3"},
+			}, nil
+		},
+	}
+
+	t.Run("all users group", func(t *testing.T) {
+		p := NewAugmentingProvider(inner, WithAllUsersGroup("all"))
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{
+			{Id: "admin", Name: "admin"},
+			{Id: "user", Name: "user"},
+			{Id: "all", Name: "all", MemberCount: 3},
+		}, groups)
+		assert.Equal(t, []*User{
+			{Id: "okta/user1", GroupIds: []string{"admin", "all", "user"}},
+			{Id: "okta/user2", GroupIds: []string{"all", "user"}},
+			{Id: "okta/user3", GroupIds: []string{"all"}},
+		}, users)
+	})
+	t.Run("inner results are not modified", func(t *testing.T) {
+		_, users, _ := inner.UserGroups(context.Background())
+		p := NewAugmentingProvider(mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return nil, users, nil
+			},
+		}, WithAllUsersGroup("all"))
+		_, _, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"admin", "user"}, users[0].GroupIds)
+	})
+	t.Run("group name transform", func(t *testing.T) {
+		p := NewAugmentingProvider(mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return []*Group{
+					{Id: "admin", Name: "Admins", AltIds: []string{"00g1"}},
+					{Id: "Admin", Name: "Admins"},
+					{Id: "user", Name: "Users"},
+				}, []*User{
+					{Id: "okta/user1", GroupIds: []string{"Admin", "admin", "user"}},
+					{Id: "okta/user2", GroupIds: []string{"user"}},
+				}, nil
+			},
+		}, WithGroupNameTransform(strings.ToUpper), WithAllUsersGroup("all"))
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{
+			{Id: "ADMIN", Name: "ADMINS", AltIds: []string{"00G1"}},
+			{Id: "USER", Name: "USERS"},
+			{Id: "all", Name: "all", MemberCount: 2},
+		}, groups)
+		assert.Equal(t, []*User{
+			{Id: "okta/user1", GroupIds: []string{"ADMIN", "USER", "all"}},
+			{Id: "okta/user2", GroupIds: []string{"USER", "all"}},
+		}, users)
+	})
+	t.Run("deterministic order", func(t *testing.T) {
+		var seed int64
+		p := NewAugmentingProvider(mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				// a different order for every call, like the iteration order of a map
+				seed++
+				r := rand.New(rand.NewSource(seed))
+				groups := []*Group{{Id: "a"}, {Id: "b"}, {Id: "c"}, {Id: "d"}}
+				users := []*User{
+					{Id: "okta/user1", GroupIds: []string{"a", "b", "c"}},
+					{Id: "okta/user2", GroupIds: []string{"b", "d"}},
+					{Id: "okta/user3", GroupIds: []string{"a", "c", "d"}},
+				}
+				r.Shuffle(len(groups), func(i, j int) { groups[i], groups[j] = groups[j], groups[i] })
+				r.Shuffle(len(users), func(i, j int) { users[i], users[j] = users[j], users[i] })
+				for _, user := range users {
+					r.Shuffle(len(user.GroupIds), func(i, j int) {
+						user.GroupIds[i], user.GroupIds[j] = user.GroupIds[j], user.GroupIds[i]
+					})
+				}
+				return groups, users, nil
+			},
+		}, WithDeterministicOrder(true))
+
+		expectGroups, expectUsers, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{{Id: "a"}, {Id: "b"}, {Id: "c"}, {Id: "d"}}, expectGroups)
+		for i := 0; i < 10; i++ {
+			groups, users, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, expectGroups, groups)
+			assert.Equal(t, expectUsers, users)
+		}
+	})
+	t.Run("deterministic transform order", func(t *testing.T) {
+		var seed int64
+		var calls []string
+		p := NewAugmentingProvider(mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				seed++
+				r := rand.New(rand.NewSource(seed))
+				groups := []*Group{{Id: "a", Name: "A"}, {Id: "b", Name: "B"}, {Id: "c", Name: "C"}}
+				users := []*User{
+					{Id: "okta/user1", GroupIds: []string{"a", "b"}},
+					{Id: "okta/user2", GroupIds: []string{"b", "c"}},
+				}
+				r.Shuffle(len(groups), func(i, j int) { groups[i], groups[j] = groups[j], groups[i] })
+				r.Shuffle(len(users), func(i, j int) { users[i], users[j] = users[j], users[i] })
+				for _, user := range users {
+					r.Shuffle(len(user.GroupIds), func(i, j int) {
+						user.GroupIds[i], user.GroupIds[j] = user.GroupIds[j], user.GroupIds[i]
+					})
+				}
+				return groups, users, nil
+			},
+		}, WithDeterministicOrder(true), WithGroupNameTransform(func(s string) string {
+			calls = append(calls, s)
+			return strings.ToUpper(s)
+		}))
+
+		_, _, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		expectCalls := calls
+		assert.Equal(t, []string{"a", "A", "b", "B", "c", "C", "a", "b", "b", "c"}, expectCalls)
+		for i := 0; i < 10; i++ {
+			calls = nil
+			_, _, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, expectCalls, calls, "the transform should be called in the same order")
+		}
+	})
+	t.Run("user fields are kept", func(t *testing.T) {
+		p := NewAugmentingProvider(mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return []*Group{{Id: "admin", MemberCount: 1}}, []*User{{
+					Version:    "1",
+					Id:         "okta/user1",
+					GroupIds:   []string{"admin"},
+					Attributes: map[string]string{"locale": "en_US"},
+					Aliases:    []string{"user1@example.com"},
+					Source:     "okta",
+				}}, nil
+			},
+		}, WithGroupNameTransform(strings.ToUpper), WithAllUsersGroup("all"), WithDeterministicOrder(true))
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{
+			{Id: "ADMIN", MemberCount: 1},
+			{Id: "all", Name: "all", MemberCount: 1},
+		}, groups)
+		assert.Equal(t, []*User{{
+			Version:    "1",
+			Id:         "okta/user1",
+			GroupIds:   []string{"ADMIN", "all"},
+			Attributes: map[string]string{"locale": "en_US"},
+			Aliases:    []string{"user1@example.com"},
+			Source:     "okta",
+		}}, users)
+	})
+	t.Run("no options", func(t *testing.T) {
+		p := NewAugmentingProvider(inner)
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, groups, 2)
+		assert.Equal(t, []string{"user"}, users[1].GroupIds)
+	})
+}
@@ -28,10 +28,14 @@ const (
 	defaultLoginHost      = "login.microsoftonline.com"
 	defaultLoginScope     = "https://graph.microsoft.com/.default"
 	defaultLoginGrantType = "client_credentials"
+
+	// http2MaxConnsPerHost is the number of connections requests are multiplexed over when HTTP/2 is enabled.
+	http2MaxConnsPerHost = 1
 )
 
 type config struct {
 	graphURL       *url.URL
+	http2          bool
 	httpClient     *http.Client
 	loginURL       *url.URL
 	serviceAccount *ServiceAccount
@@ -54,6 +58,15 @@ func WithLoginURL(loginURL *url.URL) Option {
 	}
 }
 
+// WithHTTP2 sets the HTTP/2 option. When enabled, the default http client prefers HTTP/2 and multiplexes
+// requests to the Azure APIs over a single connection per host, which is reused between syncs. It has no
+// effect when a custom http client is set. By default Go's protocol negotiation is used.
+func WithHTTP2(http2 bool) Option {
+	return func(cfg *config) {
+		cfg.http2 = http2
+	}
+}
+
 // WithHTTPClient sets the http client to use for requests to the Azure APIs.
 func WithHTTPClient(httpClient *http.Client) Option {
 	return func(cfg *config) {
@@ -82,6 +95,11 @@ func getConfig(options ...Option) *config {
 	for _, option := range options {
 		option(cfg)
 	}
+	if cfg.http2 && cfg.httpClient == http.DefaultClient {
+		cfg.httpClient = &http.Client{
+			Transport: directory.NewHTTP2Transport(nil, http2MaxConnsPerHost),
+		}
+	}
 	return cfg
 }
 
@@ -128,6 +146,7 @@ func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*direc
 		sort.Strings(groupIDs)
 		users = append(users, &directory.User{
 			Id:       databroker.GetUserID(Name, userID),
+			Source:   Name,
 			GroupIds: groupIDs,
 		})
 	}
@@ -301,6 +320,11 @@ func parseServiceAccountFromOptions(clientID, clientSecret, providerURL string)
 		return nil, err
 	}
 
+	serviceAccount.ClientSecret, err = directory.ExpandEnv(serviceAccount.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("client_secret: %w", err)
+	}
+
 	if serviceAccount.ClientID == "" {
 		return nil, fmt.Errorf("client_id is required")
 	}
@@ -326,6 +350,11 @@ func parseServiceAccountFromString(rawServiceAccount string) (*ServiceAccount, e
 		return nil, err
 	}
 
+	serviceAccount.ClientSecret, err = directory.ExpandEnv(serviceAccount.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("client_secret: %w", err)
+	}
+
 	if serviceAccount.ClientID == "" {
 		return nil, fmt.Errorf("client_id is required")
 	}
@@ -91,14 +91,17 @@ func Test(t *testing.T) {
 	assert.Equal(t, []*directory.User{
 		{
 			Id:       "azure/user-1",
+			Source:   "azure",
 			GroupIds: []string{"admin"},
 		},
 		{
 			Id:       "azure/user-2",
+			Source:   "azure",
 			GroupIds: []string{"test"},
 		},
 		{
 			Id:       "azure/user-3",
+			Source:   "azure",
 			GroupIds: []string{"test"},
 		},
 	}, users)
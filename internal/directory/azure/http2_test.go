@@ -0,0 +1,88 @@
+package azure
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestHTTP2(t *testing.T) {
+	cfg := getConfig()
+	assert.Equal(t, http.DefaultClient, cfg.httpClient, "go's negotiation should be used by default")
+
+	cfg = getConfig(WithHTTP2(true))
+	if assert.IsType(t, &http.Transport{}, cfg.httpClient.Transport) {
+		transport := cfg.httpClient.Transport.(*http.Transport)
+		assert.True(t, transport.ForceAttemptHTTP2)
+		assert.Equal(t, http2MaxConnsPerHost, transport.MaxConnsPerHost)
+	}
+
+	httpClient := new(http.Client)
+	cfg = getConfig(WithHTTP2(true), WithHTTPClient(httpClient))
+	assert.Equal(t, httpClient, cfg.httpClient, "a custom http client should not be changed")
+}
+
+// BenchmarkUserGroups compares a sync of many groups over HTTP/1.1 and HTTP/2.
+func BenchmarkUserGroups(b *testing.B) {
+	const groupCount = 500
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/oauth2/v2.0/token"):
+			_ = json.NewEncoder(w).Encode(M{"access_token": "ACCESSTOKEN", "token_type": "Bearer", "expires_in": 3600})
+		case r.URL.Path == "/v1.0/groups":
+			var groups []M
+			for i := 0; i < groupCount; i++ {
+				groups = append(groups, M{"id": fmt.Sprintf("group-%d", i), "displayName": fmt.Sprintf("Group %d", i)})
+			}
+			_ = json.NewEncoder(w).Encode(M{"value": groups})
+		default:
+			_ = json.NewEncoder(w).Encode(M{"value": []M{{"id": "user-1"}, {"id": "user-2"}}})
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig
+
+	http1 := directory.NewHTTP2Transport(tlsConfig, 0)
+	http1.ForceAttemptHTTP2 = false
+	http1.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+	for _, tc := range []struct {
+		name      string
+		transport *http.Transport
+	}{
+		{"http1", http1},
+		{"http2", directory.NewHTTP2Transport(tlsConfig, http2MaxConnsPerHost)},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			p := New(
+				WithGraphURL(mustParseURL(srv.URL)),
+				WithLoginURL(mustParseURL(srv.URL)),
+				WithHTTPClient(&http.Client{Transport: tc.transport}),
+				WithServiceAccount(&ServiceAccount{
+					ClientID:     "CLIENT_ID",
+					ClientSecret: "CLIENT_SECRET",
+					DirectoryID:  "DIRECTORY_ID",
+				}),
+			)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := p.UserGroups(context.Background()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
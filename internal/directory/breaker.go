@@ -0,0 +1,142 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// ErrCircuitOpen is returned by a CircuitBreakerProvider instead of querying its inner provider while its
+// circuit is open.
+var ErrCircuitOpen = errors.New("directory: circuit breaker is open")
+
+type circuitBreakerConfig struct {
+	failureThreshold int
+	cooldown         time.Duration
+}
+
+// A CircuitBreakerOption customizes a CircuitBreakerProvider.
+type CircuitBreakerOption func(cfg *circuitBreakerConfig)
+
+// WithCooldown sets the amount of time calls fail fast once the circuit opens, before a single call is let
+// through to test whether the inner provider recovered. It defaults to 1 minute.
+func WithCooldown(cooldown time.Duration) CircuitBreakerOption {
+	return func(cfg *circuitBreakerConfig) {
+		cfg.cooldown = cooldown
+	}
+}
+
+// WithFailureThreshold sets the number of consecutive failures of the inner provider which open the
+// circuit. It defaults to 5.
+func WithFailureThreshold(failureThreshold int) CircuitBreakerOption {
+	return func(cfg *circuitBreakerConfig) {
+		cfg.failureThreshold = failureThreshold
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// A CircuitBreakerProvider is a Provider which stops querying an inner provider which keeps failing, such
+// as during an outage of the identity provider. After the failure threshold is reached, calls return
+// ErrCircuitOpen for the cooldown. Then the circuit half-opens: one call queries the inner provider, and
+// closes the circuit if it succeeds or opens it for another cooldown if it fails. To serve the last result
+// while the circuit is open, wrap the provider in a CachingProvider with WithServeStaleOnError.
+type CircuitBreakerProvider struct {
+	inner Provider
+	cfg   *circuitBreakerConfig
+	now   func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// NewCircuitBreakerProvider creates a new CircuitBreakerProvider.
+func NewCircuitBreakerProvider(inner Provider, options ...CircuitBreakerOption) *CircuitBreakerProvider {
+	cfg := new(circuitBreakerConfig)
+	WithCooldown(time.Minute)(cfg)
+	WithFailureThreshold(5)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	return &CircuitBreakerProvider{
+		inner: inner,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// UserGroups queries the inner provider, unless the circuit is open.
+func (p *CircuitBreakerProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	if !p.allow() {
+		return nil, nil, ErrCircuitOpen
+	}
+
+	groups, users, err := p.inner.UserGroups(ctx)
+	// a canceled call says nothing about the health of the inner provider
+	if err != nil && ctx.Err() != nil {
+		p.mu.Lock()
+		if p.state == circuitHalfOpen {
+			p.state = circuitOpen
+		}
+		p.mu.Unlock()
+		return nil, nil, err
+	}
+	p.record(err)
+	return groups, users, err
+}
+
+// allow returns whether a call may query the inner provider, half-opening the circuit once the cooldown
+// has elapsed.
+func (p *CircuitBreakerProvider) allow() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch p.state {
+	case circuitOpen:
+		if p.now().Sub(p.openedAt) < p.cfg.cooldown {
+			return false
+		}
+		p.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// only the call testing recovery is let through
+		return false
+	default:
+		return true
+	}
+}
+
+func (p *CircuitBreakerProvider) record(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err == nil {
+		p.state = circuitClosed
+		p.failures = 0
+		return
+	}
+
+	p.failures++
+	if p.state == circuitHalfOpen || p.failures >= p.cfg.failureThreshold {
+		if p.state != circuitOpen {
+			log.Warn().Err(err).
+				Str("service", "directory").
+				Int("failures", p.failures).
+				Dur("cooldown", p.cfg.cooldown).
+				Msg("directory provider keeps failing, opening circuit breaker")
+		}
+		p.state = circuitOpen
+		p.openedAt = p.now()
+	}
+}
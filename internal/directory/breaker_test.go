@@ -0,0 +1,122 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerProvider(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+
+	var calls int
+	var err error
+	inner := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			calls++
+			if err != nil {
+				return nil, nil, err
+			}
+			return []*Group{{Id: "group1"}}, []*User{{Id: "user1"}}, nil
+		},
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	calls, err = 0, errUnavailable
+	p := NewCircuitBreakerProvider(inner, WithFailureThreshold(3), WithCooldown(time.Minute))
+	p.now = func() time.Time { return now }
+
+	// closed
+	for i := 0; i < 3; i++ {
+		_, _, got := p.UserGroups(ctx)
+		assert.Equal(t, errUnavailable, got)
+	}
+	assert.Equal(t, 3, calls)
+
+	// open
+	_, _, got := p.UserGroups(ctx)
+	assert.Equal(t, ErrCircuitOpen, got)
+	assert.Equal(t, 3, calls, "the inner provider should not be queried while the circuit is open")
+
+	// half-open, and the test call fails
+	p.now = func() time.Time { return now.Add(time.Minute) }
+	_, _, got = p.UserGroups(ctx)
+	assert.Equal(t, errUnavailable, got)
+	assert.Equal(t, 4, calls)
+	_, _, got = p.UserGroups(ctx)
+	assert.Equal(t, ErrCircuitOpen, got, "a failed test call should reopen the circuit")
+	assert.Equal(t, 4, calls)
+
+	// half-open, and the test call succeeds
+	p.now = func() time.Time { return now.Add(2 * time.Minute) }
+	err = nil
+	groups, users, got := p.UserGroups(ctx)
+	assert.NoError(t, got)
+	assert.Len(t, groups, 1)
+	assert.Len(t, users, 1)
+	assert.Equal(t, 5, calls)
+
+	// closed again, so failures are counted from zero
+	err = errUnavailable
+	for i := 0; i < 2; i++ {
+		_, _, got = p.UserGroups(ctx)
+		assert.Equal(t, errUnavailable, got)
+	}
+	assert.Equal(t, 7, calls, "the circuit should stay closed below the failure threshold")
+}
+
+func TestCircuitBreakerProvider_HalfOpen(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var calls int
+	inner := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			calls++
+			if calls > 1 {
+				close(started)
+				<-release
+			}
+			return nil, nil, errors.New("unavailable")
+		},
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := NewCircuitBreakerProvider(inner, WithFailureThreshold(1))
+	p.now = func() time.Time { return now }
+
+	_, _, _ = p.UserGroups(context.Background())
+	p.now = func() time.Time { return now.Add(time.Hour) }
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _, _ = p.UserGroups(context.Background())
+	}()
+	<-started
+	_, _, err := p.UserGroups(context.Background())
+	assert.Equal(t, ErrCircuitOpen, err, "only one call should test recovery")
+	close(release)
+	<-done
+	assert.Equal(t, 2, calls)
+}
+
+func TestCircuitBreakerProvider_Canceled(t *testing.T) {
+	var calls int
+	inner := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			calls++
+			return nil, nil, ctx.Err()
+		},
+	}
+	p := NewCircuitBreakerProvider(inner, WithFailureThreshold(1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 3; i++ {
+		_, _, err := p.UserGroups(ctx)
+		assert.Equal(t, context.Canceled, err)
+	}
+	assert.Equal(t, 3, calls, "canceled calls should not open the circuit")
+}
@@ -0,0 +1,102 @@
+package directory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+type cachingConfig struct {
+	ttl          time.Duration
+	maxStaleness time.Duration
+}
+
+// A CachingOption customizes a CachingProvider.
+type CachingOption func(cfg *cachingConfig)
+
+// WithCacheTTL sets the amount of time a successful result is reused before the inner provider is queried
+// again. By default every call queries the inner provider.
+func WithCacheTTL(ttl time.Duration) CachingOption {
+	return func(cfg *cachingConfig) {
+		cfg.ttl = ttl
+	}
+}
+
+// WithServeStaleOnError enables serving the last successful result when the inner provider fails, as long
+// as that result is no older than maxStaleness. Once the result is older than maxStaleness the error is
+// returned.
+func WithServeStaleOnError(maxStaleness time.Duration) CachingOption {
+	return func(cfg *cachingConfig) {
+		cfg.maxStaleness = maxStaleness
+	}
+}
+
+// A CachingProvider is a Provider which caches the last successful result of an inner provider.
+type CachingProvider struct {
+	inner Provider
+	cfg   *cachingConfig
+	now   func() time.Time
+
+	mu       sync.RWMutex
+	last     *userGroupsResult
+	degraded error
+}
+
+// NewCachingProvider creates a new CachingProvider.
+func NewCachingProvider(inner Provider, options ...CachingOption) *CachingProvider {
+	cfg := new(cachingConfig)
+	for _, option := range options {
+		option(cfg)
+	}
+	return &CachingProvider{
+		inner: inner,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+// UserGroups returns the cached result if it is still fresh, otherwise it queries the inner provider.
+func (p *CachingProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	p.mu.RLock()
+	last := p.last
+	p.mu.RUnlock()
+
+	if last != nil && p.now().Sub(last.completed) < p.cfg.ttl {
+		return last.groups, last.users, nil
+	}
+
+	groups, users, err := p.inner.UserGroups(ctx)
+	if err != nil {
+		if last != nil && p.cfg.maxStaleness > 0 && p.now().Sub(last.completed) <= p.cfg.maxStaleness {
+			log.Warn().Err(err).
+				Str("service", "directory").
+				Time("last_success", last.completed).
+				Msg("directory provider failed, serving stale users and groups")
+			p.mu.Lock()
+			p.degraded = err
+			p.mu.Unlock()
+			return last.groups, last.users, nil
+		}
+		return nil, nil, err
+	}
+
+	p.mu.Lock()
+	p.last = &userGroupsResult{
+		groups:    groups,
+		users:     users,
+		completed: p.now(),
+	}
+	p.degraded = nil
+	p.mu.Unlock()
+	return groups, users, nil
+}
+
+// Degraded returns the error of the inner provider if stale results are currently being served, or nil
+// otherwise.
+func (p *CachingProvider) Degraded() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.degraded
+}
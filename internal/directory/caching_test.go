@@ -0,0 +1,82 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCachingProvider(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+
+	var calls int
+	var err error
+	inner := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			calls++
+			if err != nil {
+				return nil, nil, err
+			}
+			return []*Group{{Id: "group1"}}, []*User{{Id: "user1"}}, nil
+		},
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("ttl", func(t *testing.T) {
+		calls, err = 0, nil
+		p := NewCachingProvider(inner, WithCacheTTL(time.Minute))
+		p.now = func() time.Time { return now }
+
+		_, _, _ = p.UserGroups(context.Background())
+		_, _, _ = p.UserGroups(context.Background())
+		assert.Equal(t, 1, calls)
+
+		p.now = func() time.Time { return now.Add(2 * time.Minute) }
+		_, _, _ = p.UserGroups(context.Background())
+		assert.Equal(t, 2, calls)
+	})
+	t.Run("within stale window", func(t *testing.T) {
+		calls, err = 0, nil
+		p := NewCachingProvider(inner, WithServeStaleOnError(time.Hour))
+		p.now = func() time.Time { return now }
+		_, _, _ = p.UserGroups(context.Background())
+		assert.NoError(t, p.Degraded())
+
+		err = errUnavailable
+		p.now = func() time.Time { return now.Add(30 * time.Minute) }
+		groups, users, actualErr := p.UserGroups(context.Background())
+		assert.NoError(t, actualErr)
+		assert.Equal(t, []*Group{{Id: "group1"}}, groups)
+		assert.Equal(t, []*User{{Id: "user1"}}, users)
+		assert.Equal(t, errUnavailable, p.Degraded())
+
+		err = nil
+		_, _, actualErr = p.UserGroups(context.Background())
+		assert.NoError(t, actualErr)
+		assert.NoError(t, p.Degraded())
+	})
+	t.Run("past stale window", func(t *testing.T) {
+		calls, err = 0, nil
+		p := NewCachingProvider(inner, WithServeStaleOnError(time.Hour))
+		p.now = func() time.Time { return now }
+		_, _, _ = p.UserGroups(context.Background())
+
+		err = errUnavailable
+		p.now = func() time.Time { return now.Add(2 * time.Hour) }
+		_, _, actualErr := p.UserGroups(context.Background())
+		assert.Equal(t, errUnavailable, actualErr)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		calls, err = 0, nil
+		p := NewCachingProvider(inner)
+		_, _, _ = p.UserGroups(context.Background())
+
+		err = errUnavailable
+		_, _, actualErr := p.UserGroups(context.Background())
+		assert.Equal(t, errUnavailable, actualErr)
+		assert.Equal(t, 2, calls)
+	})
+}
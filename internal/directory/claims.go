@@ -0,0 +1,85 @@
+package directory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// A ClaimsProvider is a Provider for identity providers without a directory API. Rather than querying the
+// identity provider, it returns the users and groups it has seen in the claims of users who authenticated.
+type ClaimsProvider struct {
+	name string
+
+	mu         sync.RWMutex
+	userGroups map[string][]string
+}
+
+// NewClaimsProvider creates a new ClaimsProvider. User ids are namespaced by the given identity provider
+// name, so they match the ids of the users' sessions.
+func NewClaimsProvider(name string) *ClaimsProvider {
+	return &ClaimsProvider{
+		name:       name,
+		userGroups: make(map[string][]string),
+	}
+}
+
+// IngestClaims records the groups claimed for a user when they authenticate. The groups replace those
+// recorded for the user before.
+func (p *ClaimsProvider) IngestClaims(email string, groups []string) {
+	groupIDs := make([]string, 0, len(groups))
+	seen := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		if _, ok := seen[group]; ok || group == "" {
+			continue
+		}
+		seen[group] = struct{}{}
+		groupIDs = append(groupIDs, group)
+	}
+	sort.Strings(groupIDs)
+
+	p.mu.Lock()
+	p.userGroups[email] = groupIDs
+	p.mu.Unlock()
+}
+
+// UserGroups returns the users whose claims were ingested, and the groups they are members of.
+func (p *ClaimsProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	groupIDs := make(map[string]struct{})
+	users := make([]*User, 0, len(p.userGroups))
+	for email, ids := range p.userGroups {
+		for _, id := range ids {
+			groupIDs[id] = struct{}{}
+		}
+		users = append(users, &User{
+			Id:       databroker.GetUserID(p.name, email),
+			Source:   p.name,
+			GroupIds: append([]string(nil), ids...),
+		})
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Id < users[j].Id
+	})
+
+	groups := make([]*Group, 0, len(groupIDs))
+	for id := range groupIDs {
+		groups = append(groups, &Group{
+			Id:   id,
+			Name: id,
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	return groups, users, nil
+}
+
+// Name returns the identity provider name.
+func (p *ClaimsProvider) Name() string {
+	return p.name
+}
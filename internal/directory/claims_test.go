@@ -0,0 +1,50 @@
+package directory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimsProvider(t *testing.T) {
+	p := NewClaimsProvider("oidc")
+
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+	assert.Empty(t, users)
+
+	p.IngestClaims("a@example.com", []string{"user", "admin", "user"})
+	p.IngestClaims("b@example.com", []string{"user", "test"})
+	p.IngestClaims("c@example.com", nil)
+
+	groups, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*Group{
+		{Id: "admin", Name: "admin"},
+		{Id: "test", Name: "test"},
+		{Id: "user", Name: "user"},
+	}, groups)
+	assert.Equal(t, []*User{
+		{Id: "oidc/a@example.com", Source: "oidc", GroupIds: []string{"admin", "user"}},
+		{Id: "oidc/b@example.com", Source: "oidc", GroupIds: []string{"test", "user"}},
+		{Id: "oidc/c@example.com", Source: "oidc"},
+	}, users)
+
+	t.Run("later claims replace earlier ones", func(t *testing.T) {
+		p.IngestClaims("b@example.com", []string{"user"})
+
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{
+			{Id: "admin", Name: "admin"},
+			{Id: "user", Name: "user"},
+		}, groups)
+		assert.Equal(t, []*User{
+			{Id: "oidc/a@example.com", Source: "oidc", GroupIds: []string{"admin", "user"}},
+			{Id: "oidc/b@example.com", Source: "oidc", GroupIds: []string{"user"}},
+			{Id: "oidc/c@example.com", Source: "oidc"},
+		}, users)
+	})
+}
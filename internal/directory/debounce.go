@@ -0,0 +1,65 @@
+package directory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// A DebounceProvider is a Provider which coalesces calls to UserGroups. Concurrent calls share a single
+// upstream sync, and calls made within the debounce window of a successful sync return its result.
+type DebounceProvider struct {
+	inner  Provider
+	window time.Duration
+
+	singleflight singleflight.Group
+
+	mu   sync.Mutex
+	last *userGroupsResult
+}
+
+type userGroupsResult struct {
+	groups    []*Group
+	users     []*User
+	err       error
+	completed time.Time
+}
+
+// NewDebounceProvider creates a new DebounceProvider.
+func NewDebounceProvider(inner Provider, window time.Duration) *DebounceProvider {
+	return &DebounceProvider{
+		inner:  inner,
+		window: window,
+	}
+}
+
+// UserGroups returns the result of an in-flight or recently completed sync, or starts a new one.
+func (p *DebounceProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	p.mu.Lock()
+	last := p.last
+	p.mu.Unlock()
+
+	if last != nil && time.Since(last.completed) < p.window {
+		return last.groups, last.users, nil
+	}
+
+	res, _, _ := p.singleflight.Do("", func() (interface{}, error) {
+		groups, users, err := p.inner.UserGroups(ctx)
+		result := &userGroupsResult{
+			groups:    groups,
+			users:     users,
+			err:       err,
+			completed: time.Now(),
+		}
+		if err == nil {
+			p.mu.Lock()
+			p.last = result
+			p.mu.Unlock()
+		}
+		return result, nil
+	})
+	result := res.(*userGroupsResult)
+	return result.groups, result.users, result.err
+}
@@ -0,0 +1,48 @@
+package directory
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebounceProvider(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	p := NewDebounceProvider(mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return []*Group{{Id: "group1"}}, []*User{{Id: "user1"}}, nil
+		},
+	}, 100*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			groups, users, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []*Group{{Id: "group1"}}, groups)
+			assert.Equal(t, []*User{{Id: "user1"}}, users)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "concurrent calls should share a single sync")
+
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "calls within the window should reuse the last result")
+
+	time.Sleep(150 * time.Millisecond)
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "calls after the window should start a new sync")
+}
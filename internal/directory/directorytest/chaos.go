@@ -0,0 +1,126 @@
+// Package directorytest contains directory providers for testing code which uses them, such as the sync
+// loop.
+package directorytest
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/directory"
+)
+
+// ErrInjected is returned by a ChaosProvider for the calls it fails.
+var ErrInjected = errors.New("directorytest: injected error")
+
+// ChaosConfig configures the faults injected by a ChaosProvider.
+type ChaosConfig struct {
+	// Seed seeds the random source, so the same config injects the same faults in the same order.
+	Seed int64
+	// Latency is added to every call.
+	Latency time.Duration
+	// LatencyJitter is the maximum random latency added to every call on top of Latency.
+	LatencyJitter time.Duration
+	// ErrorRate is the probability, from 0 to 1, of a call failing with ErrInjected.
+	ErrorRate float64
+	// PartialRate is the probability, from 0 to 1, of a call which didn't fail returning only a random
+	// subset of the groups and users of the inner provider, without an error, like an identity provider
+	// silently omitting records.
+	PartialRate float64
+}
+
+// A ChaosProvider is a directory.Provider which injects latency, errors and partial results around an
+// inner provider.
+type ChaosProvider struct {
+	inner directory.Provider
+	cfg   ChaosConfig
+
+	mu              sync.Mutex
+	rand            *rand.Rand
+	injectedErrors  int
+	injectedPartial int
+}
+
+// NewChaosProvider creates a new ChaosProvider.
+func NewChaosProvider(inner directory.Provider, cfg ChaosConfig) *ChaosProvider {
+	return &ChaosProvider{
+		inner: inner,
+		cfg:   cfg,
+		rand:  rand.New(rand.NewSource(cfg.Seed)),
+	}
+}
+
+// UserGroups calls the inner provider, after the configured latency, unless the call is failed.
+func (p *ChaosProvider) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	p.mu.Lock()
+	latency := p.cfg.Latency
+	if p.cfg.LatencyJitter > 0 {
+		latency += time.Duration(p.rand.Int63n(int64(p.cfg.LatencyJitter) + 1))
+	}
+	fail := p.rand.Float64() < p.cfg.ErrorRate
+	partial := !fail && p.rand.Float64() < p.cfg.PartialRate
+	seed := p.rand.Int63()
+	if fail {
+		p.injectedErrors++
+	}
+	if partial {
+		p.injectedPartial++
+	}
+	p.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(latency):
+		}
+	}
+	if fail {
+		return nil, nil, ErrInjected
+	}
+
+	groups, users, err := p.inner.UserGroups(ctx)
+	if err != nil || !partial {
+		return groups, users, err
+	}
+	r := rand.New(rand.NewSource(seed))
+	return subsetGroups(r, groups), subsetUsers(r, users), nil
+}
+
+// InjectedErrors returns the number of calls failed so far.
+func (p *ChaosProvider) InjectedErrors() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.injectedErrors
+}
+
+// InjectedPartialResults returns the number of calls which returned partial results so far.
+func (p *ChaosProvider) InjectedPartialResults() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.injectedPartial
+}
+
+// subsetGroups returns the groups without a random half of them on average, keeping their order.
+func subsetGroups(r *rand.Rand, groups []*directory.Group) []*directory.Group {
+	var kept []*directory.Group
+	for _, group := range groups {
+		if r.Intn(2) == 0 {
+			kept = append(kept, group)
+		}
+	}
+	return kept
+}
+
+// subsetUsers returns the users without a random half of them on average, keeping their order.
+func subsetUsers(r *rand.Rand, users []*directory.User) []*directory.User {
+	var kept []*directory.User
+	for _, user := range users {
+		if r.Intn(2) == 0 {
+			kept = append(kept, user)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,78 @@
+package directorytest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/directory"
+)
+
+type mockProvider struct {
+	groups []*directory.Group
+	users  []*directory.User
+}
+
+func (mock mockProvider) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	return mock.groups, mock.users, nil
+}
+
+func newMockProvider(n int) mockProvider {
+	var mock mockProvider
+	for i := 0; i < n; i++ {
+		mock.groups = append(mock.groups, &directory.Group{Id: fmt.Sprintf("group%d", i)})
+		mock.users = append(mock.users, &directory.User{Id: fmt.Sprintf("user%d", i)})
+	}
+	return mock
+}
+
+func TestChaosProvider(t *testing.T) {
+	t.Run("deterministic", func(t *testing.T) {
+		outcomes := func() []string {
+			p := NewChaosProvider(newMockProvider(10), ChaosConfig{Seed: 1, ErrorRate: 0.3, PartialRate: 0.3})
+			var outcomes []string
+			for i := 0; i < 20; i++ {
+				groups, users, err := p.UserGroups(context.Background())
+				outcomes = append(outcomes, fmt.Sprint(len(groups), len(users), err))
+			}
+			return outcomes
+		}
+		first := outcomes()
+		assert.Equal(t, first, outcomes(), "the same seed should inject the same faults")
+		assert.Contains(t, first, fmt.Sprint(0, 0, ErrInjected))
+		assert.Contains(t, first, fmt.Sprint(10, 10, nil))
+	})
+	t.Run("partial", func(t *testing.T) {
+		p := NewChaosProvider(newMockProvider(100), ChaosConfig{PartialRate: 1})
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, len(groups) > 0 && len(groups) < 100, "got %d groups", len(groups))
+		assert.True(t, len(users) > 0 && len(users) < 100, "got %d users", len(users))
+		assert.Equal(t, 1, p.InjectedPartialResults())
+	})
+	t.Run("latency", func(t *testing.T) {
+		p := NewChaosProvider(newMockProvider(1), ChaosConfig{Latency: time.Second})
+		ctx, clearTimeout := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer clearTimeout()
+		_, _, err := p.UserGroups(ctx)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+	t.Run("serve stale", func(t *testing.T) {
+		chaos := NewChaosProvider(newMockProvider(3), ChaosConfig{Seed: 1, ErrorRate: 0.5})
+		p := directory.NewCachingProvider(chaos, directory.WithServeStaleOnError(time.Hour))
+		var synced bool
+		for i := 0; i < 20; i++ {
+			groups, _, err := p.UserGroups(context.Background())
+			if synced {
+				assert.NoError(t, err, "the last result should be served once a sync succeeded")
+				assert.Len(t, groups, 3)
+			}
+			synced = synced || err == nil
+		}
+		assert.True(t, synced)
+		assert.NotZero(t, chaos.InjectedErrors())
+	})
+}
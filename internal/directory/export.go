@@ -0,0 +1,47 @@
+package directory
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ExportMembershipMetrics writes a snapshot of the number of users and of the number of members of each
+// group in the OpenMetrics text format, for audits. Member counts are those of the given users, rather than
+// the member counts reported by the provider. Groups are written sorted by id.
+// See https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md
+func ExportMembershipMetrics(w io.Writer, users []*User, groups []*Group) error {
+	memberCounts := make(map[string]int, len(groups))
+	for _, user := range users {
+		for _, groupID := range user.GroupIds {
+			memberCounts[groupID]++
+		}
+	}
+
+	sorted := append([]*Group(nil), groups...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Id < sorted[j].Id
+	})
+
+	var b strings.Builder
+	b.WriteString("# TYPE directory_users gauge\n")
+	b.WriteString("# HELP directory_users The number of directory users.\n")
+	fmt.Fprintf(&b, "directory_users %d\n", len(users))
+	b.WriteString("# TYPE directory_group_members gauge\n")
+	b.WriteString("# HELP directory_group_members The number of members of each directory group.\n")
+	for _, group := range sorted {
+		fmt.Fprintf(&b, "directory_group_members{group_id=\"%s\",group_name=\"%s\"} %d\n",
+			escapeMetricLabel(group.Id), escapeMetricLabel(group.Name), memberCounts[group.Id])
+	}
+	b.WriteString("# EOF\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeMetricLabel(value string) string {
+	return metricLabelEscaper.Replace(value)
+}
@@ -0,0 +1,32 @@
+package directory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportMembershipMetrics(t *testing.T) {
+	var b strings.Builder
+	err := ExportMembershipMetrics(&b, []*User{
+		{Id: "okta/user1", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/user2", GroupIds: []string{"user"}},
+		{Id: "okta/user3", GroupIds: []string{"user", "unknown"}},
+	}, []*Group{
+		{Id: "user", Name: "Users"},
+		{Id: "admin", Name: `Admins "root"`},
+		{Id: "empty", Name: "Empty", MemberCount: 10},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `# TYPE directory_users gauge
+# HELP directory_users The number of directory users.
+directory_users 3
+# TYPE directory_group_members gauge
+# HELP directory_group_members The number of members of each directory group.
+directory_group_members{group_id="admin",group_name="Admins \"root\""} 1
+directory_group_members{group_id="empty",group_name="Empty"} 0
+directory_group_members{group_id="user",group_name="Users"} 3
+# EOF
+`, b.String())
+}
@@ -123,6 +123,7 @@ func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*direc
 	for userLogin, groups := range userLoginToGroups {
 		user := &directory.User{
 			Id:       databroker.GetUserID(Name, userLogin),
+			Source:   Name,
 			GroupIds: groups,
 		}
 		sort.Strings(user.GroupIds)
@@ -274,6 +275,11 @@ func ParseServiceAccount(rawServiceAccount string) (*ServiceAccount, error) {
 		return nil, err
 	}
 
+	serviceAccount.PersonalAccessToken, err = directory.ExpandEnv(serviceAccount.PersonalAccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("personal_access_token: %w", err)
+	}
+
 	if serviceAccount.Username == "" {
 		return nil, fmt.Errorf("username is required")
 	}
@@ -96,10 +96,10 @@ func Test(t *testing.T) {
 	groups, users, err := p.UserGroups(context.Background())
 	assert.NoError(t, err)
 	testutil.AssertProtoJSONEqual(t, `[
-		{ "id": "github/user1", "groupIds": ["1", "2", "3"] },
-		{ "id": "github/user2", "groupIds": ["1", "3"] },
-		{ "id": "github/user3", "groupIds": ["3"] },
-		{ "id": "github/user4", "groupIds": ["4"] }
+		{ "id": "github/user1", "source": "github", "groupIds": ["1", "2", "3"] },
+		{ "id": "github/user2", "source": "github", "groupIds": ["1", "3"] },
+		{ "id": "github/user3", "source": "github", "groupIds": ["3"] },
+		{ "id": "github/user4", "source": "github", "groupIds": ["4"] }
 	]`, users)
 	testutil.AssertProtoJSONEqual(t, `[
 		{ "id": "1", "name": "team1" },
@@ -111,7 +111,8 @@ func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*direc
 	var users []*directory.User
 	for userID, groups := range userIDToGroupIDs {
 		user := &directory.User{
-			Id: databroker.GetUserID(Name, fmt.Sprint(userID)),
+			Id:     databroker.GetUserID(Name, fmt.Sprint(userID)),
+			Source: Name,
 		}
 
 		user.GroupIds = append(user.GroupIds, groups...)
@@ -229,6 +230,11 @@ func ParseServiceAccount(rawServiceAccount string) (*ServiceAccount, error) {
 		return nil, err
 	}
 
+	serviceAccount.PrivateToken, err = directory.ExpandEnv(serviceAccount.PrivateToken)
+	if err != nil {
+		return nil, fmt.Errorf("private_token: %w", err)
+	}
+
 	if serviceAccount.PrivateToken == "" {
 		return nil, fmt.Errorf("private_token is required")
 	}
@@ -69,9 +69,9 @@ func Test(t *testing.T) {
 	groups, users, err := p.UserGroups(context.Background())
 	assert.NoError(t, err)
 	testutil.AssertProtoJSONEqual(t, `[
-		{ "id": "gitlab/11", "groupIds": ["1"] },
-		{ "id": "gitlab/12", "groupIds": ["2"] },
-		{ "id": "gitlab/13", "groupIds": ["2"] }
+		{ "id": "gitlab/11", "source": "gitlab", "groupIds": ["1"] },
+		{ "id": "gitlab/12", "source": "gitlab", "groupIds": ["2"] },
+		{ "id": "gitlab/13", "source": "gitlab", "groupIds": ["2"] }
 	]`, users)
 	testutil.AssertProtoJSONEqual(t, `[
 		{ "id": "1", "name": "Group 1" },
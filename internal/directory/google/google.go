@@ -131,6 +131,7 @@ func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*direc
 		sort.Strings(groups)
 		users = append(users, &directory.User{
 			Id:       databroker.GetUserID(Name, userID),
+			Source:   Name,
 			GroupIds: groups,
 		})
 	}
@@ -210,6 +211,19 @@ func ParseServiceAccount(rawServiceAccount string) (*ServiceAccount, error) {
 		return nil, err
 	}
 
+	serviceAccount.PrivateKey, err = directory.ExpandEnv(serviceAccount.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("private_key: %w", err)
+	}
+	serviceAccount.ClientSecret, err = directory.ExpandEnv(serviceAccount.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("client_secret: %w", err)
+	}
+	serviceAccount.RefreshToken, err = directory.ExpandEnv(serviceAccount.RefreshToken)
+	if err != nil {
+		return nil, fmt.Errorf("refresh_token: %w", err)
+	}
+
 	if serviceAccount.ImpersonateUser == "" {
 		return nil, fmt.Errorf("impersonate_user is required")
 	}
@@ -0,0 +1,77 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout is the maximum amount of time a single provider has to verify itself.
+var healthCheckTimeout = 10 * time.Second
+
+// A Verifier is a Provider which can check its configuration and connectivity without a full sync.
+type Verifier interface {
+	Verify(ctx context.Context) error
+}
+
+// HealthCheck verifies each of the given providers concurrently and returns the result keyed by provider
+// name. Providers which do not implement Verifier are reported as healthy.
+func HealthCheck(ctx context.Context, providers []Provider) map[string]error {
+	names := make([]string, len(providers))
+	for i, provider := range providers {
+		names[i] = ProviderName(provider)
+		for j := 0; j < i; j++ {
+			if names[j] == names[i] {
+				names[i] = fmt.Sprintf("%s-%d", names[i], i)
+				break
+			}
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]error, len(providers))
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(name string, provider Provider) {
+			defer wg.Done()
+			err := verify(ctx, provider)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(names[i], provider)
+	}
+	wg.Wait()
+	return results
+}
+
+func verify(ctx context.Context, provider Provider) error {
+	verifier, ok := provider.(Verifier)
+	if !ok {
+		return nil
+	}
+
+	ctx, clearTimeout := context.WithTimeout(ctx, healthCheckTimeout)
+	defer clearTimeout()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- verifier.Verify(ctx)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("directory: health check timed out: %w", ctx.Err())
+	}
+}
+
+// ProviderName returns the name of a provider, falling back to its type if it has no Name method.
+func ProviderName(provider Provider) string {
+	if named, ok := provider.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", provider)
+}
@@ -0,0 +1,64 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockProvider struct {
+	name       string
+	userGroups func(ctx context.Context) ([]*Group, []*User, error)
+	verify     func(ctx context.Context) error
+}
+
+func (mock mockProvider) Name() string {
+	return mock.name
+}
+
+func (mock mockProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	if mock.userGroups == nil {
+		return nil, nil, nil
+	}
+	return mock.userGroups(ctx)
+}
+
+func (mock mockProvider) Verify(ctx context.Context) error {
+	if mock.verify == nil {
+		return nil
+	}
+	return mock.verify(ctx)
+}
+
+func TestHealthCheck(t *testing.T) {
+	origHealthCheckTimeout := healthCheckTimeout
+	healthCheckTimeout = 50 * time.Millisecond
+	defer func() { healthCheckTimeout = origHealthCheckTimeout }()
+
+	hung := make(chan struct{})
+	defer close(hung)
+
+	errUnhealthy := errors.New("unhealthy")
+	results := HealthCheck(context.Background(), []Provider{
+		mockProvider{name: "healthy"},
+		mockProvider{name: "unhealthy", verify: func(ctx context.Context) error {
+			return errUnhealthy
+		}},
+		mockProvider{name: "hung", verify: func(ctx context.Context) error {
+			<-hung
+			return nil
+		}},
+		mockProvider{name: "healthy"},
+		NoopProvider{},
+	})
+
+	assert.Len(t, results, 5)
+	assert.NoError(t, results["healthy"])
+	assert.NoError(t, results["healthy-3"])
+	assert.Equal(t, errUnhealthy, results["unhealthy"])
+	assert.True(t, errors.Is(results["hung"], context.DeadlineExceeded))
+	assert.NoError(t, results["directory.NoopProvider"])
+}
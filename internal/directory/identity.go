@@ -0,0 +1,55 @@
+package directory
+
+import (
+	"strings"
+
+	"github.com/pomerium/pomerium/pkg/grpc/databroker"
+)
+
+// An Identity is the identity of a session, as asserted by the identity provider the user authenticated
+// with.
+type Identity struct {
+	// Provider is the name of the identity provider, such as okta.
+	Provider string
+	// Subject is the sub claim of the identity provider's ID token.
+	Subject string
+	// Email is the email claim of the identity provider's ID token, if any.
+	Email string
+}
+
+// An IdentityMatcher reports whether a session identity is the given directory user. Deployments choose
+// a matcher depending on how their provider identifies users, or use a custom function.
+type IdentityMatcher func(identity Identity, user *User) bool
+
+// MatchBySubject matches the directory user whose id is the identity's subject namespaced by its provider,
+// such as okta/00u1abcd. It suits providers which identify users by the same id as the sub claim.
+func MatchBySubject(identity Identity, user *User) bool {
+	return identity.Subject != "" && user.Id == databroker.GetUserID(identity.Provider, identity.Subject)
+}
+
+// MatchByEmail matches the directory user whose id is the identity's email namespaced by its provider, as
+// with a ClaimsProvider, or which has the email as an alias. Emails are compared case insensitively.
+func MatchByEmail(identity Identity, user *User) bool {
+	if identity.Email == "" {
+		return false
+	}
+	if strings.EqualFold(user.Id, databroker.GetUserID(identity.Provider, identity.Email)) {
+		return true
+	}
+	for _, alias := range user.Aliases {
+		if strings.EqualFold(alias, identity.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindUser returns the first of the users matched to the identity, or nil if there is none.
+func FindUser(match IdentityMatcher, identity Identity, users []*User) *User {
+	for _, user := range users {
+		if match(identity, user) {
+			return user
+		}
+	}
+	return nil
+}
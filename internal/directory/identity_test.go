@@ -0,0 +1,49 @@
+package directory
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindUser(t *testing.T) {
+	users := []*User{
+		{Id: "okta/00u1", GroupIds: []string{"admin"}, Aliases: []string{"alice@example.com", "alice"}},
+		{Id: "okta/00u2", GroupIds: []string{"user"}, Aliases: []string{"bob@example.com"}},
+		{Id: "github/carol@example.com", GroupIds: []string{"user"}},
+	}
+
+	t.Run("by subject", func(t *testing.T) {
+		// the session email differs from the directory email, so only the subject matches
+		identity := Identity{Provider: "okta", Subject: "00u1", Email: "alice.smith@example.com"}
+		assert.Nil(t, FindUser(MatchByEmail, identity, users))
+		if user := FindUser(MatchBySubject, identity, users); assert.NotNil(t, user) {
+			assert.Equal(t, "okta/00u1", user.Id)
+		}
+		assert.Nil(t, FindUser(MatchBySubject, Identity{Provider: "github", Subject: "00u1"}, users))
+	})
+	t.Run("by email", func(t *testing.T) {
+		if user := FindUser(MatchByEmail, Identity{Provider: "okta", Subject: "unknown", Email: "Bob@example.com"}, users); assert.NotNil(t, user) {
+			assert.Equal(t, "okta/00u2", user.Id)
+		}
+		if user := FindUser(MatchByEmail, Identity{Provider: "github", Email: "carol@example.com"}, users); assert.NotNil(t, user) {
+			assert.Equal(t, "github/carol@example.com", user.Id)
+		}
+		assert.Nil(t, FindUser(MatchByEmail, Identity{Provider: "okta", Subject: "00u1"}, users))
+	})
+	t.Run("custom", func(t *testing.T) {
+		byLogin := func(identity Identity, user *User) bool {
+			login := strings.SplitN(identity.Email, "@", 2)[0]
+			for _, alias := range user.Aliases {
+				if alias == login {
+					return true
+				}
+			}
+			return false
+		}
+		if user := FindUser(byLogin, Identity{Provider: "okta", Email: "alice@corp.example.com"}, users); assert.NotNil(t, user) {
+			assert.Equal(t, "okta/00u1", user.Id)
+		}
+	})
+}
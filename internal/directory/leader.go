@@ -0,0 +1,56 @@
+package directory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A SyncLeader coordinates syncs across replicas so that only one of them queries the directory
+// provider. Replicas which don't acquire the lease consume the result written by the leader instead.
+type SyncLeader interface {
+	// AcquireLease attempts to acquire the sync lease. If acquired is true the caller should sync and
+	// then call release. release is never nil.
+	AcquireLease(ctx context.Context) (acquired bool, release func())
+}
+
+// An InMemorySyncLeader is a SyncLeader for replicas running in the same process.
+type InMemorySyncLeader struct {
+	leaseDuration time.Duration
+	now           func() time.Time
+
+	mu      sync.Mutex
+	held    bool
+	expires time.Time
+}
+
+// NewInMemorySyncLeader creates a new InMemorySyncLeader. A lease is held until it's released and for at
+// least leaseDuration after it was acquired, so at most one sync happens per leaseDuration.
+func NewInMemorySyncLeader(leaseDuration time.Duration) *InMemorySyncLeader {
+	return &InMemorySyncLeader{
+		leaseDuration: leaseDuration,
+		now:           time.Now,
+	}
+}
+
+// AcquireLease acquires the lease if it isn't held and the previous lease has expired.
+func (l *InMemorySyncLeader) AcquireLease(ctx context.Context) (acquired bool, release func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if l.held || now.Before(l.expires) {
+		return false, func() {}
+	}
+	l.held = true
+	l.expires = now.Add(l.leaseDuration)
+
+	var once sync.Once
+	return true, func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.held = false
+			l.mu.Unlock()
+		})
+	}
+}
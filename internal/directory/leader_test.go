@@ -0,0 +1,58 @@
+package directory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInMemorySyncLeader(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	provider := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return nil, nil, nil
+		},
+	}
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	leader := NewInMemorySyncLeader(time.Minute)
+	leader.now = func() time.Time { return now }
+
+	// each replica only syncs if it acquires the lease
+	replica := func() bool {
+		acquired, release := leader.AcquireLease(context.Background())
+		defer release()
+		if !acquired {
+			return false
+		}
+		_, _, _ = provider.UserGroups(context.Background())
+		return true
+	}
+
+	var wg sync.WaitGroup
+	synced := make([]bool, 2)
+	for i := range synced {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			synced[i] = replica()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls, "only one replica should sync")
+	assert.NotEqual(t, synced[0], synced[1])
+
+	assert.False(t, replica(), "the lease should be held until it expires")
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(2 * time.Minute)
+	assert.True(t, replica(), "the lease should be acquired once it expires")
+	assert.Equal(t, 2, calls)
+}
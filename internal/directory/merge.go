@@ -0,0 +1,62 @@
+package directory
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// MergeGroups merges group updates, such as those of an incremental sync, over an existing snapshot of
+// groups. Groups are upserted by id. Updates may carry only some of the fields of a group, so empty fields
+// of an update keep the existing value, and attributes are merged key by key. Existing groups keep their
+// order and new groups are appended in the order of the updates. The inputs are not modified.
+func MergeGroups(existing, updates []*Group) []*Group {
+	merged := make([]*Group, 0, len(existing)+len(updates))
+	lookup := make(map[string]int, len(existing)+len(updates))
+	for _, group := range existing {
+		if i, ok := lookup[group.Id]; ok {
+			merged[i] = mergeGroup(merged[i], group)
+			continue
+		}
+		lookup[group.Id] = len(merged)
+		merged = append(merged, group)
+	}
+	for _, group := range updates {
+		if i, ok := lookup[group.Id]; ok {
+			merged[i] = mergeGroup(merged[i], group)
+			continue
+		}
+		lookup[group.Id] = len(merged)
+		merged = append(merged, group)
+	}
+	return merged
+}
+
+// mergeGroup returns a copy of existing with the non-empty fields of update applied.
+func mergeGroup(existing, update *Group) *Group {
+	merged := proto.Clone(existing).(*Group)
+	if update.Version != "" {
+		merged.Version = update.Version
+	}
+	if update.Name != "" {
+		merged.Name = update.Name
+	}
+	if update.Email != "" {
+		merged.Email = update.Email
+	}
+	if len(update.AltIds) > 0 {
+		merged.AltIds = update.AltIds
+	}
+	if len(update.Attributes) > 0 {
+		attributes := make(map[string]string, len(existing.Attributes)+len(update.Attributes))
+		for k, v := range existing.Attributes {
+			attributes[k] = v
+		}
+		for k, v := range update.Attributes {
+			attributes[k] = v
+		}
+		merged.Attributes = attributes
+	}
+	if update.MemberCount != 0 {
+		merged.MemberCount = update.MemberCount
+	}
+	return merged
+}
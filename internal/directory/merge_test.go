@@ -0,0 +1,54 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestMergeGroups(t *testing.T) {
+	existing := []*Group{
+		{Id: "admin", Name: "Admin", Email: "admin@example.com", AltIds: []string{"admins"}, MemberCount: 2},
+		{Id: "user", Name: "User", Attributes: map[string]string{"type": "okta", "owner": "it"}, MemberCount: 5},
+	}
+
+	t.Run("partial updates", func(t *testing.T) {
+		merged := MergeGroups(existing, []*Group{
+			{Id: "user", MemberCount: 6, Attributes: map[string]string{"owner": "hr"}},
+			{Id: "admin", Version: "2"},
+			{Id: "test", Name: "Test"},
+		})
+		assert.Empty(t, cmp.Diff([]*Group{
+			{Id: "admin", Version: "2", Name: "Admin", Email: "admin@example.com", AltIds: []string{"admins"}, MemberCount: 2},
+			{Id: "user", Name: "User", Attributes: map[string]string{"type": "okta", "owner": "hr"}, MemberCount: 6},
+			{Id: "test", Name: "Test"},
+		}, merged, protocmp.Transform()))
+	})
+	t.Run("full updates", func(t *testing.T) {
+		merged := MergeGroups(existing, []*Group{
+			{Id: "admin", Name: "Administrators", Email: "root@example.com", AltIds: []string{"root"}, MemberCount: 1},
+		})
+		assert.Empty(t, cmp.Diff([]*Group{
+			{Id: "admin", Name: "Administrators", Email: "root@example.com", AltIds: []string{"root"}, MemberCount: 1},
+			{Id: "user", Name: "User", Attributes: map[string]string{"type": "okta", "owner": "it"}, MemberCount: 5},
+		}, merged, protocmp.Transform()))
+	})
+	t.Run("no existing groups", func(t *testing.T) {
+		merged := MergeGroups(nil, []*Group{
+			{Id: "admin", Name: "Admin"},
+			{Id: "admin", MemberCount: 3},
+		})
+		assert.Empty(t, cmp.Diff([]*Group{
+			{Id: "admin", Name: "Admin", MemberCount: 3},
+		}, merged, protocmp.Transform()))
+	})
+	t.Run("inputs are not modified", func(t *testing.T) {
+		MergeGroups(existing, []*Group{
+			{Id: "user", Name: "Users", Attributes: map[string]string{"owner": "hr"}},
+		})
+		assert.Equal(t, "User", existing[1].Name)
+		assert.Equal(t, map[string]string{"type": "okta", "owner": "it"}, existing[1].Attributes)
+	})
+}
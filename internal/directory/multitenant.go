@@ -0,0 +1,172 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+type multiTenantConfig struct {
+	abortOnTenantError bool
+}
+
+// A MultiTenantOption customizes a MultiTenantProvider.
+type MultiTenantOption func(cfg *multiTenantConfig)
+
+// WithAbortOnTenantError makes the sync fail if any tenant fails. By default the users and groups of a
+// failing tenant's most recent successful sync are returned in its place, if any.
+func WithAbortOnTenantError(abort bool) MultiTenantOption {
+	return func(cfg *multiTenantConfig) {
+		cfg.abortOnTenantError = abort
+	}
+}
+
+// A MultiTenantProvider is a Provider which combines the directories of many tenants. All user and group
+// ids, as well as group names, are namespaced by the tenant key as "<tenant>/<id>".
+type MultiTenantProvider struct {
+	tenants map[string]Provider
+	cfg     *multiTenantConfig
+
+	mu       sync.RWMutex
+	errors   map[string]error
+	previous map[string]tenantRecords
+}
+
+// tenantRecords are the namespaced users and groups of a tenant.
+type tenantRecords struct {
+	groups []*Group
+	users  []*User
+}
+
+// NewMultiTenantProvider creates a new MultiTenantProvider for the given providers keyed by tenant.
+func NewMultiTenantProvider(tenants map[string]Provider, options ...MultiTenantOption) *MultiTenantProvider {
+	cfg := new(multiTenantConfig)
+	for _, option := range options {
+		option(cfg)
+	}
+	return &MultiTenantProvider{
+		tenants:  tenants,
+		cfg:      cfg,
+		previous: make(map[string]tenantRecords, len(tenants)),
+	}
+}
+
+// UserGroups syncs every tenant concurrently and returns the namespaced users and groups.
+func (p *MultiTenantProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	type tenantResult struct {
+		groups []*Group
+		users  []*User
+		err    error
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]tenantResult, len(p.tenants))
+	for tenant, provider := range p.tenants {
+		wg.Add(1)
+		go func(tenant string, provider Provider) {
+			defer wg.Done()
+			groups, users, err := provider.UserGroups(WithTenant(ctx, tenant))
+			mu.Lock()
+			results[tenant] = tenantResult{groups: groups, users: users, err: err}
+			mu.Unlock()
+		}(tenant, provider)
+	}
+	wg.Wait()
+
+	tenants := make([]string, 0, len(results))
+	for tenant := range results {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var groups []*Group
+	var users []*User
+	errs := make(map[string]error)
+	for _, tenant := range tenants {
+		result := results[tenant]
+		if result.err != nil {
+			if p.cfg.abortOnTenantError {
+				return nil, nil, fmt.Errorf("directory: error syncing tenant %s: %w", tenant, result.err)
+			}
+			previous, ok := p.previous[tenant]
+			log.Warn().Err(result.err).
+				Str("service", "directory").
+				Str("tenant", tenant).
+				Bool("previous", ok).
+				Msg("failed to sync tenant, using its previous results")
+			errs[tenant] = result.err
+			groups = append(groups, previous.groups...)
+			users = append(users, previous.users...)
+			continue
+		}
+		var records tenantRecords
+		for _, group := range result.groups {
+			records.groups = append(records.groups, namespaceGroup(tenant, group))
+		}
+		for _, user := range result.users {
+			records.users = append(records.users, namespaceUser(tenant, user))
+		}
+		p.previous[tenant] = records
+		groups = append(groups, records.groups...)
+		users = append(users, records.users...)
+	}
+	p.errors = errs
+
+	if len(tenants) > 0 && len(errs) == len(tenants) {
+		return nil, nil, fmt.Errorf("directory: error syncing all tenants: %w", errs[tenants[0]])
+	}
+	return groups, users, nil
+}
+
+// TenantErrors returns the errors of the tenants which failed in the most recent sync.
+func (p *MultiTenantProvider) TenantErrors() map[string]error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.errors
+}
+
+func namespaceGroup(tenant string, group *Group) *Group {
+	namespaced := proto.Clone(group).(*Group)
+	namespaced.Id = namespaceID(tenant, group.Id)
+	namespaced.Name = namespaceName(tenant, group.Name)
+	namespaced.AltIds = namespaceIDs(tenant, group.AltIds)
+	return namespaced
+}
+
+func namespaceUser(tenant string, user *User) *User {
+	namespaced := proto.Clone(user).(*User)
+	namespaced.Id = namespaceID(tenant, user.Id)
+	namespaced.GroupIds = namespaceIDs(tenant, user.GroupIds)
+	return namespaced
+}
+
+func namespaceID(tenant, id string) string {
+	return tenant + "/" + id
+}
+
+func namespaceName(tenant, name string) string {
+	if name == "" {
+		return ""
+	}
+	return namespaceID(tenant, name)
+}
+
+func namespaceIDs(tenant string, ids []string) []string {
+	if ids == nil {
+		return nil
+	}
+	namespaced := make([]string, len(ids))
+	for i, id := range ids {
+		namespaced[i] = namespaceID(tenant, id)
+	}
+	return namespaced
+}
@@ -0,0 +1,137 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/directory/okta"
+)
+
+type M = map[string]interface{}
+
+// newMockOktaTenant starts an Okta API server with a single group containing the given member ids.
+func newMockOktaTenant(t *testing.T, groupID string, memberIDs ...string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/groups", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]M{{
+			"id":      groupID,
+			"profile": M{"name": groupID + "-name"},
+		}})
+	})
+	mux.HandleFunc("/api/v1/groups/"+groupID+"/users", func(w http.ResponseWriter, r *http.Request) {
+		var users []M
+		for _, id := range memberIDs {
+			users = append(users, M{"id": id, "status": "ACTIVE"})
+		}
+		_ = json.NewEncoder(w).Encode(users)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newOktaTenant(t *testing.T, srv *httptest.Server) Provider {
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return okta.New(
+		okta.WithServiceAccount(&okta.ServiceAccount{APIKey: "APITOKEN"}),
+		okta.WithProviderURL(u),
+		okta.WithQPS(100),
+	)
+}
+
+func TestMultiTenantProvider(t *testing.T) {
+	t.Run("namespaced", func(t *testing.T) {
+		p := NewMultiTenantProvider(map[string]Provider{
+			"acme":    newOktaTenant(t, newMockOktaTenant(t, "admins", "user1")),
+			"initech": newOktaTenant(t, newMockOktaTenant(t, "admins", "user1", "user2")),
+		})
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{
+			{Id: "acme/admins", Name: "acme/admins-name", AltIds: []string{"acme/admins-name"}, MemberCount: 1},
+			{Id: "initech/admins", Name: "initech/admins-name", AltIds: []string{"initech/admins-name"}, MemberCount: 2},
+		}, groups)
+		assert.Equal(t, []*User{
+			{Id: "acme/okta/user1", Source: "okta", GroupIds: []string{"acme/admins"}},
+			{Id: "initech/okta/user1", Source: "okta", GroupIds: []string{"initech/admins"}},
+			{Id: "initech/okta/user2", Source: "okta", GroupIds: []string{"initech/admins"}},
+		}, users)
+	})
+
+	errUnavailable := errors.New("unavailable")
+	failing := mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			return nil, nil, errUnavailable
+		},
+	}
+
+	t.Run("skip failing tenant", func(t *testing.T) {
+		p := NewMultiTenantProvider(map[string]Provider{
+			"acme":    newOktaTenant(t, newMockOktaTenant(t, "admins", "user1")),
+			"initech": failing,
+		})
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, groups, 1)
+		assert.Equal(t, []*User{
+			{Id: "acme/okta/user1", Source: "okta", GroupIds: []string{"acme/admins"}},
+		}, users)
+		assert.Equal(t, map[string]error{"initech": errUnavailable}, p.TenantErrors())
+	})
+	t.Run("previous results of failing tenant", func(t *testing.T) {
+		var err error
+		flaky := mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				if err != nil {
+					return nil, nil, err
+				}
+				return []*Group{{Id: "admins"}}, []*User{{Id: "user1", GroupIds: []string{"admins"}}}, nil
+			},
+		}
+		p := NewMultiTenantProvider(map[string]Provider{
+			"acme":    flaky,
+			"initech": newOktaTenant(t, newMockOktaTenant(t, "admins", "user2")),
+		})
+		_, _, syncErr := p.UserGroups(context.Background())
+		assert.NoError(t, syncErr)
+
+		err = errUnavailable
+		groups, users, syncErr := p.UserGroups(context.Background())
+		assert.NoError(t, syncErr)
+		assert.Equal(t, []*Group{
+			{Id: "acme/admins"},
+			{Id: "initech/admins", Name: "initech/admins-name", AltIds: []string{"initech/admins-name"}, MemberCount: 1},
+		}, groups)
+		assert.Equal(t, []*User{
+			{Id: "acme/user1", GroupIds: []string{"acme/admins"}},
+			{Id: "initech/okta/user2", Source: "okta", GroupIds: []string{"initech/admins"}},
+		}, users)
+		assert.Equal(t, map[string]error{"acme": errUnavailable}, p.TenantErrors())
+	})
+	t.Run("abort on tenant error", func(t *testing.T) {
+		p := NewMultiTenantProvider(map[string]Provider{
+			"acme":    newOktaTenant(t, newMockOktaTenant(t, "admins", "user1")),
+			"initech": failing,
+		}, WithAbortOnTenantError(true))
+		_, _, err := p.UserGroups(context.Background())
+		assert.True(t, errors.Is(err, errUnavailable))
+	})
+	t.Run("all tenants failing", func(t *testing.T) {
+		p := NewMultiTenantProvider(map[string]Provider{
+			"acme":    failing,
+			"initech": failing,
+		})
+		_, _, err := p.UserGroups(context.Background())
+		assert.True(t, errors.Is(err, errUnavailable))
+	})
+}
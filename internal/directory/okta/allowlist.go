@@ -0,0 +1,148 @@
+package okta
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// A groupAllowlist is the set of group ids read from the file of the group allowlist file option. The
+// file is watched, and read again by the first sync after it changes.
+type groupAllowlist struct {
+	path string
+
+	mu       sync.Mutex
+	watcher  *fsnotify.Watcher
+	closed   bool
+	changed  bool
+	groupIDs map[string]struct{}
+}
+
+func newGroupAllowlist(path string) *groupAllowlist {
+	return &groupAllowlist{
+		path:    filepath.Clean(path),
+		changed: true,
+	}
+}
+
+// reload reads the file again if it changed since it was last read, and reports whether it did. The
+// watcher is started by the first reload. If it can't be started, the file is read by every reload.
+func (a *groupAllowlist) reload(log zerolog.Logger) (changed bool, err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.watcher == nil && !a.closed {
+		a.watch(log)
+	}
+	if !a.changed && a.watcher != nil {
+		return false, nil
+	}
+
+	buf, err := ioutil.ReadFile(a.path)
+	if err != nil {
+		return false, fmt.Errorf("okta: error reading group allowlist: %w", err)
+	}
+	groupIDs := parseGroupAllowlist(buf)
+	changed = !equalSets(a.groupIDs, groupIDs)
+	a.groupIDs = groupIDs
+	a.changed = false
+	return changed, nil
+}
+
+// watch starts watching the directory of the file, so changes made by replacing the file, such as
+// Kubernetes config map updates, are seen.
+func (a *groupAllowlist) watch(log zerolog.Logger) {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(filepath.Dir(a.path))
+		if err != nil {
+			_ = watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("path", a.path).Msg("failed to watch group allowlist, it is read by every sync")
+		return
+	}
+	a.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case evt, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(evt.Name) == a.path {
+					a.mu.Lock()
+					a.changed = true
+					a.mu.Unlock()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn().Err(err).Str("path", a.path).Msg("error watching group allowlist")
+			}
+		}
+	}()
+}
+
+// allowed reports whether a group is in the allowlist, by either its Okta or directory id.
+func (a *groupAllowlist) allowed(groupID, directoryGroupID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	_, ok := a.groupIDs[groupID]
+	if !ok {
+		_, ok = a.groupIDs[directoryGroupID]
+	}
+	return ok
+}
+
+// close stops watching the file, after which it is read by every reload.
+func (a *groupAllowlist) close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	if a.watcher == nil {
+		return nil
+	}
+	err := a.watcher.Close()
+	a.watcher = nil
+	return err
+}
+
+// parseGroupAllowlist parses a group allowlist file, which has a group id per line. Blank lines and lines
+// starting with `#` are ignored.
+func parseGroupAllowlist(buf []byte) map[string]struct{} {
+	groupIDs := map[string]struct{}{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		groupIDs[line] = struct{}{}
+	}
+	return groupIDs
+}
+
+func equalSets(a, b map[string]struct{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package okta
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsGroupAllowlistFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "okta-allowlist")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "groups.txt")
+	require.NoError(t, ioutil.WriteFile(path, []byte("# relevant groups\nuser\n"), 0o600))
+
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithGroupAllowlistFile(path),
+	)
+	defer p.Close()
+
+	groupIDs := func(groups []*directory.Group) []string {
+		var ids []string
+		for _, group := range groups {
+			ids = append(ids, group.Id)
+		}
+		return ids
+	}
+
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user"}, groupIDs(groups))
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("admin\ntest\n"), 0o600))
+	assert.Eventually(t, func() bool {
+		groups, users, err = p.UserGroups(context.Background())
+		return err == nil && assert.ObjectsAreEqual([]string{"admin", "test"}, groupIDs(groups))
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"test"}},
+	}, users)
+}
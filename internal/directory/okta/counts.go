@@ -0,0 +1,75 @@
+package okta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Counts returns the number of groups and the total number of their memberships, without listing the
+// members of each group or performing a full sync, such as for capacity monitoring. Groups are listed with
+// `expand=stats`, and the same group filter, search query and allowlist as UserGroups apply, but every
+// group is counted, not only those updated since the previous sync. Users are counted once per group they
+// are a member of, so memberships is an upper bound of the number of synced users.
+// https://developer.okta.com/docs/reference/api/groups/#list-groups-with-search
+func (p *Provider) Counts(ctx context.Context) (memberships, groups int, err error) {
+	memberships, groups, err = p.counts(ctx)
+	return memberships, groups, p.redact(err)
+}
+
+func (p *Provider) counts(ctx context.Context) (memberships, groups int, err error) {
+	if !p.cfg.hasCredentials() {
+		return 0, 0, fmt.Errorf("okta: service account not defined")
+	}
+	if p.cfg.providerURL == nil {
+		return 0, 0, fmt.Errorf("okta: provider url not defined")
+	}
+
+	u := &url.URL{Path: "/api/v1/groups"}
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.batchSize("groups", maxGroupsBatchSize)))
+	q.Set("expand", "stats")
+	if p.cfg.groupSearchQuery != "" {
+		q.Set("q", p.cfg.groupSearchQuery)
+	}
+	// unlike the sync's listing, the count isn't incremental
+	if p.cfg.groupFilter != "" {
+		q.Set("filter", p.cfg.groupFilter)
+	}
+	u.RawQuery = q.Encode()
+
+	groupURL := p.cfg.providerURL.ResolveReference(u).String()
+	for groupURL != "" {
+		var out []struct {
+			ID       string                 `json:"id"`
+			Type     string                 `json:"type"`
+			Profile  map[string]interface{} `json:"profile"`
+			Embedded struct {
+				Stats struct {
+					UsersCount int64 `json:"usersCount"`
+				} `json:"stats"`
+			} `json:"_embedded"`
+		}
+		hdrs, err := p.apiGet(ctx, groupURL, &out)
+		if err != nil {
+			return 0, 0, fmt.Errorf("okta: error querying for group counts: %w", err)
+		}
+
+		for _, el := range out {
+			if el.ID == "" {
+				continue
+			}
+			if p.allowlist != nil {
+				group := p.newGroup(el.ID, p.getProfileField(el.Profile, ProfileFieldName), el.Type)
+				if !p.allowlist.allowed(el.ID, group.Id) {
+					continue
+				}
+			}
+			groups++
+			memberships += int(el.Embedded.Stats.UsersCount)
+		}
+		groupURL = getNextLink(hdrs)
+	}
+	return memberships, groups, nil
+}
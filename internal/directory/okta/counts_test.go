@@ -0,0 +1,85 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_Counts(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/groups" {
+			http.Error(w, "members should not be listed", http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, "stats", r.URL.Query().Get("expand"))
+		if r.URL.Query().Get("after") == "" {
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups?after=00g2&expand=stats>; rel="next"`, srv.URL))
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "00g1", "profile": M{"name": "admins"}, "_embedded": M{"stats": M{"usersCount": 2}}},
+				{"id": "00g2", "profile": M{"name": "users"}, "_embedded": M{"stats": M{"usersCount": 40}}},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]M{
+			{"id": "00g3", "profile": M{"name": "contractors"}, "_embedded": M{"stats": M{"usersCount": 5}}},
+		})
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	memberships, groups, err := p.Counts(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 47, memberships)
+	assert.Equal(t, 3, groups)
+}
+
+func TestProvider_CountsAfterSync(t *testing.T) {
+	var counting int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users") {
+			_ = json.NewEncoder(w).Encode([]M{{"id": "00u1"}})
+			return
+		}
+		if atomic.LoadInt32(&counting) == 1 {
+			assert.Empty(t, r.URL.Query().Get("filter"), "the count should not be incremental")
+		}
+		if r.URL.Query().Get("filter") != "" {
+			// no groups were updated since the previous sync
+			_ = json.NewEncoder(w).Encode([]M{})
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]M{
+			{"id": "00g1", "profile": M{"name": "admins"}, "_embedded": M{"stats": M{"usersCount": 2}}},
+			{"id": "00g2", "profile": M{"name": "users"}, "_embedded": M{"stats": M{"usersCount": 40}}},
+		})
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.NotNil(t, p.lastUpdated, "the next group listing of the sync should be incremental")
+
+	atomic.StoreInt32(&counting, 1)
+	memberships, groups, err := p.Counts(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 42, memberships)
+	assert.Equal(t, 2, groups)
+}
@@ -0,0 +1,43 @@
+package okta
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/tomnomnom/linkheader"
+)
+
+// A cursorPage is a listing page which carries the cursor of the next page in its body.
+type cursorPage struct {
+	Data  json.RawMessage `json:"data"`
+	After string          `json:"after"`
+}
+
+// decodeBodyCursor decodes a response body which may be wrapped in a cursorPage. Bodies which aren't are
+// decoded as is. If the body cursor is set and the response has no next link, one is added to the returned
+// headers so pagination continues with the cursor.
+func decodeBodyCursor(uri string, hdrs http.Header, body []byte, out interface{}) (http.Header, error) {
+	var page cursorPage
+	if err := json.Unmarshal(body, &page); err != nil || page.Data == nil {
+		return hdrs, json.Unmarshal(body, out)
+	}
+	if err := json.Unmarshal(page.Data, out); err != nil {
+		return nil, err
+	}
+
+	if page.After != "" && getNextLink(hdrs) == "" {
+		u, err := url.Parse(uri)
+		if err != nil {
+			return nil, fmt.Errorf("okta: invalid listing url: %w", err)
+		}
+		q := u.Query()
+		q.Set("after", page.After)
+		u.RawQuery = q.Encode()
+
+		hdrs = hdrs.Clone()
+		hdrs.Add("Link", linkheader.Link{URL: u.String(), Rel: "next"}.String())
+	}
+	return hdrs, nil
+}
@@ -0,0 +1,68 @@
+package okta
+
+import (
+	"context"
+	"time"
+)
+
+type launchContextKey struct{}
+
+// withDrain returns the contexts of a sync, when the drain timeout option is set. launchCtx is done when
+// ctx is done or the provider is closed during the sync, after which the sync shouldn't launch new
+// requests. requestCtx, used by the requests, is done the drain timeout later, so requests in flight can
+// complete. requestCtx keeps the values and the deadline of ctx, so retries are still scheduled against
+// the sync deadline. cancel must be called once the sync completes.
+func (p *Provider) withDrain(ctx context.Context) (launchCtx, requestCtx context.Context, cancel context.CancelFunc) {
+	if p.cfg.drainTimeout <= 0 {
+		return ctx, ctx, func() {}
+	}
+
+	p.closingMu.Lock()
+	closing := p.closing
+	p.closingMu.Unlock()
+
+	launchCtx, cancelLaunch := context.WithCancel(ctx)
+	requestCtx, cancelRequests := context.WithCancel(detachedContext{ctx})
+	requestCtx = context.WithValue(requestCtx, launchContextKey{}, launchCtx)
+	completed := make(chan struct{})
+	go func() {
+		select {
+		case <-launchCtx.Done():
+		case <-closing:
+			cancelLaunch()
+		case <-completed:
+			return
+		}
+
+		timer := time.NewTimer(p.cfg.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			cancelRequests()
+		case <-completed:
+		}
+	}()
+	return launchCtx, requestCtx, func() {
+		close(completed)
+		cancelLaunch()
+		cancelRequests()
+	}
+}
+
+// launchErr returns a non-nil error once no new requests should be launched for the sync of ctx.
+func launchErr(ctx context.Context) error {
+	if launchCtx, ok := ctx.Value(launchContextKey{}).(context.Context); ok {
+		return launchCtx.Err()
+	}
+	return ctx.Err()
+}
+
+// A detachedContext has the values and the deadline of its parent, but is never done.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (ctx detachedContext) Deadline() (deadline time.Time, ok bool) { return ctx.parent.Deadline() }
+func (ctx detachedContext) Done() <-chan struct{}                   { return nil }
+func (ctx detachedContext) Err() error                              { return nil }
+func (ctx detachedContext) Value(key interface{}) interface{}       { return ctx.parent.Value(key) }
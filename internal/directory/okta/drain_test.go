@@ -0,0 +1,111 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestProvider_UserGroupsDrain(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	var memberFetches int32
+	started := make(chan struct{}, 10)
+	var responseDelay atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" {
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "00g1", "profile": M{"name": "admins"}},
+				{"id": "00g2", "profile": M{"name": "users"}},
+			})
+			return
+		}
+		atomic.AddInt32(&memberFetches, 1)
+		started <- struct{}{}
+		select {
+		case <-time.After(responseDelay.Load().(time.Duration)):
+		case <-r.Context().Done():
+			return
+		}
+		id := strings.Split(r.URL.Path, "/")[4]
+		_ = json.NewEncoder(w).Encode([]M{{"id": "member-of-" + id}})
+	}))
+	defer srv.Close()
+
+	runSync := func(t *testing.T, p *Provider, stop func(cancel context.CancelFunc)) ([]string, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-started
+			stop(cancel)
+		}()
+		_, users, err := p.UserGroups(ctx)
+		var userIDs []string
+		for _, user := range users {
+			userIDs = append(userIDs, user.Id)
+		}
+		return userIDs, err
+	}
+
+	t.Run("in-flight fetches are drained", func(t *testing.T) {
+		atomic.StoreInt32(&memberFetches, 0)
+		responseDelay.Store(50 * time.Millisecond)
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithDrainTimeout(time.Second),
+			WithReturnPartialOnCancel(true),
+		)
+		defer p.Close()
+
+		userIDs, err := runSync(t, p, func(cancel context.CancelFunc) { cancel() })
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"okta/member-of-00g1"}, userIDs, "the in-flight fetch should complete")
+		assert.Equal(t, int32(1), atomic.LoadInt32(&memberFetches), "no new fetch should be launched")
+	})
+	t.Run("drain is bounded", func(t *testing.T) {
+		responseDelay.Store(time.Minute)
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithDrainTimeout(50*time.Millisecond),
+		)
+		defer p.Close()
+
+		start := time.Now()
+		_, err := runSync(t, p, func(cancel context.CancelFunc) { cancel() })
+		assert.True(t, errors.Is(err, context.Canceled), "expected a canceled error, got %v", err)
+		assert.True(t, time.Since(start) < 5*time.Second, "the drain should be bounded by the drain timeout")
+	})
+	t.Run("close", func(t *testing.T) {
+		atomic.StoreInt32(&memberFetches, 0)
+		responseDelay.Store(50 * time.Millisecond)
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithDrainTimeout(time.Second),
+		)
+
+		_, err := runSync(t, p, func(context.CancelFunc) { _ = p.Close() })
+		assert.True(t, errors.Is(err, context.Canceled), "expected a canceled error, got %v", err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&memberFetches), "no new fetch should be launched after close")
+
+		responseDelay.Store(time.Duration(0))
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err, "syncs after close should not be canceled")
+		assert.Len(t, users, 2)
+		_ = p.Close()
+	})
+}
@@ -0,0 +1,67 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// A cachedPage is a listing page and the ETag Okta returned for it.
+type cachedPage struct {
+	etag   string
+	body   json.RawMessage
+	header http.Header
+}
+
+// A pageCache stores listing pages by url so unchanged pages can be retrieved with conditional requests.
+type pageCache struct {
+	previous map[string]*cachedPage
+	current  map[string]*cachedPage
+}
+
+func newPageCache() *pageCache {
+	return &pageCache{
+		previous: make(map[string]*cachedPage),
+		current:  make(map[string]*cachedPage),
+	}
+}
+
+// reset starts a new listing. Pages from the previous listing remain available to it, but are dropped
+// if they aren't requested again.
+func (c *pageCache) reset() {
+	c.previous = c.current
+	c.current = make(map[string]*cachedPage)
+}
+
+// apiGetCached is like apiGet, but caches pages in the page cache. If the page was seen before, its ETag is
+// sent in an If-None-Match header and a 304 Not Modified response is served from the cache.
+func (p *Provider) apiGetCached(ctx context.Context, uri string, out interface{}) (http.Header, error) {
+	c := p.pages
+	cached, ok := c.current[uri]
+	if !ok {
+		cached, ok = c.previous[uri]
+	}
+	var etag string
+	if ok {
+		etag = cached.etag
+	}
+
+	var body json.RawMessage
+	hdrs, notModified, err := p.apiGetIfNoneMatch(ctx, uri, etag, &body)
+	if err != nil {
+		return nil, err
+	}
+
+	if notModified {
+		body, hdrs = cached.body, cached.header
+		c.current[uri] = cached
+	} else if etag := hdrs.Get("ETag"); etag != "" {
+		c.current[uri] = &cachedPage{
+			etag:   etag,
+			body:   body,
+			header: hdrs,
+		}
+	}
+
+	return hdrs, json.Unmarshal(body, out)
+}
@@ -0,0 +1,58 @@
+package okta
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_UserGroupsETag(t *testing.T) {
+	var mockOkta http.Handler
+	var notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/groups" {
+			mockOkta.ServeHTTP(w, r)
+			return
+		}
+
+		rec := httptest.NewRecorder()
+		mockOkta.ServeHTTP(rec, r)
+		sum := sha256.Sum256(rec.Body.Bytes())
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Link", rec.Header().Get("Link"))
+		_, _ = w.Write(rec.Body.Bytes())
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "user-updated"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	groups1, users1, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, notModified)
+
+	groups2, users2, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, notModified, "both pages of the unchanged listing should not be modified")
+	assert.ElementsMatch(t, groups1, groups2)
+	assert.Equal(t, users1, users2)
+}
@@ -0,0 +1,64 @@
+package okta
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// eventHookChallengeHeader is the header Okta sends a one-time verification value in when an event hook
+// is registered.
+const eventHookChallengeHeader = "X-Okta-Verification-Challenge"
+
+// An EventHookVerifier verifies Okta event hook requests. Okta authenticates event hooks with a shared
+// secret sent in a configurable header.
+//
+// See https://developer.okta.com/docs/concepts/event-hooks/
+type EventHookVerifier struct {
+	header string
+	secret string
+}
+
+// NewEventHookVerifier creates a new EventHookVerifier which expects secret in the given header. If header
+// is empty, the Authorization header is used.
+func NewEventHookVerifier(header, secret string) *EventHookVerifier {
+	if header == "" {
+		header = "Authorization"
+	}
+	return &EventHookVerifier{
+		header: header,
+		secret: secret,
+	}
+}
+
+// VerifyWebhook verifies that the request contains the shared secret.
+func (v *EventHookVerifier) VerifyWebhook(r *http.Request, body []byte) error {
+	if v.secret == "" {
+		return fmt.Errorf("okta: event hook secret not defined")
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(v.header)), []byte(v.secret)) != 1 {
+		return fmt.Errorf("okta: invalid event hook %s header", v.header)
+	}
+	return nil
+}
+
+// HandleWebhookChallenge responds to the one-time verification request Okta sends when an event hook is
+// registered.
+func (v *EventHookVerifier) HandleWebhookChallenge(w http.ResponseWriter, r *http.Request) bool {
+	challenge := r.Header.Get(eventHookChallengeHeader)
+	if r.Method != http.MethodGet || challenge == "" {
+		return false
+	}
+
+	if err := v.VerifyWebhook(r, nil); err != nil {
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"verification": challenge,
+	})
+	return true
+}
@@ -0,0 +1,36 @@
+package okta
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventHookVerifier(t *testing.T) {
+	v := NewEventHookVerifier("", "SECRET")
+
+	r := httptest.NewRequest("POST", "/", nil)
+	assert.Error(t, v.VerifyWebhook(r, nil))
+	r.Header.Set("Authorization", "SECRET")
+	assert.NoError(t, v.VerifyWebhook(r, nil))
+
+	t.Run("challenge", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Authorization", "SECRET")
+		r.Header.Set("X-Okta-Verification-Challenge", "CHALLENGE")
+		w := httptest.NewRecorder()
+		assert.True(t, v.HandleWebhookChallenge(w, r))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"verification":"CHALLENGE"}`, w.Body.String())
+
+		r.Header.Set("Authorization", "INVALID")
+		w = httptest.NewRecorder()
+		assert.True(t, v.HandleWebhookChallenge(w, r))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		r = httptest.NewRequest("POST", "/", nil)
+		assert.False(t, v.HandleWebhookChallenge(httptest.NewRecorder(), r))
+	})
+}
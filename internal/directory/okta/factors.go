@@ -0,0 +1,78 @@
+package okta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// AttributeMFAEnrolled is the user attribute set by the resolve MFA status option. It is "true" when the
+// user has at least one active factor, and "false" otherwise.
+const AttributeMFAEnrolled = "mfa_enrolled"
+
+const factorStatusActive = "ACTIVE"
+
+// factorLookupBatchSize is the number of users whose factors are looked up concurrently. Okta has no bulk
+// factors endpoint, so users are looked up in batches of concurrent requests.
+const factorLookupBatchSize = 10
+
+// resolveMFAStatus sets the AttributeMFAEnrolled attribute of each user.
+func (p *Provider) resolveMFAStatus(ctx context.Context, users []*directory.User) error {
+	for start := 0; start < len(users); start += factorLookupBatchSize {
+		end := start + factorLookupBatchSize
+		if end > len(users) {
+			end = len(users)
+		}
+
+		if err := launchErr(ctx); err != nil {
+			return err
+		}
+
+		eg, ectx := errgroup.WithContext(ctx)
+		for _, user := range users[start:end] {
+			user := user
+			eg.Go(func() error {
+				enrolled, err := p.getMFAEnrolled(ectx, strings.TrimPrefix(user.Id, Name+"/"))
+				if err != nil {
+					return err
+				}
+				if user.Attributes == nil {
+					user.Attributes = make(map[string]string, 1)
+				}
+				user.Attributes[AttributeMFAEnrolled] = strconv.FormatBool(enrolled)
+				return nil
+			})
+		}
+		if err := eg.Wait(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getMFAEnrolled returns whether a user has at least one active factor.
+// https://developer.okta.com/docs/reference/api/factors/#list-enrolled-factors
+func (p *Provider) getMFAEnrolled(ctx context.Context, userID string) (bool, error) {
+	factorsURL := p.cfg.providerURL.ResolveReference(&url.URL{
+		Path: fmt.Sprintf("/api/v1/users/%s/factors", url.PathEscape(userID)),
+	}).String()
+
+	var out []struct {
+		Status string `json:"status"`
+	}
+	if _, err := p.apiGet(ctx, factorsURL, &out); err != nil {
+		return false, fmt.Errorf("okta: error querying for user factors: %w", err)
+	}
+	for _, factor := range out {
+		if factor.Status == factorStatusActive {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,92 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsResolveMFAStatus(t *testing.T) {
+	var mockOkta http.Handler
+	var factorLookups int32
+	factors := map[string][]M{
+		"a@example.com": {
+			{"factorType": "push", "status": "ACTIVE"},
+		},
+		"b@example.com": {
+			{"factorType": "sms", "status": "PENDING_ACTIVATION"},
+		},
+	}
+	r := chi.NewRouter()
+	r.Get("/api/v1/users/{user}/factors", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&factorLookups, 1)
+		out := factors[chi.URLParam(r, "user")]
+		if out == nil {
+			out = []M{}
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	})
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user"},
+		"c@example.com": {"user"},
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		for _, user := range users {
+			assert.Nil(t, user.Attributes)
+		}
+		assert.Equal(t, int32(0), atomic.LoadInt32(&factorLookups))
+	})
+	t.Run("enabled", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithResolveMFAStatus(true),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{
+				Id:         "okta/a@example.com",
+				Source:     "okta",
+				GroupIds:   []string{"admin", "user"},
+				Attributes: map[string]string{AttributeMFAEnrolled: "true"},
+			},
+			{
+				Id:         "okta/b@example.com",
+				Source:     "okta",
+				GroupIds:   []string{"user"},
+				Attributes: map[string]string{AttributeMFAEnrolled: "false"},
+			},
+			{
+				Id:         "okta/c@example.com",
+				Source:     "okta",
+				GroupIds:   []string{"user"},
+				Attributes: map[string]string{AttributeMFAEnrolled: "false"},
+			},
+		}, users)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&factorLookups))
+	})
+}
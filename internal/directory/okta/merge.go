@@ -0,0 +1,58 @@
+package okta
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// mergeGroups merges the groups with the same directory id, such as Okta groups whose names only differ by
+// case with the case insensitive groups option. A merged group has the alternative ids of all of them,
+// and its member count is the number of its synced members. Groups must be sorted by id.
+func mergeGroups(groups []*directory.Group, users []*directory.User) []*directory.Group {
+	merged := make([]*directory.Group, 0, len(groups))
+	mergedIDs := map[string]struct{}{}
+	for _, group := range groups {
+		if n := len(merged); n > 0 && merged[n-1].Id == group.Id {
+			last := merged[n-1]
+			if _, ok := mergedIDs[group.Id]; !ok {
+				// copy the first group, since groups are kept by the provider between syncs
+				last = proto.Clone(last).(*directory.Group)
+				// counted from the synced members below
+				last.MemberCount = 0
+				merged[n-1] = last
+				mergedIDs[group.Id] = struct{}{}
+			}
+			last.AltIds = sortedUnique(append(append([]string(nil), last.AltIds...), group.AltIds...))
+			continue
+		}
+		merged = append(merged, group)
+	}
+	if len(mergedIDs) == 0 {
+		return groups
+	}
+
+	for _, user := range users {
+		for _, groupID := range user.GroupIds {
+			if _, ok := mergedIDs[groupID]; ok {
+				i := sort.Search(len(merged), func(i int) bool { return merged[i].Id >= groupID })
+				merged[i].MemberCount++
+			}
+		}
+	}
+	return merged
+}
+
+// sortedUnique sorts ids and removes duplicates. It may modify ids.
+func sortedUnique(ids []string) []string {
+	sort.Strings(ids)
+	unique := ids[:0]
+	for _, id := range ids {
+		if len(unique) == 0 || id != unique[len(unique)-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -3,21 +3,30 @@ package okta
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/tomnomnom/linkheader"
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 
 	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/directory"
 )
@@ -28,27 +37,357 @@ const Name = "okta"
 // See https://developer.okta.com/docs/reference/rate-limits/#okta-api-endpoints-and-per-minute-limits
 const defaultQPS = 100 / 60
 
+// defaultMinAttemptTime is the default amount of time a retried request must have before the sync deadline.
+const defaultMinAttemptTime = time.Second
+
+// defaultVerifyRetryDelay is the delay between the attempts of Verify when no backoff strategy is set.
+const defaultVerifyRetryDelay = time.Second
+
+// maxStatusRetries is the number of times a request with a retriable status is retried.
+const maxStatusRetries = 3
+
+// defaultStatusRetryDelay is the delay before retrying a request with a retriable status when no backoff
+// strategy is set.
+const defaultStatusRetryDelay = time.Second
+
+// defaultMaxResponseBytes is the default maximum size of a response body from Okta.
+const defaultMaxResponseBytes = 64 << 20
+
+// defaultAuthScheme is the default scheme of the Authorization header sent with the service account API key.
+const defaultAuthScheme = "SSWS"
+
+// The maximum limit of each listing endpoint. Okta silently caps larger limits.
+// See https://developer.okta.com/docs/reference/api/groups/
+const (
+	maxGroupsBatchSize     = 10000
+	maxGroupUsersBatchSize = 1000
+	maxGroupRulesBatchSize = 200
+	maxUsersBatchSize      = 200
+)
+
 // Okta use ISO-8601, see https://developer.okta.com/docs/reference/api-overview/#media-types
 const filterDateFormat = "2006-01-02T15:04:05.999Z"
 
+const (
+	// GroupIDFieldID identifies groups by their Okta id.
+	GroupIDFieldID = "id"
+	// GroupIDFieldName identifies groups by their profile name.
+	GroupIDFieldName = "name"
+)
+
+const (
+	// MembershipTypeDirect is a group membership assigned directly to a user.
+	MembershipTypeDirect = "DIRECT"
+	// MembershipTypeRule is a group membership assigned to a user by a group rule.
+	MembershipTypeRule = "RULE"
+)
+
+const (
+	// ProfileFieldEmail is the canonical profile field of a user's email.
+	ProfileFieldEmail = "email"
+	// ProfileFieldLocale is the canonical profile field of a user's locale.
+	ProfileFieldLocale = "locale"
+	// ProfileFieldLogin is the canonical profile field of a user's login.
+	ProfileFieldLogin = "login"
+	// ProfileFieldName is the canonical profile field of a group's name.
+	ProfileFieldName = "name"
+	// ProfileFieldTimezone is the canonical profile field of a user's timezone.
+	ProfileFieldTimezone = "timezone"
+)
+
+const (
+	userStatusActive        = "ACTIVE"
+	userStatusDeprovisioned = "DEPROVISIONED"
+	activeUserFilter        = `status eq "` + userStatusActive + `"`
+)
+
 type config struct {
-	batchSize      int
-	httpClient     *http.Client
-	providerURL    *url.URL
-	serviceAccount *ServiceAccount
-	qps            float64
+	activeUsersOnly       bool
+	allowAdminHost        bool
+	allowPartialResults   bool
+	authScheme            string
+	backoff               directory.BackoffStrategy
+	batchSize             int
+	caseInsensitiveGroups bool
+	clientCertificates    []tls.Certificate
+	connectionSemaphore   chan struct{}
+	cursorFromBody        bool
+	drainTimeout          time.Duration
+	excludeGuests         bool
+	expandGroupRules      bool
+	expandStats           bool
+	fetchOrgInfo          bool
+	flattenAttributes     bool
+	followServerLinks     bool
+	groupAllowlistFile    string
+	groupAttributes       []string
+	groupFilter           string
+	groupIDField          string
+	groupSearchQuery      string
+	guestGroupID          string
+	guestPredicate        func(profile map[string]interface{}) bool
+	httpClient            *http.Client
+	idPipeline            []directory.IDTransform
+	incrementalUsers      bool
+	loginAlias            bool
+	maxMembersPerGroup    int
+	maxResponseBytes      int64
+	membershipLogger      func(groupID string, added, removed []string)
+	membershipTypes       []string
+	onlyUsers             []string
+	priorityGroups        []string
+	minAttemptTime        time.Duration
+	minTLSVersion         uint16
+	profileFieldMap       map[string]string
+	providerURL           *url.URL
+	proxyURL              *url.URL
+	rateLimiter           *directory.RateLimiter
+	reconcileUsers        bool
+	reportLoginMismatch   bool
+	requestSigner         func(req *http.Request) error
+	resolveMFAStatus      bool
+	retriableStatuses     []int
+	returnPartialOnCancel bool
+	serviceAccount        *ServiceAccount
+	shouldSync            func() bool
+	singleUserPass        bool
+	sortBy                string
+	tokenSource           oauth2.TokenSource
+	typeNamespacedGroups  bool
+	useEmbeddedMembers    bool
+	userAttributes        []string
+	verifyRetries         int
+	qps                   float64
 }
 
 // An Option configures the Okta Provider.
 type Option func(cfg *config)
 
-// WithBatchSize sets the batch size option.
+// WithActiveUsersOnly sets the active users only option. When enabled, a status filter is sent with user
+// listing requests so inactive users are excluded by Okta, and any inactive users returned by endpoints
+// which ignore the filter are dropped.
+func WithActiveUsersOnly(activeUsersOnly bool) Option {
+	return func(cfg *config) {
+		cfg.activeUsersOnly = activeUsersOnly
+	}
+}
+
+// WithAllowAdminHost sets the allow admin host option. By default NewProvider rejects a provider url
+// pointing at an Okta admin dashboard host, such as `example-admin.okta.com`, since the API is served by
+// the host without `-admin`. When enabled, such a url, for example of a custom proxy, is only warned about.
+func WithAllowAdminHost(allowAdminHost bool) Option {
+	return func(cfg *config) {
+		cfg.allowAdminHost = allowAdminHost
+	}
+}
+
+// WithAllowPartialResults sets the allow partial results option. When enabled, a page of group members
+// which can't be decoded, such as an error page from a flaky proxy, is requested again once. If it still
+// can't be decoded, the sync continues with the members retrieved so far, and the group is reported as
+// incomplete in the sync report. By default such a page fails the sync.
+func WithAllowPartialResults(allowPartialResults bool) Option {
+	return func(cfg *config) {
+		cfg.allowPartialResults = allowPartialResults
+	}
+}
+
+// WithAuthScheme sets the auth scheme option, the scheme of the Authorization header sent with the
+// service account API key. It defaults to SSWS, and can be changed for gateways which translate another
+// scheme, such as Bearer. It has no effect when a token source is set.
+func WithAuthScheme(authScheme string) Option {
+	return func(cfg *config) {
+		cfg.authScheme = authScheme
+	}
+}
+
+// WithBackoff sets the backoff option. When Okta rate limits a request, it is retried after the delay
+// returned by the strategy for the attempt, or at the rate limit reset time sent by Okta if that is later.
+// By default only the reset time is used. Requests with a retriable status are retried after the delay
+// returned by the strategy, or after a second by default.
+func WithBackoff(backoff directory.BackoffStrategy) Option {
+	return func(cfg *config) {
+		cfg.backoff = backoff
+	}
+}
+
+// WithBatchSize sets the batch size option. It is the page size of every listing request, and is clamped to
+// the maximum supported by each endpoint, with a warning, if it is larger.
 func WithBatchSize(batchSize int) Option {
 	return func(cfg *config) {
 		cfg.batchSize = batchSize
 	}
 }
 
+// WithCaseInsensitiveGroups sets the case insensitive groups option. When enabled, group names are
+// lowercased, so with GroupIDFieldName, Okta groups whose names only differ by case, such as `Admins` and
+// `admins`, are merged into one group whose members are the union of their members. It is disabled by
+// default to avoid surprising merges.
+func WithCaseInsensitiveGroups(caseInsensitiveGroups bool) Option {
+	return func(cfg *config) {
+		cfg.caseInsensitiveGroups = caseInsensitiveGroups
+	}
+}
+
+// WithClientCertificate adds a client certificate which is presented to Okta, or a gateway in front of
+// it, when it requests mutual TLS. It applies to the transport of the http client, whether it is the
+// default or set with WithHTTPClient, and keeps the transport's other TLS settings such as its CA pool.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(cfg *config) {
+		cfg.clientCertificates = append(cfg.clientCertificates, cert)
+	}
+}
+
+// WithConnectionSemaphore sets the connection semaphore option. Every request to Okta holds the semaphore
+// until its response is read, so providers sharing a semaphore make at most cap(semaphore) requests at a
+// time, regardless of how many providers there are.
+func WithConnectionSemaphore(semaphore chan struct{}) Option {
+	return func(cfg *config) {
+		cfg.connectionSemaphore = semaphore
+	}
+}
+
+// WithCursorFromBody sets the cursor from body option. When enabled, listing responses may be wrapped in
+// an object such as `{"data": [...], "after": "<cursor>"}`, as returned by some proxied Okta deployments.
+// If such a response has no `Link: rel="next"` header, the next page is requested with the body cursor as
+// the `after` query parameter.
+func WithCursorFromBody(cursorFromBody bool) Option {
+	return func(cfg *config) {
+		cfg.cursorFromBody = cursorFromBody
+	}
+}
+
+// WithDrainTimeout sets the drain timeout option. When set, once a sync is canceled, or the provider is
+// closed, no new group member fetches are started, but the requests in flight are given up to the drain
+// timeout to complete before they are canceled too, so partial results include them. By default requests
+// are canceled with the sync.
+func WithDrainTimeout(drainTimeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.drainTimeout = drainTimeout
+	}
+}
+
+// WithExcludeGuests sets the exclude guests option. When enabled, guest users are removed from every
+// group. Guests are the members of the guest group, if one is set, and the users matching the guest
+// predicate, which defaults to users whose profile userType is "guest".
+func WithExcludeGuests(excludeGuests bool) Option {
+	return func(cfg *config) {
+		cfg.excludeGuests = excludeGuests
+	}
+}
+
+// WithExpandGroupRules sets the expand group rules option. When enabled, members of groups referenced
+// by active group rules are also counted as members of the groups those rules assign them to. Only rules
+// whose expression is an OR of isMemberOfGroup and isMemberOfAnyGroup calls, and which exclude no users,
+// are expanded. This requires additional calls to list the group rules on every sync.
+func WithExpandGroupRules(expandGroupRules bool) Option {
+	return func(cfg *config) {
+		cfg.expandGroupRules = expandGroupRules
+	}
+}
+
+// WithExpandStats sets the expand stats option. When enabled, groups are listed with `expand=stats` and
+// the member count of each group is taken from the returned stats rather than counted from the members
+// retrieved during the sync.
+func WithExpandStats(expandStats bool) Option {
+	return func(cfg *config) {
+		cfg.expandStats = expandStats
+	}
+}
+
+// WithFetchOrgInfo sets the fetch org info option. When enabled, the tenant's company name and subdomain
+// are retrieved once per sync and recorded in the sync report.
+func WithFetchOrgInfo(fetchOrgInfo bool) Option {
+	return func(cfg *config) {
+		cfg.fetchOrgInfo = fetchOrgInfo
+	}
+}
+
+// WithFlattenNestedAttributes sets the flatten nested attributes option, which controls how the profile
+// values copied by the group attributes and user attributes options are converted to strings:
+//
+//   - strings are copied as is, and null values are omitted
+//   - when enabled, each field of an object is copied as its own attribute, named by the path to the field
+//     joined with dots, such as `address.city`, following these same rules
+//   - other values, including arrays and, when disabled, objects, are JSON encoded
+//
+// It is disabled by default.
+func WithFlattenNestedAttributes(flattenNestedAttributes bool) Option {
+	return func(cfg *config) {
+		cfg.flattenAttributes = flattenNestedAttributes
+	}
+}
+
+// WithFollowServerLinks sets the follow server links option. When enabled, group members are listed using
+// the `_links.users.href` URL returned by Okta for each group rather than a path constructed by the
+// provider. Groups without a users link, or with a link to a host other than the provider url, fall back
+// to the constructed path.
+func WithFollowServerLinks(followServerLinks bool) Option {
+	return func(cfg *config) {
+		cfg.followServerLinks = followServerLinks
+	}
+}
+
+// WithGroupAllowlistFile sets the group allowlist file option. Only the groups whose Okta or directory id
+// is listed in the file, one per line, are synced. Blank lines and lines starting with `#` are ignored.
+// The file is watched for changes, which apply from the next sync.
+func WithGroupAllowlistFile(path string) Option {
+	return func(cfg *config) {
+		cfg.groupAllowlistFile = path
+	}
+}
+
+// WithGroupAttributes sets the group attributes option. The given attributes of each group's Okta profile
+// are copied into the directory group's attributes. Attributes missing from a profile are omitted, and
+// values which aren't strings are converted as described by WithFlattenNestedAttributes.
+func WithGroupAttributes(groupAttributes []string) Option {
+	return func(cfg *config) {
+		cfg.groupAttributes = groupAttributes
+	}
+}
+
+// WithGroupFilter sets the group filter option. When set, only groups matching the Okta filter expression,
+// such as `type eq "OKTA_GROUP"`, are listed. It is combined with the filter of incremental listings, and
+// can't be combined with the group search query option, since Okta rejects `q` with `filter`.
+func WithGroupFilter(groupFilter string) Option {
+	return func(cfg *config) {
+		cfg.groupFilter = groupFilter
+	}
+}
+
+// WithGroupIDField sets the group id field option. It determines whether groups, and the group ids of
+// users, are identified by the Okta group id (GroupIDFieldID) or the group name (GroupIDFieldName).
+// The other identifier is available in the group's alternative ids.
+func WithGroupIDField(field string) Option {
+	return func(cfg *config) {
+		cfg.groupIDField = field
+	}
+}
+
+// WithGroupSearchQuery sets the group search query option. When set, only groups whose name starts with
+// the query are listed, using Okta's `q` parameter, rather than enumerating every group. Since Okta rejects
+// `q` with `filter`, every sync then lists all the matching groups instead of only the updated ones.
+func WithGroupSearchQuery(groupSearchQuery string) Option {
+	return func(cfg *config) {
+		cfg.groupSearchQuery = groupSearchQuery
+	}
+}
+
+// WithGuestGroupID sets the guest group id option. When guests are excluded, members of the Okta group
+// with this id are considered guests.
+func WithGuestGroupID(guestGroupID string) Option {
+	return func(cfg *config) {
+		cfg.guestGroupID = guestGroupID
+	}
+}
+
+// WithGuestPredicate sets the guest predicate option. When guests are excluded, users whose Okta profile
+// matches the predicate are considered guests.
+func WithGuestPredicate(guestPredicate func(profile map[string]interface{}) bool) Option {
+	return func(cfg *config) {
+		cfg.guestPredicate = guestPredicate
+	}
+}
+
 // WithHTTPClient sets the http client option.
 func WithHTTPClient(httpClient *http.Client) Option {
 	return func(cfg *config) {
@@ -56,6 +395,117 @@ func WithHTTPClient(httpClient *http.Client) Option {
 	}
 }
 
+// WithIDPipeline sets the id pipeline option. The transforms, such as directory.LowercaseID, are applied in
+// order to the Okta id of each user before it's prefixed with the provider name. Transformed ids may no
+// longer match the sub claim of the user's ID tokens.
+func WithIDPipeline(transforms ...directory.IDTransform) Option {
+	return func(cfg *config) {
+		cfg.idPipeline = transforms
+	}
+}
+
+// WithIncrementalUsers sets the incremental users option. When enabled, after the first full sync only
+// the members of groups whose membership changed are listed again. Users updated since the previous sync,
+// for example because they were deactivated or their profile changed, are retrieved from the users
+// endpoint and their groups are merged into the result. Membership types are not known for merged users,
+// so they are not filtered by the membership types option.
+func WithIncrementalUsers(incrementalUsers bool) Option {
+	return func(cfg *config) {
+		cfg.incrementalUsers = incrementalUsers
+	}
+}
+
+// WithLoginAlias sets the login alias option. When enabled, the login and email of each user's Okta profile
+// are added to the user's aliases, so policy can match users by either. The user id is unchanged.
+func WithLoginAlias(loginAlias bool) Option {
+	return func(cfg *config) {
+		cfg.loginAlias = loginAlias
+	}
+}
+
+// WithMaxMembersPerGroup sets the max members per group option. When set, only the first
+// maxMembersPerGroup members of each group are retrieved and a warning is recorded in the sync report for
+// any group which is truncated. By default the number of members is unlimited.
+func WithMaxMembersPerGroup(maxMembersPerGroup int) Option {
+	return func(cfg *config) {
+		cfg.maxMembersPerGroup = maxMembersPerGroup
+	}
+}
+
+// WithMaxResponseBytes sets the max response bytes option. Responses from Okta with a larger body fail
+// the request rather than being read into memory. It defaults to 64 MiB, which is also used for values
+// which aren't positive.
+func WithMaxResponseBytes(maxResponseBytes int64) Option {
+	return func(cfg *config) {
+		cfg.maxResponseBytes = maxResponseBytes
+	}
+}
+
+// WithMembershipChangeLogger sets the membership change logger option. After each sync, the logger is
+// called for every group whose members changed since the previous sync, in group id order, with the ids
+// of the users which joined and left the group. It isn't called after the first sync.
+func WithMembershipChangeLogger(membershipLogger func(groupID string, added, removed []string)) Option {
+	return func(cfg *config) {
+		cfg.membershipLogger = membershipLogger
+	}
+}
+
+// WithMembershipTypes sets the membership types option. Only group memberships of the given types
+// (MembershipTypeDirect, MembershipTypeRule) contribute to a user's groups. Members without a membership
+// type are considered direct members. By default all membership types are included.
+func WithMembershipTypes(membershipTypes []string) Option {
+	return func(cfg *config) {
+		cfg.membershipTypes = membershipTypes
+	}
+}
+
+// WithMinAttemptTime sets the min attempt time option. A rate limited request is only retried if the
+// remaining time before the context deadline covers the rate limit reset plus minAttemptTime. Otherwise
+// the rate limit error is returned. Defaults to one second.
+func WithMinAttemptTime(minAttemptTime time.Duration) Option {
+	return func(cfg *config) {
+		cfg.minAttemptTime = minAttemptTime
+	}
+}
+
+// WithMinTLSVersion sets the min TLS version option. Connections to Okta using an older TLS version, such
+// as tls.VersionTLS11, are refused. It defaults to tls.VersionTLS12, and is ignored when a client is set
+// with WithHTTPClient, whose TLS configuration is then used as is.
+func WithMinTLSVersion(minTLSVersion uint16) Option {
+	return func(cfg *config) {
+		cfg.minTLSVersion = minTLSVersion
+	}
+}
+
+// WithOnlyUsers sets the only users option. It is meant for troubleshooting a user's access rather than
+// for production syncs. When set, only the given users, identified by id or login, are resolved using
+// the user-centric endpoints, and only the groups they are members of are returned. Incremental state
+// is neither used nor updated.
+func WithOnlyUsers(users []string) Option {
+	return func(cfg *config) {
+		cfg.onlyUsers = users
+	}
+}
+
+// WithPriorityGroups sets the priority groups option, typically to the groups referenced by policy. The
+// members of the given groups, by Okta or directory group id, are retrieved first. The members of other
+// groups are then retrieved on a best-effort basis: once less than the min attempt time is left before
+// the sync deadline, the remaining groups keep the members of the previous sync, if any, with a warning.
+func WithPriorityGroups(groupIDs []string) Option {
+	return func(cfg *config) {
+		cfg.priorityGroups = groupIDs
+	}
+}
+
+// WithProfileFieldMap sets the profile field map option. It maps canonical profile fields
+// (ProfileFieldEmail, ProfileFieldLogin, ProfileFieldName) to the keys used by the tenant's Okta profiles.
+// Fields which aren't mapped are read from their canonical keys.
+func WithProfileFieldMap(profileFieldMap map[string]string) Option {
+	return func(cfg *config) {
+		cfg.profileFieldMap = profileFieldMap
+	}
+}
+
 // WithProviderURL sets the provider URL option.
 func WithProviderURL(uri *url.URL) Option {
 	return func(cfg *config) {
@@ -63,6 +513,77 @@ func WithProviderURL(uri *url.URL) Option {
 	}
 }
 
+// WithProxyURL sets the proxy URL option. When set, every request to Okta is sent through the given
+// proxy. By default the proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables is used.
+// It has no effect on custom http clients whose transport isn't an *http.Transport.
+func WithProxyURL(proxyURL *url.URL) Option {
+	return func(cfg *config) {
+		cfg.proxyURL = proxyURL
+	}
+}
+
+// WithRateLimiter sets the rate limiter option. Every request to Okta waits on the rate limiter, so
+// providers sharing a rate limiter are throttled together. When set, the QPS option is ignored.
+func WithRateLimiter(rateLimiter *directory.RateLimiter) Option {
+	return func(cfg *config) {
+		cfg.rateLimiter = rateLimiter
+	}
+}
+
+// WithReconcileUsers sets the reconcile users option. When enabled, the users of each sync are compared
+// with those of the previous sync, and the ids of users which are no longer in any group are recorded in
+// the sync report so their sessions can be revoked. Partial results are not reconciled.
+func WithReconcileUsers(reconcileUsers bool) Option {
+	return func(cfg *config) {
+		cfg.reconcileUsers = reconcileUsers
+	}
+}
+
+// WithReportLoginEmailMismatch sets the report login email mismatch option. When enabled, a warning is
+// recorded in the sync report for every group member whose Okta login differs from their email. The
+// synced users and groups are unaffected.
+func WithReportLoginEmailMismatch(reportLoginMismatch bool) Option {
+	return func(cfg *config) {
+		cfg.reportLoginMismatch = reportLoginMismatch
+	}
+}
+
+// WithRequestSigner sets the request signer option. The signer is called just before every request to
+// Okta is sent, including retries, after the provider set its own headers, so it can sign the final
+// request for a gateway in front of Okta. A signer error fails the request.
+func WithRequestSigner(requestSigner func(req *http.Request) error) Option {
+	return func(cfg *config) {
+		cfg.requestSigner = requestSigner
+	}
+}
+
+// WithResolveMFAStatus sets the resolve MFA status option. When enabled, the factors of every synced user
+// are looked up, and the user's AttributeMFAEnrolled attribute is set to whether they have an active
+// factor. It requires a request per user, so it is disabled by default.
+func WithResolveMFAStatus(resolveMFAStatus bool) Option {
+	return func(cfg *config) {
+		cfg.resolveMFAStatus = resolveMFAStatus
+	}
+}
+
+// WithRetriableStatuses sets the retriable statuses option. Requests whose responses have these statuses,
+// such as the 520 and 522 statuses some gateways return for transient failures of Okta, are retried up to
+// 3 times, like those with the default 502, 503 and 504 statuses. They are merged with the defaults, which
+// can't be removed. Verify doesn't retry them this way, but with its verify retries instead.
+func WithRetriableStatuses(retriableStatuses []int) Option {
+	return func(cfg *config) {
+		cfg.retriableStatuses = retriableStatuses
+	}
+}
+
+// WithReturnPartialOnCancel sets the return partial on cancel option. When enabled, a sync whose context
+// is canceled returns the groups and group memberships collected so far instead of an error.
+func WithReturnPartialOnCancel(returnPartialOnCancel bool) Option {
+	return func(cfg *config) {
+		cfg.returnPartialOnCancel = returnPartialOnCancel
+	}
+}
+
 // WithServiceAccount sets the service account option.
 func WithServiceAccount(serviceAccount *ServiceAccount) Option {
 	return func(cfg *config) {
@@ -70,6 +591,82 @@ func WithServiceAccount(serviceAccount *ServiceAccount) Option {
 	}
 }
 
+// WithShouldSync sets the should sync option. The hook is called before each sync, and when it returns
+// false the sync returns ErrSyncPaused without querying Okta, such as while the databroker the results
+// are stored in is unavailable, so API quota isn't spent on results which would be dropped.
+func WithShouldSync(shouldSync func() bool) Option {
+	return func(cfg *config) {
+		cfg.shouldSync = shouldSync
+	}
+}
+
+// WithSingleUserPass sets the single user pass option. When enabled, every user is listed once with their
+// groups expanded, and the members of each group are mapped locally, instead of listing the members of each
+// group separately. It avoids a request per group, which is much faster for orgs with many groups. If Okta
+// doesn't support expanding the groups of the user listing, the members of each group are listed instead.
+// The user listing doesn't report membership types, so every membership is treated as direct.
+func WithSingleUserPass(singleUserPass bool) Option {
+	return func(cfg *config) {
+		cfg.singleUserPass = singleUserPass
+	}
+}
+
+// WithSortBy sets the sort by option. When set, groups are listed sorted by the given field so the
+// pagination cursors follow a stable server-side order. By default Okta's ordering is used.
+func WithSortBy(sortBy string) Option {
+	return func(cfg *config) {
+		cfg.sortBy = sortBy
+	}
+}
+
+// WithTokenSource sets the token source option. When set, a token is retrieved from the token source
+// before each request and sent in the Authorization header instead of the service account API key.
+// Refreshing the token is left to the token source.
+func WithTokenSource(tokenSource oauth2.TokenSource) Option {
+	return func(cfg *config) {
+		cfg.tokenSource = tokenSource
+	}
+}
+
+// WithTypeNamespacedGroupIDs sets the type namespaced group ids option. When enabled and groups are
+// identified by name, group ids are prefixed by the Okta group type, such as APP_GROUP:engineering, so
+// groups of different types with the same name, such as an Okta group and an app group, stay distinct
+// rather than being merged. Okta group ids are unique, so they aren't prefixed.
+func WithTypeNamespacedGroupIDs(typeNamespacedGroups bool) Option {
+	return func(cfg *config) {
+		cfg.typeNamespacedGroups = typeNamespacedGroups
+	}
+}
+
+// WithUseEmbeddedMembers sets the use embedded members option. When enabled, the members of a group
+// embedded in the group listing, as `_embedded.users`, are used instead of listing the group's members
+// with a separate request. Groups without embedded members are still listed separately.
+func WithUseEmbeddedMembers(useEmbeddedMembers bool) Option {
+	return func(cfg *config) {
+		cfg.useEmbeddedMembers = useEmbeddedMembers
+	}
+}
+
+// WithUserAttributes sets the user attributes option. The given attributes of each user's Okta profile,
+// such as custom attributes, are copied into the directory user's attributes. Attributes missing from a
+// profile are omitted, and values which aren't strings are converted as described by
+// WithFlattenNestedAttributes.
+func WithUserAttributes(userAttributes []string) Option {
+	return func(cfg *config) {
+		cfg.userAttributes = userAttributes
+	}
+}
+
+// WithVerifyRetries sets the verify retries option. It is the number of times Verify retries the API
+// access probe after a network error or a retriable status, so a transient failure at startup doesn't
+// fail the health check. Other errors, such as a 403 for an invalid API key, are never retried. It doesn't
+// affect the retries of syncs. By default Verify doesn't retry.
+func WithVerifyRetries(verifyRetries int) Option {
+	return func(cfg *config) {
+		cfg.verifyRetries = verifyRetries
+	}
+}
+
 // WithQPS sets the query per second option.
 func WithQPS(qps float64) Option {
 	return func(cfg *config) {
@@ -79,8 +676,14 @@ func WithQPS(qps float64) Option {
 
 func getConfig(options ...Option) *config {
 	cfg := new(config)
+	WithAuthScheme(defaultAuthScheme)(cfg)
 	WithBatchSize(200)(cfg)
+	WithGroupIDField(GroupIDFieldID)(cfg)
+	WithGuestPredicate(isGuestUserType)(cfg)
 	WithHTTPClient(http.DefaultClient)(cfg)
+	WithMaxResponseBytes(defaultMaxResponseBytes)(cfg)
+	WithMinAttemptTime(defaultMinAttemptTime)(cfg)
+	WithMinTLSVersion(tls.VersionTLS12)(cfg)
 	WithQPS(defaultQPS)(cfg)
 	for _, option := range options {
 		option(cfg)
@@ -90,11 +693,38 @@ func getConfig(options ...Option) *config {
 
 // A Provider is an Okta user group directory provider.
 type Provider struct {
-	cfg         *config
-	log         zerolog.Logger
-	limiter     *rate.Limiter
-	lastUpdated *time.Time
-	groups      map[string]*directory.Group
+	cfg          *config
+	log          zerolog.Logger
+	limiter      *rate.Limiter
+	lastUpdated  *time.Time
+	groups       map[string]*directory.Group
+	listedGroups map[string]struct{}
+	// the members embedded in the most recent group listing, when use embedded members is enabled
+	embeddedMembers map[string][]groupMember
+	usersLinks      map[string]string
+	pages           *pageCache
+	allowlist       *groupAllowlist
+	memberFetches   singleflight.Group
+	previousUsers   []*directory.User
+	// the aliases of each user id, kept when login alias is enabled
+	userAliases map[string][]string
+	// the profile attributes of each user id, such as their locale
+	userAttributes map[string]map[string]string
+	// whether Okta ignored the expanded groups of a user listing, when single user pass is enabled
+	singleUserPassUnsupported bool
+
+	// the state of the previous sync, kept when incremental users is enabled
+	usersLastUpdated *time.Time
+	groupMemberIDs   map[string][]string
+
+	// closed by Close, and replaced so only the syncs in progress are stopped
+	closingMu sync.Mutex
+	closing   chan struct{}
+
+	mu                sync.RWMutex
+	report            *directory.SyncReport
+	clampedBatchSizes map[string]struct{}
+	pageStats         map[string]directory.PageStats
 }
 
 // New creates a new Provider.
@@ -103,85 +733,666 @@ func New(options ...Option) *Provider {
 	if cfg.qps == 0 {
 		cfg.qps = defaultQPS
 	}
-	return &Provider{
-		cfg:     cfg,
-		log:     log.With().Str("service", "directory").Str("provider", "okta").Logger(),
-		limiter: rate.NewLimiter(rate.Limit(cfg.qps), int(cfg.qps)),
-		groups:  make(map[string]*directory.Group),
+	if cfg.maxResponseBytes <= 0 {
+		cfg.maxResponseBytes = defaultMaxResponseBytes
+	}
+	if cfg.authScheme == "" {
+		cfg.authScheme = defaultAuthScheme
+	}
+	if cfg.httpClient == http.DefaultClient {
+		cfg.httpClient = directory.NewMinTLSVersionClient(cfg.httpClient, cfg.minTLSVersion)
+	}
+	if len(cfg.clientCertificates) > 0 {
+		cfg.httpClient = directory.NewClientCertificateClient(cfg.httpClient, cfg.clientCertificates...)
+	}
+	if cfg.proxyURL != nil {
+		cfg.httpClient = directory.NewProxyClient(cfg.httpClient, cfg.proxyURL)
+	}
+	if cfg.connectionSemaphore != nil {
+		cfg.httpClient = directory.NewSemaphoreClient(cfg.httpClient, cfg.connectionSemaphore)
+	}
+	limiter := cfg.rateLimiter
+	if limiter == nil {
+		limiter = rate.NewLimiter(rate.Limit(cfg.qps), int(cfg.qps))
+	}
+	p := &Provider{
+		cfg:        cfg,
+		log:        log.With().Str("service", "directory").Str("provider", "okta").Logger(),
+		limiter:    limiter,
+		groups:     make(map[string]*directory.Group),
+		usersLinks: make(map[string]string),
+		pages:      newPageCache(),
+		closing:    make(chan struct{}),
+	}
+	if cfg.groupAllowlistFile != "" {
+		p.allowlist = newGroupAllowlist(cfg.groupAllowlistFile)
+	}
+	return p
+}
+
+// NewProvider creates a new Provider like New, but first checks that the required options are set. The
+// returned error wraps directory.ErrConfig.
+func NewProvider(options ...Option) (*Provider, error) {
+	if err := getConfig(options...).validate(); err != nil {
+		return nil, err
+	}
+	p := New(options...)
+	if apiHost, ok := getAPIHost(p.cfg.providerURL.Hostname()); ok {
+		p.log.Warn().
+			Str("provider_url", p.cfg.providerURL.String()).
+			Str("api_host", apiHost).
+			Msg("provider url looks like an okta admin dashboard url rather than the api host")
+	}
+	return p, nil
+}
+
+// hasCredentials returns whether a service account or token source is set.
+func (cfg *config) hasCredentials() bool {
+	return cfg.serviceAccount != nil || cfg.tokenSource != nil
+}
+
+// validate checks that the options required to query Okta are set.
+func (cfg *config) validate() error {
+	switch {
+	case cfg.tokenSource != nil:
+		// the token source replaces the service account
+	case cfg.serviceAccount == nil:
+		return fmt.Errorf("%w: okta: service account not defined", directory.ErrConfig)
+	case cfg.serviceAccount.APIKey == "":
+		return fmt.Errorf("%w: okta: service account api key not defined", directory.ErrConfig)
+	}
+	switch {
+	case cfg.providerURL == nil:
+		return fmt.Errorf("%w: okta: provider url not defined", directory.ErrConfig)
+	case cfg.providerURL.Scheme == "" || cfg.providerURL.Host == "":
+		return fmt.Errorf("%w: okta: provider url %q must be absolute", directory.ErrConfig, cfg.providerURL)
+	}
+	if !httpguts.ValidHeaderFieldName(cfg.authScheme) {
+		return fmt.Errorf("%w: okta: auth scheme %q must be a single token", directory.ErrConfig, cfg.authScheme)
+	}
+	for _, status := range cfg.retriableStatuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("%w: okta: retriable status %d is not a valid http status", directory.ErrConfig, status)
+		}
+	}
+	if cfg.groupSearchQuery != "" && cfg.groupFilter != "" {
+		return fmt.Errorf("%w: okta: the group search query and group filter options can't be combined", directory.ErrConfig)
+	}
+	if apiHost, ok := getAPIHost(cfg.providerURL.Hostname()); ok && !cfg.allowAdminHost {
+		return fmt.Errorf("%w: okta: provider url %q is an admin dashboard url, use the api host %s instead",
+			directory.ErrConfig, cfg.providerURL, apiHost)
+	}
+	return nil
+}
+
+// ErrSyncPaused is returned by UserGroups when the should sync hook returns false.
+var ErrSyncPaused = errors.New("okta: sync paused")
+
+// oktaDomains are the domains Okta organizations are hosted on.
+var oktaDomains = []string{".okta.com", ".oktapreview.com", ".okta-emea.com"}
+
+// getAPIHost returns the API host of an Okta admin dashboard host, such as `example.okta.com` for
+// `example-admin.okta.com`. If host isn't an admin dashboard host, ok is false.
+func getAPIHost(host string) (apiHost string, ok bool) {
+	host = strings.ToLower(host)
+	for _, domain := range oktaDomains {
+		if org := strings.TrimSuffix(host, domain); org != host && strings.HasSuffix(org, "-admin") {
+			return strings.TrimSuffix(org, "-admin") + domain, true
+		}
+	}
+	return "", false
+}
+
+// UserGroups fetches the groups of which the user is a member
+// https://developer.okta.com/docs/reference/api/users/#get-user-s-groups
+//
+// Users are identified by their Okta user id, which is the sub claim of the ID tokens Okta issues, so
+// sessions can be matched to them with directory.MatchBySubject even when their emails differ.
+func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	groups, users, err := p.userGroups(ctx)
+	return groups, users, p.redact(err)
+}
+
+func (p *Provider) userGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	if !p.cfg.hasCredentials() {
+		return nil, nil, fmt.Errorf("okta: service account not defined")
+	}
+
+	tenant := directory.TenantFromContext(ctx)
+	logger := p.log
+	if tenant != "" {
+		logger = logger.With().Str("tenant", tenant).Logger()
+	}
+
+	logger.Info().Msg("getting user groups")
+
+	if p.cfg.providerURL == nil {
+		return nil, nil, fmt.Errorf("okta: provider url not defined")
+	}
+
+	if p.cfg.shouldSync != nil && !p.cfg.shouldSync() {
+		logger.Info().Msg("sync paused by the should sync hook")
+		return nil, nil, ErrSyncPaused
+	}
+
+	launchCtx, ctx, cancel := p.withDrain(ctx)
+	defer cancel()
+
+	// pages fetched outside of a sync, such as by refreshing a user, aren't reported
+	p.resetPageStats()
+	report := &directory.SyncReport{
+		Provider:  Name,
+		Tenant:    tenant,
+		StartTime: time.Now(),
+	}
+	defer p.setSyncReport(report)
+
+	if len(p.cfg.onlyUsers) > 0 {
+		logger.Warn().Strs("users", p.cfg.onlyUsers).Msg("only syncing the given users")
+		return p.getOnlyUsers(ctx)
+	}
+
+	if err := p.resume(ctx); err != nil {
+		logger.Warn().Err(err).Msg("failed to resume from cursor, performing a full sync")
+	}
+
+	if p.cfg.fetchOrgInfo {
+		org, err := p.getOrgInfo(ctx)
+		if err != nil {
+			logger.Warn().Err(err).Msg("failed to retrieve org info")
+		}
+		report.Org = org
+	}
+
+	if p.allowlist != nil {
+		changed, err := p.allowlist.reload(p.log)
+		if err != nil {
+			return nil, nil, err
+		}
+		if changed {
+			// newly allowed groups may not have been updated recently, so they are only found by listing
+			// every group again
+			p.lastUpdated = nil
+			for groupID, group := range p.groups {
+				if !p.allowlist.allowed(groupID, group.Id) {
+					delete(p.groups, groupID)
+					delete(p.usersLinks, groupID)
+				}
+			}
+		}
+	}
+
+	lastUpdated, usersLastUpdated := p.lastUpdated, p.usersLastUpdated
+	syncStarted := time.Now()
+	groupIDToMemberIDs := map[string][]string{}
+	warnings := newSyncWarnings()
+	truncatedGroupIDs := map[string]struct{}{}
+	onError := func(err error) ([]*directory.Group, []*directory.User, error) {
+		// the sync didn't complete, so the next one has to start from the same point
+		p.lastUpdated, p.usersLastUpdated = lastUpdated, usersLastUpdated
+		if p.cfg.returnPartialOnCancel && errors.Is(err, context.Canceled) {
+			logger.Warn().Err(err).Msg("sync canceled, returning partial results")
+			users := p.groupMembersToUsers(groupIDToMemberIDs)
+			return mergeGroups(p.knownGroups(), users), users, nil
+		}
+		return nil, nil, err
+	}
+
+	defer func() {
+		report.Warnings = warnings.list()
+	}()
+
+	groups, err := p.getGroups(ctx, warnings)
+	if err != nil {
+		return onError(err)
+	}
+
+	singleUserPass := false
+	if p.cfg.singleUserPass && !p.singleUserPassUnsupported {
+		memberIDs, truncated, err := p.getMemberIDsByUser(ctx, warnings)
+		if errors.Is(err, errGroupsExpansionUnsupported) {
+			logger.Warn().Err(err).Msg("listing the members of each group instead")
+			p.singleUserPassUnsupported = true
+		} else if err != nil {
+			return onError(err)
+		} else {
+			groupIDToMemberIDs, truncatedGroupIDs = memberIDs, truncated
+			singleUserPass = true
+		}
+	}
+
+	// every member was just listed, so there are no updated users to merge
+	incremental := p.cfg.incrementalUsers && usersLastUpdated != nil && !singleUserPass
+
+	if !singleUserPass {
+		// p.groups is keyed by the Okta group id, which may differ from the directory group id
+		for _, groupID := range p.syncOrder() {
+			if len(p.cfg.priorityGroups) > 0 && !p.isPriorityGroup(groupID) && !directory.CanRetry(ctx, 0, p.cfg.minAttemptTime) {
+				if ids, ok := p.groupMemberIDs[groupID]; ok {
+					groupIDToMemberIDs[groupID] = append([]string(nil), ids...)
+				}
+				warnings.add(directory.WarningCodeGroupSkipped, groupID,
+					"the sync deadline was reached before the members of group %s were retrieved", groupID)
+				continue
+			}
+			if _, listed := p.listedGroups[groupID]; incremental && !listed {
+				if ids, ok := p.groupMemberIDs[groupID]; ok {
+					groupIDToMemberIDs[groupID] = append([]string(nil), ids...)
+					continue
+				}
+			}
+
+			if err := launchCtx.Err(); err != nil {
+				return onError(err)
+			}
+
+			var ids []string
+			var truncated bool
+			var err error
+			if members, ok := p.embeddedMembers[groupID]; ok {
+				ids, truncated = p.appendMemberIDs(nil, groupID, members, warnings)
+			} else {
+				ids, truncated, err = p.getGroupMemberIDs(ctx, groupID, warnings)
+			}
+			var apiErr *apiError
+			if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+				// the group was deleted after it was listed
+				logger.Warn().Str("group_id", groupID).Msg("group not found, skipping")
+				warnings.add(directory.WarningCodeGroupNotFound, groupID, "group %s was not found, it may have been deleted during the sync", groupID)
+				delete(p.groups, groupID)
+				delete(p.usersLinks, groupID)
+				groups = p.knownGroups()
+				continue
+			} else if err != nil {
+				return onError(err)
+			}
+			if truncated {
+				truncatedGroupIDs[groupID] = struct{}{}
+			}
+			// groups with a page which couldn't be decoded are also incomplete, but have their own warning
+			if truncated && p.cfg.maxMembersPerGroup > 0 && len(ids) >= p.cfg.maxMembersPerGroup {
+				logger.Warn().Str("group_id", groupID).Int("max_members", p.cfg.maxMembersPerGroup).Msg("group members truncated")
+				warnings.add(directory.WarningCodeGroupTruncated, groupID,
+					"group %s has more than %d members, remaining members were skipped", groupID, p.cfg.maxMembersPerGroup)
+			}
+			groupIDToMemberIDs[groupID] = ids
+		}
+	}
+
+	var deprovisionedUserIDs []string
+	if incremental {
+		deprovisionedUserIDs, err = p.mergeUpdatedUsers(ctx, *usersLastUpdated, groupIDToMemberIDs)
+		if err != nil {
+			return onError(err)
+		}
+	}
+	if p.cfg.incrementalUsers || len(p.cfg.priorityGroups) > 0 {
+		p.saveGroupMemberIDs(groupIDToMemberIDs, truncatedGroupIDs)
+	}
+	if p.cfg.incrementalUsers {
+		p.usersLastUpdated = &syncStarted
+	}
+
+	if p.cfg.expandGroupRules && p.includeMembershipType(MembershipTypeRule) {
+		rules, err := p.getGroupRules(ctx, warnings)
+		if err != nil {
+			return onError(err)
+		}
+		expandGroupRules(groupIDToMemberIDs, rules)
+	}
+
+	if p.cfg.excludeGuests && p.cfg.guestGroupID != "" {
+		guestIDs, err := p.getGuestIDs(ctx)
+		if err != nil {
+			return onError(err)
+		}
+		excludeMembers(groupIDToMemberIDs, guestIDs)
+	}
+
+	if !p.cfg.expandStats {
+		// truncated groups have more members than were retrieved, so their count is unknown
+		for groupID, ids := range groupIDToMemberIDs {
+			group, ok := p.groups[groupID]
+			if _, truncated := truncatedGroupIDs[groupID]; ok && !truncated {
+				group.MemberCount = int64(len(ids))
+			}
+		}
+	}
+
+	users := p.groupMembersToUsers(groupIDToMemberIDs)
+	if p.cfg.loginAlias {
+		p.pruneUserAliases(groupIDToMemberIDs)
+	}
+	p.pruneUserAttributes(groupIDToMemberIDs)
+	if p.cfg.resolveMFAStatus {
+		if err := p.resolveMFAStatus(ctx, users); err != nil {
+			return onError(err)
+		}
+	}
+	p.reconcile(report, users)
+	p.logMembershipChanges(users)
+	if p.cfg.reconcileUsers || p.cfg.membershipLogger != nil {
+		p.previousUsers = users
+	}
+	report.RemovedUserIDs = addRemovedUserIDs(report.RemovedUserIDs, deprovisionedUserIDs)
+	return mergeGroups(groups, users), users, nil
+}
+
+// RefreshUser fetches the groups of a single user, without performing a full sync.
+// https://developer.okta.com/docs/reference/api/users/#get-user-s-groups
+func (p *Provider) RefreshUser(ctx context.Context, userID string) (*directory.User, error) {
+	user, err := p.refreshUser(ctx, userID)
+	return user, p.redact(err)
+}
+
+func (p *Provider) refreshUser(ctx context.Context, userID string) (*directory.User, error) {
+	if !p.cfg.hasCredentials() {
+		return nil, fmt.Errorf("okta: service account not defined")
+	}
+	if p.cfg.providerURL == nil {
+		return nil, fmt.Errorf("okta: provider url not defined")
+	}
+
+	userGroups, err := p.getUserGroups(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	groupIDs := make([]string, 0, len(userGroups))
+	for _, group := range userGroups {
+		groupIDs = append(groupIDs, p.newGroup(group.id, group.name, group.groupType).Id)
 	}
+
+	return &directory.User{
+		Id:       p.getUserID(userID),
+		Source:   Name,
+		GroupIds: sortedUnique(groupIDs),
+	}, nil
 }
 
-// UserGroups fetches the groups of which the user is a member
+// IsMember checks whether a user is currently a member of a group, by either its Okta or directory id,
+// without performing a full sync. Users which don't exist aren't members of any group.
 // https://developer.okta.com/docs/reference/api/users/#get-user-s-groups
-func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
-	if p.cfg.serviceAccount == nil {
-		return nil, nil, fmt.Errorf("okta: service account not defined")
+func (p *Provider) IsMember(ctx context.Context, userID, groupID string) (bool, error) {
+	isMember, err := p.isMember(ctx, userID, groupID)
+	return isMember, p.redact(err)
+}
+
+func (p *Provider) isMember(ctx context.Context, userID, groupID string) (bool, error) {
+	if !p.cfg.hasCredentials() {
+		return false, fmt.Errorf("okta: service account not defined")
+	}
+	if p.cfg.providerURL == nil {
+		return false, fmt.Errorf("okta: provider url not defined")
+	}
+
+	userGroups, err := p.getUserGroups(ctx, userID)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	for _, group := range userGroups {
+		if group.id == groupID || p.newGroup(group.id, group.name, group.groupType).Id == groupID {
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	p.log.Info().Msg("getting user groups")
+// GroupMembers fetches the members of a single group by its Okta id, without performing a full sync, such
+// as for an admin drill-down. The same member options as UserGroups apply, so members beyond the max
+// members per group are omitted. The users only have their ids, aliases and attributes set.
+// https://developer.okta.com/docs/reference/api/groups/#list-group-members
+func (p *Provider) GroupMembers(ctx context.Context, groupID string) ([]*directory.User, error) {
+	users, err := p.groupMembers(ctx, groupID)
+	return users, p.redact(err)
+}
 
+func (p *Provider) groupMembers(ctx context.Context, groupID string) ([]*directory.User, error) {
+	if !p.cfg.hasCredentials() {
+		return nil, fmt.Errorf("okta: service account not defined")
+	}
 	if p.cfg.providerURL == nil {
-		return nil, nil, fmt.Errorf("okta: provider url not defined")
+		return nil, fmt.Errorf("okta: provider url not defined")
 	}
 
-	groups, err := p.getGroups(ctx)
+	ids, _, err := p.getGroupMemberIDs(ctx, groupID, newSyncWarnings())
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	users := make([]*directory.User, 0, len(ids))
+	for _, id := range sortedUnique(ids) {
+		users = append(users, &directory.User{
+			Id:         p.getUserID(id),
+			Source:     Name,
+			Attributes: p.getUserAttributes(id),
+			Aliases:    p.getUserAliases(id),
+		})
 	}
+	return users, nil
+}
 
+// groupMembersToUsers converts a map of Okta group ids to member ids into directory users.
+func (p *Provider) groupMembersToUsers(groupIDToMemberIDs map[string][]string) []*directory.User {
 	userIDToGroups := map[string][]string{}
-	for _, group := range groups {
-		ids, err := p.getGroupMemberIDs(ctx, group.Id)
-		if err != nil {
-			return nil, nil, err
+	for groupID, ids := range groupIDToMemberIDs {
+		if group, ok := p.groups[groupID]; ok {
+			groupID = group.Id
 		}
 		for _, id := range ids {
-			userIDToGroups[id] = append(userIDToGroups[id], group.Id)
+			userIDToGroups[id] = append(userIDToGroups[id], groupID)
 		}
 	}
 
 	var users []*directory.User
 	for userID, groups := range userIDToGroups {
-		sort.Strings(groups)
 		users = append(users, &directory.User{
-			Id:       databroker.GetUserID(Name, userID),
-			GroupIds: groups,
+			Id:         p.getUserID(userID),
+			Source:     Name,
+			GroupIds:   sortedUnique(groups),
+			Attributes: p.getUserAttributes(userID),
+			Aliases:    p.getUserAliases(userID),
 		})
 	}
 	sort.Slice(users, func(i, j int) bool {
 		return users[i].Id < users[j].Id
 	})
-	return groups, users, nil
+	return users
+}
+
+// getUserID returns the directory user id of an Okta user id, transformed by the id pipeline option.
+func (p *Provider) getUserID(userID string) string {
+	return databroker.GetUserID(Name, directory.ApplyIDTransforms(userID, p.cfg.idPipeline...))
+}
+
+// SyncReport returns the report of the most recent sync.
+func (p *Provider) SyncReport() *directory.SyncReport {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.report
+}
+
+func (p *Provider) setSyncReport(report *directory.SyncReport) {
+	report.EndTime = time.Now()
+
+	p.mu.Lock()
+	report.Pages, p.pageStats = p.pageStats, nil
+	p.report = report
+	p.mu.Unlock()
+}
+
+// recordPage records a page of n results fetched from an endpoint, for the sync report.
+func (p *Provider) recordPage(endpoint string, n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pageStats == nil {
+		p.pageStats = make(map[string]directory.PageStats)
+	}
+	stats := p.pageStats[endpoint]
+	stats.Pages++
+	stats.Items += n
+	p.pageStats[endpoint] = stats
+}
+
+func (p *Provider) resetPageStats() {
+	p.mu.Lock()
+	p.pageStats = nil
+	p.mu.Unlock()
+}
+
+// Close stops watching the group allowlist file, if any, and closes idle connections to Okta. When the drain
+// timeout option is set, syncs in progress stop fetching group members and return once their requests in
+// flight are drained. The provider can still be used, and later syncs are unaffected, but the allowlist
+// file is then read by every sync.
+func (p *Provider) Close() error {
+	p.closingMu.Lock()
+	close(p.closing)
+	p.closing = make(chan struct{})
+	p.closingMu.Unlock()
+	p.cfg.httpClient.CloseIdleConnections()
+	if p.allowlist == nil {
+		return nil
+	}
+	return p.allowlist.close()
+}
+
+// Name returns the provider name.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// Verify checks that the provider is configured and that the Okta API is reachable with the service account.
+func (p *Provider) Verify(ctx context.Context) error {
+	if !p.cfg.hasCredentials() {
+		return fmt.Errorf("okta: service account not defined")
+	}
+	if p.cfg.providerURL == nil {
+		return fmt.Errorf("okta: provider url not defined")
+	}
+
+	groupURL := p.cfg.providerURL.ResolveReference(&url.URL{
+		Path:     "/api/v1/groups",
+		RawQuery: "limit=1",
+	}).String()
+	for attempt := 1; ; attempt++ {
+		var out []json.RawMessage
+		// the probe is retried below, with the verify retries
+		_, err := p.apiGet(withoutStatusRetries(ctx), groupURL, &out)
+		if err == nil {
+			return nil
+		}
+
+		delay := defaultVerifyRetryDelay
+		if p.cfg.backoff != nil {
+			delay = p.cfg.backoff.NextDelay(attempt)
+		}
+		if attempt > p.cfg.verifyRetries || !p.isTransientError(err) || !directory.CanRetry(ctx, delay, p.cfg.minAttemptTime) {
+			return p.redact(fmt.Errorf("okta: error verifying api access: %w", err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		metrics.RecordDirectoryRetry(ctx, Name, apiEndpoint(groupURL))
+	}
+}
+
+// defaultRetriableStatuses are the statuses of transient failures of Okta or of a proxy in front of it.
+var defaultRetriableStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// isTransientError reports whether a request failed because of a network error or a retriable status,
+// which may not happen again, rather than because of the request itself.
+func (p *Provider) isTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errResponseTooLarge) {
+		return false
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return p.isRetriableStatus(apiErr.StatusCode)
+	}
+	var decodeErr *decodeError
+	return !errors.As(err, &decodeErr)
+}
+
+type noStatusRetriesKey struct{}
+
+// withoutStatusRetries returns a context whose requests aren't retried when they have a retriable status.
+func withoutStatusRetries(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noStatusRetriesKey{}, true)
+}
+
+// isRetriableStatus reports whether statusCode is one of the default or configured retriable statuses.
+func (p *Provider) isRetriableStatus(statusCode int) bool {
+	for _, statuses := range [][]int{defaultRetriableStatuses, p.cfg.retriableStatuses} {
+		for _, status := range statuses {
+			if status == statusCode {
+				return true
+			}
+		}
+	}
+	return false
 }
 
-func (p *Provider) getGroups(ctx context.Context) ([]*directory.Group, error) {
+func (p *Provider) getGroups(ctx context.Context, warnings *syncWarnings) ([]*directory.Group, error) {
 	u := &url.URL{Path: "/api/v1/groups"}
 	q := u.Query()
-	q.Set("limit", strconv.Itoa(p.cfg.batchSize))
-	if p.lastUpdated != nil {
-		q.Set("filter", fmt.Sprintf(`lastUpdated gt "%[1]s" or lastMembershipUpdated gt "%[1]s"`, p.lastUpdated.UTC().Format(filterDateFormat)))
-	} else {
+	q.Set("limit", strconv.Itoa(p.batchSize("groups", maxGroupsBatchSize)))
+	if p.cfg.expandStats {
+		q.Set("expand", "stats")
+	}
+	if p.cfg.sortBy != "" {
+		q.Set("sortBy", p.cfg.sortBy)
+	}
+	if p.cfg.groupSearchQuery != "" {
+		q.Set("q", p.cfg.groupSearchQuery)
+	}
+	if filter := p.groupsFilter(); filter != "" {
+		q.Set("filter", filter)
+	}
+	if p.lastUpdated == nil {
 		now := time.Now()
 		p.lastUpdated = &now
 	}
 	u.RawQuery = q.Encode()
 
+	// only pages seen during this listing are kept, so stale listing urls don't accumulate
+	p.pages.reset()
+	p.listedGroups = make(map[string]struct{})
+	p.embeddedMembers = make(map[string][]groupMember)
+
 	groupURL := p.cfg.providerURL.ResolveReference(u).String()
 	for groupURL != "" {
 		var out []struct {
-			ID      string `json:"id"`
-			Profile struct {
-				Name string `json:"name"`
-			} `json:"profile"`
-			LastUpdated           string `json:"lastUpdated"`
-			LastMembershipUpdated string `json:"lastMembershipUpdated"`
-		}
-		hdrs, err := p.apiGet(ctx, groupURL, &out)
+			ID                    string                 `json:"id"`
+			Type                  string                 `json:"type"`
+			Profile               map[string]interface{} `json:"profile"`
+			LastUpdated           string                 `json:"lastUpdated"`
+			LastMembershipUpdated string                 `json:"lastMembershipUpdated"`
+			Links                 struct {
+				Users struct {
+					Href string `json:"href"`
+				} `json:"users"`
+			} `json:"_links"`
+			Embedded struct {
+				Stats struct {
+					UsersCount int64 `json:"usersCount"`
+				} `json:"stats"`
+				Users *[]groupMember `json:"users"`
+			} `json:"_embedded"`
+		}
+		hdrs, err := p.apiGetCached(ctx, groupURL, &out)
 		if err != nil {
 			return nil, fmt.Errorf("okta: error querying for groups: %w", err)
 		}
+		p.recordPage("groups", len(out))
 
 		for _, el := range out {
+			if el.ID == "" {
+				warnings.add(directory.WarningCodeMalformedRecord, "", "a group without an id was skipped")
+				continue
+			}
 			lu, _ := time.Parse(el.LastUpdated, filterDateFormat)
 			lmu, _ := time.Parse(el.LastMembershipUpdated, filterDateFormat)
 			if lu.After(*p.lastUpdated) {
@@ -190,85 +1401,606 @@ func (p *Provider) getGroups(ctx context.Context) ([]*directory.Group, error) {
 			if lmu.After(*p.lastUpdated) {
 				p.lastUpdated = &lmu
 			}
-			p.groups[el.ID] = &directory.Group{
-				Id:   el.ID,
-				Name: el.Profile.Name,
+			group := p.newGroup(el.ID, p.getProfileField(el.Profile, ProfileFieldName), el.Type)
+			if p.allowlist != nil && !p.allowlist.allowed(el.ID, group.Id) {
+				continue
+			}
+			group.Attributes = p.getGroupAttributes(el.Profile)
+			if p.cfg.expandStats {
+				group.MemberCount = el.Embedded.Stats.UsersCount
+			}
+			p.groups[el.ID] = group
+			p.listedGroups[el.ID] = struct{}{}
+			if p.cfg.useEmbeddedMembers && el.Embedded.Users != nil {
+				p.embeddedMembers[el.ID] = *el.Embedded.Users
+			}
+			if el.Links.Users.Href != "" {
+				p.usersLinks[el.ID] = el.Links.Users.Href
 			}
 		}
 		groupURL = getNextLink(hdrs)
 	}
 
+	return p.knownGroups(), nil
+}
+
+// groupsFilter returns the filter of the group listing: the group filter option and, for incremental
+// listings, the groups updated since the previous sync. Okta rejects `q` with `filter`, so listings with
+// the group search query option are never incremental.
+func (p *Provider) groupsFilter() string {
+	var filters []string
+	if p.cfg.groupFilter != "" {
+		filters = append(filters, p.cfg.groupFilter)
+	}
+	if p.lastUpdated != nil && p.cfg.groupSearchQuery == "" {
+		filters = append(filters, fmt.Sprintf(`lastUpdated gt "%[1]s" or lastMembershipUpdated gt "%[1]s"`,
+			p.lastUpdated.UTC().Format(filterDateFormat)))
+	}
+	if len(filters) < 2 {
+		return strings.Join(filters, "")
+	}
+	return "(" + strings.Join(filters, ") and (") + ")"
+}
+
+// newGroup creates a directory group identified by the configured group id field. The other identifier is
+// kept as an alternative id.
+func (p *Provider) newGroup(id, name, groupType string) *directory.Group {
+	if p.cfg.caseInsensitiveGroups {
+		name = strings.ToLower(name)
+	}
+	if p.cfg.groupIDField == GroupIDFieldName {
+		groupID := name
+		if p.cfg.typeNamespacedGroups && groupType != "" {
+			groupID = groupType + ":" + name
+		}
+		return &directory.Group{
+			Id:     groupID,
+			Name:   name,
+			AltIds: []string{id},
+		}
+	}
+	return &directory.Group{
+		Id:     id,
+		Name:   name,
+		AltIds: []string{name},
+	}
+}
+
+// getGroupAttributes returns the configured group attributes found in an Okta group profile.
+func (p *Provider) getGroupAttributes(profile map[string]interface{}) map[string]string {
+	attributes := make(map[string]string, len(p.cfg.groupAttributes))
+	for _, name := range p.cfg.groupAttributes {
+		p.setProfileAttribute(attributes, name, profile[name])
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return attributes
+}
+
+func (p *Provider) knownGroups() []*directory.Group {
 	groups := make([]*directory.Group, 0, len(p.groups))
 	for _, dg := range p.groups {
 		groups = append(groups, dg)
 	}
-	return groups, nil
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	return groups
 }
 
-func (p *Provider) getGroupMemberIDs(ctx context.Context, groupID string) ([]string, error) {
-	var emails []string
+// getGroupMemberIDs returns the ids of the members of a group. If the group has more members than the
+// max members per group option, only that many are returned and truncated is true. Members which are
+// skipped or whose login differs from their email, if login mismatches are reported, are added to
+// warnings.
+//
+// Concurrent calls for the same group share a single fetch, which uses the context of the first call.
+func (p *Provider) getGroupMemberIDs(ctx context.Context, groupID string, warnings *syncWarnings) (ids []string, truncated bool, err error) {
+	type result struct {
+		ids       []string
+		truncated bool
+		warnings  *syncWarnings
+	}
+	res, err, _ := p.memberFetches.Do(groupID, func() (interface{}, error) {
+		fetchWarnings := newSyncWarnings()
+		ids, truncated, err := p.fetchGroupMemberIDs(ctx, groupID, fetchWarnings)
+		return &result{ids: ids, truncated: truncated, warnings: fetchWarnings}, err
+	})
+	shared := res.(*result)
+	warnings.merge(shared.warnings)
+	if err != nil {
+		return nil, false, err
+	}
+	// the ids are shared with the other callers, so they get a copy they can modify
+	return append([]string(nil), shared.ids...), shared.truncated, nil
+}
 
-	usersURL := p.cfg.providerURL.ResolveReference(&url.URL{
-		Path:     fmt.Sprintf("/api/v1/groups/%s/users", groupID),
-		RawQuery: fmt.Sprintf("limit=%d", p.cfg.batchSize),
-	}).String()
+func (p *Provider) fetchGroupMemberIDs(ctx context.Context, groupID string, warnings *syncWarnings) (ids []string, truncated bool, err error) {
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(p.batchSize("group users", maxGroupUsersBatchSize)))
+	if p.cfg.activeUsersOnly {
+		q.Set("filter", activeUserFilter)
+	}
+	usersURL, err := p.getGroupUsersURL(groupID, q)
+	if err != nil {
+		return nil, false, err
+	}
 	for usersURL != "" {
-		var out []struct {
-			ID string `json:"id"`
-		}
+		var out groupMemberPage
 		hdrs, err := p.apiGet(ctx, usersURL, &out)
+		var decodeErr *decodeError
+		if errors.As(err, &decodeErr) && p.cfg.allowPartialResults {
+			metrics.RecordDirectoryRetry(ctx, Name, apiEndpoint(usersURL))
+			out = nil
+			hdrs, err = p.apiGet(ctx, usersURL, &out)
+			if errors.As(err, &decodeErr) {
+				p.log.Warn().Err(p.redact(err)).Str("group_id", groupID).Msg("group members page could not be decoded, skipping remaining members")
+				warnings.add(directory.WarningCodeGroupIncomplete, groupID,
+					"a page of the members of group %s could not be decoded, remaining members were skipped", groupID)
+				return ids, true, nil
+			}
+		}
 		if err != nil {
-			return nil, fmt.Errorf("okta: error querying for groups: %w", err)
+			return nil, false, fmt.Errorf("okta: error querying for groups: %w", err)
 		}
+		p.recordPage("group users", len(out))
 
-		for _, el := range out {
-			emails = append(emails, el.ID)
+		ids, truncated = p.appendMemberIDs(ids, groupID, out, warnings)
+		if truncated {
+			return ids, true, nil
 		}
 
 		usersURL = getNextLink(hdrs)
 	}
 
-	return emails, nil
+	return ids, false, nil
+}
+
+// getGuestIDs returns the ids of every member of the guest group. Unlike the members of synced groups,
+// they aren't filtered or capped, since a guest missing from the list wouldn't be excluded.
+func (p *Provider) getGuestIDs(ctx context.Context) ([]string, error) {
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/v1/groups/%s/users", p.cfg.guestGroupID),
+	}
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.batchSize("group users", maxGroupUsersBatchSize)))
+	u.RawQuery = q.Encode()
+
+	var ids []string
+	usersURL := p.cfg.providerURL.ResolveReference(u).String()
+	for usersURL != "" {
+		var out groupMemberPage
+		hdrs, err := p.apiGet(ctx, usersURL, &out)
+		if err != nil {
+			return nil, fmt.Errorf("okta: error querying for guests: %w", err)
+		}
+		for _, el := range out {
+			if el.ID != "" {
+				ids = append(ids, el.ID)
+			}
+		}
+		usersURL = getNextLink(hdrs)
+	}
+	return ids, nil
+}
+
+// A groupMember is a member of an Okta group.
+type groupMember struct {
+	ID             string                 `json:"id"`
+	Status         string                 `json:"status"`
+	MembershipType string                 `json:"membershipType"`
+	Profile        map[string]interface{} `json:"profile"`
+}
+
+// appendMemberIDs appends the ids of the members of a group which aren't excluded by the options to ids.
+// If the max members per group is reached, truncated is true and the remaining members are skipped.
+func (p *Provider) appendMemberIDs(ids []string, groupID string, members []groupMember, warnings *syncWarnings) (_ []string, truncated bool) {
+	for _, el := range members {
+		if el.ID == "" {
+			warnings.add(directory.WarningCodeMalformedRecord, groupID, "a member of group %s without an id was skipped", groupID)
+			continue
+		}
+		if p.cfg.activeUsersOnly && el.Status != "" && el.Status != userStatusActive {
+			continue
+		}
+		if !p.includeMembershipType(el.MembershipType) {
+			continue
+		}
+		if p.cfg.excludeGuests && p.cfg.guestPredicate != nil && p.cfg.guestPredicate(el.Profile) {
+			continue
+		}
+		if p.cfg.maxMembersPerGroup > 0 && len(ids) >= p.cfg.maxMembersPerGroup {
+			return ids, true
+		}
+		if p.cfg.reportLoginMismatch {
+			p.checkLoginEmail(warnings, el.ID, el.Profile)
+		}
+		if p.cfg.loginAlias {
+			p.setUserAliases(el.ID, el.Profile)
+		}
+		p.setUserAttributes(el.ID, el.Profile)
+		ids = append(ids, el.ID)
+	}
+	return ids, false
+}
+
+// getGroupUsersURL returns the URL used to list the members of a group with the given query parameters.
+func (p *Provider) getGroupUsersURL(groupID string, q url.Values) (string, error) {
+	u := &url.URL{
+		Path: fmt.Sprintf("/api/v1/groups/%s/users", groupID),
+	}
+	if href, ok := p.usersLinks[groupID]; ok && p.cfg.followServerLinks {
+		link, err := url.Parse(href)
+		if err != nil {
+			return "", fmt.Errorf("okta: invalid users link for group %s: %w", groupID, err)
+		}
+		// the service account credentials are sent with the request, so only links to the provider url are
+		// followed
+		if resolved := p.cfg.providerURL.ResolveReference(link); resolved.Scheme != p.cfg.providerURL.Scheme ||
+			resolved.Host != p.cfg.providerURL.Host {
+			p.log.Warn().Str("group_id", groupID).Str("users_link_host", resolved.Host).
+				Msg("ignoring users link to a host other than the provider url")
+		} else {
+			u = link
+			linkQuery := u.Query()
+			for k, vs := range q {
+				linkQuery[k] = vs
+			}
+			q = linkQuery
+		}
+	}
+	u.RawQuery = q.Encode()
+	return p.cfg.providerURL.ResolveReference(u).String(), nil
+}
+
+func (p *Provider) includeMembershipType(membershipType string) bool {
+	if len(p.cfg.membershipTypes) == 0 {
+		return true
+	}
+	if membershipType == "" {
+		membershipType = MembershipTypeDirect
+	}
+	for _, t := range p.cfg.membershipTypes {
+		if strings.EqualFold(t, membershipType) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGuestUserType is the default guest predicate. It matches users whose profile userType is "guest".
+func isGuestUserType(profile map[string]interface{}) bool {
+	userType, _ := profile["userType"].(string)
+	return strings.EqualFold(userType, "guest")
+}
+
+// getProfileField returns the string value of a canonical field in an Okta profile, read from the key it
+// is mapped to.
+func (p *Provider) getProfileField(profile map[string]interface{}, field string) string {
+	key := field
+	if mapped, ok := p.cfg.profileFieldMap[field]; ok {
+		key = mapped
+	}
+	value, _ := profile[key].(string)
+	return value
+}
+
+// setUserAliases keeps the login and email of a user's profile, other than the user id, as their aliases.
+func (p *Provider) setUserAliases(userID string, profile map[string]interface{}) {
+	var aliases []string
+	for _, field := range []string{ProfileFieldLogin, ProfileFieldEmail} {
+		if value := p.getProfileField(profile, field); value != "" && value != userID {
+			aliases = append(aliases, value)
+		}
+	}
+	aliases = sortedUnique(aliases)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.userAliases == nil {
+		p.userAliases = make(map[string][]string)
+	}
+	p.userAliases[userID] = aliases
+}
+
+// pruneUserAliases forgets the aliases of users which are no longer members of any group.
+func (p *Provider) pruneUserAliases(groupIDToMemberIDs map[string][]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	userAliases := make(map[string][]string, len(p.userAliases))
+	for _, ids := range groupIDToMemberIDs {
+		for _, id := range ids {
+			if aliases, ok := p.userAliases[id]; ok {
+				userAliases[id] = aliases
+			}
+		}
+	}
+	p.userAliases = userAliases
+}
+
+// getUserAliases returns the aliases of a user, if login alias is enabled.
+func (p *Provider) getUserAliases(userID string) []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if aliases := p.userAliases[userID]; len(aliases) > 0 {
+		return aliases
+	}
+	return nil
+}
+
+// checkLoginEmail adds a warning if the login in the Okta profile differs from its email.
+func (p *Provider) checkLoginEmail(warnings *syncWarnings, userID string, profile map[string]interface{}) {
+	login := p.getProfileField(profile, ProfileFieldLogin)
+	email := p.getProfileField(profile, ProfileFieldEmail)
+	if login == "" || email == "" || strings.EqualFold(login, email) {
+		return
+	}
+	warnings.add(directory.WarningCodeLoginEmailMismatch, userID, "user %s has login %s which differs from email %s", userID, login, email)
+}
+
+// batchSize returns the batch size option clamped to the maximum limit of an endpoint. A warning is logged
+// the first time the batch size of an endpoint is clamped.
+func (p *Provider) batchSize(endpoint string, max int) int {
+	if p.cfg.batchSize <= max {
+		return p.cfg.batchSize
+	}
+
+	p.mu.Lock()
+	_, warned := p.clampedBatchSizes[endpoint]
+	if p.clampedBatchSizes == nil {
+		p.clampedBatchSizes = make(map[string]struct{})
+	}
+	p.clampedBatchSizes[endpoint] = struct{}{}
+	p.mu.Unlock()
+
+	if !warned {
+		p.log.Warn().
+			Str("endpoint", endpoint).
+			Int("batch_size", p.cfg.batchSize).
+			Int("max_batch_size", max).
+			Msg("batch size exceeds the endpoint maximum, clamping")
+	}
+	return max
+}
+
+// excludeMembers removes the given member ids from every group.
+func excludeMembers(groupIDToMemberIDs map[string][]string, excludedIDs []string) {
+	excluded := make(map[string]struct{}, len(excludedIDs))
+	for _, id := range excludedIDs {
+		excluded[id] = struct{}{}
+	}
+	for groupID, ids := range groupIDToMemberIDs {
+		var filtered []string
+		for _, id := range ids {
+			if _, ok := excluded[id]; !ok {
+				filtered = append(filtered, id)
+			}
+		}
+		groupIDToMemberIDs[groupID] = filtered
+	}
 }
 
 func (p *Provider) apiGet(ctx context.Context, uri string, out interface{}) (http.Header, error) {
+	hdrs, _, err := p.apiGetIfNoneMatch(ctx, uri, "", out)
+	return hdrs, err
+}
+
+// apiGetIfNoneMatch is like apiGet, but if etag is not empty it is sent in an If-None-Match header. When
+// Okta responds with 304 Not Modified, notModified is true and out is left unchanged.
+func (p *Provider) apiGetIfNoneMatch(ctx context.Context, uri, etag string, out interface{}) (hdrs http.Header, notModified bool, err error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", uri, nil)
 	if err != nil {
-		return nil, fmt.Errorf("okta: failed to create HTTP request: %w", err)
+		return nil, false, fmt.Errorf("okta: failed to create HTTP request: %w", err)
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "SSWS "+p.cfg.serviceAccount.APIKey)
+	if p.cfg.tokenSource != nil {
+		token, err := p.cfg.tokenSource.Token()
+		if err != nil {
+			return nil, false, fmt.Errorf("okta: failed to retrieve token: %w", err)
+		}
+		token.SetAuthHeader(req)
+	} else {
+		req.Header.Set("Authorization", p.cfg.authScheme+" "+p.cfg.serviceAccount.APIKey)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
 
 	if err := p.limiter.Wait(ctx); err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	for {
+	statusRetries := 0
+	for attempt := 1; ; attempt++ {
+		if p.cfg.requestSigner != nil {
+			if err := p.cfg.requestSigner(req); err != nil {
+				return nil, false, fmt.Errorf("okta: failed to sign request: %w", err)
+			}
+		}
 		res, err := p.cfg.httpClient.Do(req)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		defer res.Body.Close()
 
 		if res.StatusCode == http.StatusTooManyRequests {
+			var backoff time.Duration
 			limitReset, err := strconv.ParseInt(res.Header.Get("X-Rate-Limit-Reset"), 10, 64)
 			if err == nil {
-				time.Sleep(time.Until(time.Unix(limitReset, 0)))
+				backoff = time.Until(time.Unix(limitReset, 0))
+			}
+			if p.cfg.backoff != nil {
+				if delay := p.cfg.backoff.NextDelay(attempt); delay > backoff {
+					backoff = delay
+				}
+			}
+			if !directory.CanRetry(ctx, backoff, p.cfg.minAttemptTime) {
+				buf, _ := p.readBody(res.Body)
+				return nil, false, &apiError{StatusCode: res.StatusCode, Body: string(buf), RequestID: res.Header.Get(requestIDHeader)}
 			}
+			// the deferred close only runs on return, so the connection is released before retrying
+			_ = res.Body.Close()
+			if backoff > 0 {
+				select {
+				case <-ctx.Done():
+					return nil, false, ctx.Err()
+				case <-time.After(backoff):
+				}
+			}
+			metrics.RecordDirectoryRetry(ctx, Name, apiEndpoint(uri))
 			continue
 		}
+		if p.isRetriableStatus(res.StatusCode) && statusRetries < maxStatusRetries && ctx.Value(noStatusRetriesKey{}) == nil {
+			delay := defaultStatusRetryDelay
+			if p.cfg.backoff != nil {
+				delay = p.cfg.backoff.NextDelay(attempt)
+			}
+			if directory.CanRetry(ctx, delay, p.cfg.minAttemptTime) {
+				statusRetries++
+				_ = res.Body.Close()
+				select {
+				case <-ctx.Done():
+					return nil, false, ctx.Err()
+				case <-time.After(delay):
+				}
+				metrics.RecordDirectoryRetry(ctx, Name, apiEndpoint(uri))
+				continue
+			}
+		}
+		if etag != "" && res.StatusCode == http.StatusNotModified {
+			return res.Header, true, nil
+		}
 		if res.StatusCode/100 != 2 {
-			buf, _ := ioutil.ReadAll(res.Body)
-			return nil, fmt.Errorf("okta: error query api status_code=%d: %s", res.StatusCode, string(buf))
+			buf, _ := p.readBody(res.Body)
+			return nil, false, &apiError{StatusCode: res.StatusCode, Body: string(buf), RequestID: res.Header.Get(requestIDHeader)}
+		}
+		requestID := res.Header.Get(requestIDHeader)
+		p.log.Debug().
+			Str("endpoint", apiEndpoint(uri)).
+			Str("okta_request_id", requestID).
+			Msg("received okta api response")
+		if stream, ok := out.(streamDecoder); ok && !p.cfg.cursorFromBody {
+			if err := p.decodeStream(res.Body, stream, res.StatusCode, requestID, apiEndpoint(uri)); err != nil {
+				return nil, false, err
+			}
+			return res.Header, false, nil
+		}
+		buf, err := p.readBody(res.Body)
+		if err != nil {
+			return nil, false, fmt.Errorf("okta: error reading response of %s request_id=%s: %w", apiEndpoint(uri), requestID, err)
+		}
+		if p.cfg.cursorFromBody {
+			hdrs, err := decodeBodyCursor(uri, res.Header, buf, out)
+			if err != nil {
+				return nil, false, newDecodeError(res.StatusCode, requestID, buf, err)
+			}
+			return hdrs, false, nil
+		}
+		if err := json.Unmarshal(buf, out); err != nil {
+			return nil, false, newDecodeError(res.StatusCode, requestID, buf, err)
 		}
-		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
-			return nil, err
+		return res.Header, false, nil
+	}
+}
+
+// errResponseTooLarge is returned when a response body exceeds the max response bytes option.
+var errResponseTooLarge = errors.New("okta: response body too large")
+
+// readBody reads a response body of up to the max response bytes option. If the body is larger, the bytes
+// read so far are returned with errResponseTooLarge.
+func (p *Provider) readBody(body io.Reader) ([]byte, error) {
+	buf, err := ioutil.ReadAll(io.LimitReader(body, p.cfg.maxResponseBytes+1))
+	if err != nil {
+		return buf, err
+	}
+	if int64(len(buf)) > p.cfg.maxResponseBytes {
+		return buf[:p.cfg.maxResponseBytes], fmt.Errorf("%w: more than %d bytes", errResponseTooLarge, p.cfg.maxResponseBytes)
+	}
+	return buf, nil
+}
+
+// redact masks the API key, and any other token-like substrings, in errors returned to callers.
+func (p *Provider) redact(err error) error {
+	var apiKey string
+	if p.cfg.serviceAccount != nil {
+		apiKey = p.cfg.serviceAccount.APIKey
+	}
+	return directory.Redact(err, apiKey)
+}
+
+// requestIDHeader is the header of the id Okta assigns to each request, which Okta support asks for.
+const requestIDHeader = "X-Okta-Request-Id"
+
+// An apiError is returned for Okta API responses with an unexpected status code.
+type apiError struct {
+	StatusCode int
+	Body       string
+	RequestID  string
+}
+
+func (err *apiError) Error() string {
+	if err.RequestID != "" {
+		return fmt.Sprintf("okta: error query api status_code=%d request_id=%s: %s", err.StatusCode, err.RequestID, err.Body)
+	}
+	return fmt.Sprintf("okta: error query api status_code=%d: %s", err.StatusCode, err.Body)
+}
+
+// maxDecodeErrorBodySize is the number of bytes of an undecodable response body included in its error.
+const maxDecodeErrorBodySize = 256
+
+// A decodeError is returned for Okta API responses whose body can't be decoded, such as an HTML error
+// page from a proxy. It includes the start of the body.
+type decodeError struct {
+	StatusCode int
+	RequestID  string
+	Body       string
+	Err        error
+}
+
+func newDecodeError(statusCode int, requestID string, body []byte, err error) *decodeError {
+	if len(body) > maxDecodeErrorBodySize {
+		body = body[:maxDecodeErrorBodySize]
+	}
+	return &decodeError{StatusCode: statusCode, RequestID: requestID, Body: string(body), Err: err}
+}
+
+func (err *decodeError) Error() string {
+	if err.RequestID != "" {
+		return fmt.Sprintf("okta: error decoding api response status_code=%d request_id=%s: %v: %q",
+			err.StatusCode, err.RequestID, err.Err, err.Body)
+	}
+	return fmt.Sprintf("okta: error decoding api response status_code=%d: %v: %q", err.StatusCode, err.Err, err.Body)
+}
+
+func (err *decodeError) Unwrap() error {
+	return err.Err
+}
+
+// apiPathSegments are the fixed path segments of the Okta API endpoints. Other segments are ids.
+var apiPathSegments = map[string]struct{}{
+	"api": {}, "v1": {}, "factors": {}, "groups": {}, "org": {}, "rules": {}, "users": {},
+}
+
+// apiEndpoint returns the endpoint of an Okta API url, with ids replaced by `{id}`, such as
+// `/api/v1/groups/{id}/users`. It is used to label metrics without a label per group or user.
+func apiEndpoint(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "unknown"
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, segment := range segments {
+		if _, ok := apiPathSegments[segment]; !ok {
+			segments[i] = "{id}"
 		}
-		return res.Header, nil
 	}
+	return "/" + strings.Join(segments, "/")
 }
 
+// getNextLink returns the url of the next page from the Link header of a listing response, or "" if it is
+// the last page. The cursor of the next page is opaque and is only ever taken from this url, never derived
+// from the ids of the records in the page.
 func getNextLink(hdrs http.Header) string {
 	for _, link := range linkheader.ParseMultiple(hdrs.Values("Link")) {
 		if link.Rel == "next" {
@@ -296,6 +2028,11 @@ func ParseServiceAccount(rawServiceAccount string) (*ServiceAccount, error) {
 		return nil, err
 	}
 
+	serviceAccount.APIKey, err = directory.ExpandEnv(serviceAccount.APIKey)
+	if err != nil {
+		return nil, fmt.Errorf("api_key: %w", err)
+	}
+
 	if serviceAccount.APIKey == "" {
 		return nil, fmt.Errorf("api_key is required")
 	}
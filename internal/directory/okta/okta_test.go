@@ -1,20 +1,44 @@
 package okta
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/tomnomnom/linkheader"
+	"go.opencensus.io/stats/view"
+	"golang.org/x/oauth2"
 
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/grpc/directory"
 )
 
@@ -49,6 +73,9 @@ func newMockOkta(srv *httptest.Server, userEmailToGroups map[string][]string) ht
 			if !lastUpdated && group == "user-updated" {
 				continue
 			}
+			if query := r.URL.Query().Get("q"); query != "" && !strings.HasPrefix(group, query) {
+				continue
+			}
 			groups = append(groups, group)
 		}
 		sort.Strings(groups)
@@ -104,6 +131,39 @@ func newMockOkta(srv *httptest.Server, userEmailToGroups map[string][]string) ht
 
 		_ = json.NewEncoder(w).Encode(result)
 	})
+	r.Get("/api/v1/users/{user}", func(w http.ResponseWriter, r *http.Request) {
+		user := chi.URLParam(r, "user")
+		if _, ok := userEmailToGroups[user]; !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(M{
+			"id": user,
+			"profile": M{
+				"email": user,
+				"login": user,
+			},
+		})
+	})
+	r.Get("/api/v1/users/{user}/groups", func(w http.ResponseWriter, r *http.Request) {
+		user := chi.URLParam(r, "user")
+		groups, ok := userEmailToGroups[user]
+		if !ok {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+
+		result := []M{}
+		for _, group := range groups {
+			result = append(result, M{
+				"id": group,
+				"profile": M{
+					"name": group + "-name",
+				},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	})
 	return r
 }
 
@@ -128,20 +188,115 @@ func TestProvider_UserGroups(t *testing.T) {
 	assert.Equal(t, []*directory.User{
 		{
 			Id:       "okta/a@example.com",
+			Source:   "okta",
 			GroupIds: []string{"admin", "user"},
 		},
 		{
 			Id:       "okta/b@example.com",
+			Source:   "okta",
 			GroupIds: []string{"test", "user"},
 		},
 		{
 			Id:       "okta/c@example.com",
+			Source:   "okta",
 			GroupIds: []string{"user"},
 		},
 	}, users)
 	assert.Len(t, groups, 3)
 }
 
+func TestProvider_RefreshUser(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+	)
+	user, err := p.RefreshUser(context.Background(), "a@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &directory.User{
+		Id:       "okta/a@example.com",
+		Source:   "okta",
+		GroupIds: []string{"admin", "user"},
+	}, user)
+
+	_, err = p.RefreshUser(context.Background(), "unknown@example.com")
+	assert.Error(t, err)
+}
+
+func TestProvider_IsMember(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "/api/v1/groups", r.URL.Path, "groups should not be listed")
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	for _, tc := range []struct {
+		userID, groupID string
+		expect          bool
+	}{
+		{"a@example.com", "admin", true},
+		{"a@example.com", "test", false},
+		{"b@example.com", "test", true},
+		{"unknown@example.com", "user", false},
+	} {
+		isMember, err := p.IsMember(context.Background(), tc.userID, tc.groupID)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, isMember, "%s in %s", tc.userID, tc.groupID)
+	}
+}
+
+func TestProvider_UserGroupsOnlyUsers(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEqual(t, "/api/v1/groups", r.URL.Path, "groups should not be listed")
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+		"c@example.com": {"user", "other"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithOnlyUsers([]string{"b@example.com", "a@example.com"}),
+	)
+	cursor, err := (&Cursor{LastUpdated: time.Now()}).MarshalBinary()
+	assert.NoError(t, err)
+	groups, users, err := p.UserGroups(directory.WithCursor(context.Background(), cursor))
+	assert.NoError(t, err)
+	assert.Nil(t, p.Cursor(), "syncing only some users should not resume from the cursor")
+	if assert.Len(t, groups, 3) {
+		assert.Equal(t, []string{"admin", "test", "user"}, []string{groups[0].Id, groups[1].Id, groups[2].Id})
+	}
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"test", "user"}},
+	}, users)
+}
+
 func TestProvider_UserGroupsQueryUpdated(t *testing.T) {
 	var mockOkta http.Handler
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -164,14 +319,17 @@ func TestProvider_UserGroupsQueryUpdated(t *testing.T) {
 	assert.Equal(t, []*directory.User{
 		{
 			Id:       "okta/a@example.com",
+			Source:   "okta",
 			GroupIds: []string{"admin", "user"},
 		},
 		{
 			Id:       "okta/b@example.com",
+			Source:   "okta",
 			GroupIds: []string{"test", "user"},
 		},
 		{
 			Id:       "okta/c@example.com",
+			Source:   "okta",
 			GroupIds: []string{"user"},
 		},
 	}, users)
@@ -182,24 +340,2344 @@ func TestProvider_UserGroupsQueryUpdated(t *testing.T) {
 	assert.Equal(t, []*directory.User{
 		{
 			Id:       "okta/a@example.com",
+			Source:   "okta",
 			GroupIds: []string{"admin", "user"},
 		},
 		{
 			Id:       "okta/b@example.com",
+			Source:   "okta",
 			GroupIds: []string{"test", "user"},
 		},
 		{
 			Id:       "okta/c@example.com",
+			Source:   "okta",
 			GroupIds: []string{"user"},
 		},
 		{
 			Id:       "okta/updated@example.com",
+			Source:   "okta",
 			GroupIds: []string{"user-updated"},
 		},
 	}, users)
 	assert.Len(t, groups, 4)
 }
 
+func TestProvider_UserGroupsIncrementalUsers(t *testing.T) {
+	var mu sync.Mutex
+	var updatedUsers []M
+	var memberRequests int
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/api/v1/users":
+			assert.Contains(t, r.URL.Query().Get("filter"), "lastUpdated gt ")
+			_ = json.NewEncoder(w).Encode(updatedUsers)
+			return
+		case strings.HasPrefix(r.URL.Path, "/api/v1/groups/") && strings.HasSuffix(r.URL.Path, "/users"):
+			memberRequests++
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	userEmailToGroups := map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+		"c@example.com": {"user"},
+	}
+	mockOkta = newMockOkta(srv, userEmailToGroups)
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithActiveUsersOnly(true),
+		WithIncrementalUsers(true),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"test", "user"}},
+		{Id: "okta/c@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+	assert.Equal(t, 3, memberRequests)
+
+	mu.Lock()
+	memberRequests = 0
+	userEmailToGroups["c@example.com"] = []string{"user", "admin"}
+	updatedUsers = []M{
+		{"id": "b@example.com", "status": "DEPROVISIONED"},
+		{"id": "c@example.com", "status": "ACTIVE"},
+	}
+	mu.Unlock()
+
+	groups, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/c@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+	}, users)
+	assert.Equal(t, 0, memberRequests, "the members of unchanged groups should not be listed again")
+}
+
+func TestProvider_UserGroupsIncrementalUsersTombstones(t *testing.T) {
+	var mu sync.Mutex
+	var deprovisioned []M
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.URL.Path == "/api/v1/users" {
+			// deprovisioned users are only listed when filtering by status
+			if strings.Contains(r.URL.Query().Get("filter"), `status eq "DEPROVISIONED"`) {
+				_ = json.NewEncoder(w).Encode(deprovisioned)
+				return
+			}
+			_ = json.NewEncoder(w).Encode([]M{})
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+		"b@example.com": {"user", "admin"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithIncrementalUsers(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Empty(t, p.SyncReport().RemovedUserIDs)
+
+	mu.Lock()
+	deprovisioned = []M{{"id": "b@example.com", "status": "DEPROVISIONED"}}
+	mu.Unlock()
+
+	_, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+	assert.Equal(t, []string{"okta/b@example.com"}, p.SyncReport().RemovedUserIDs)
+}
+
+func TestProvider_GetGroupMemberIDsCoalesced(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups/admin/users" {
+			atomic.AddInt32(&calls, 1)
+			<-release
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"admin"},
+		"b@example.com": {"admin"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ids, truncated, err := p.getGroupMemberIDs(context.Background(), "admin", newSyncWarnings())
+			assert.NoError(t, err)
+			assert.False(t, truncated)
+			assert.Equal(t, []string{"a@example.com", "b@example.com"}, ids)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "concurrent fetches of a group should share one request")
+}
+
+type rotatingTokenSource struct {
+	calls int32
+}
+
+func (src *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	n := atomic.AddInt32(&src.calls, 1)
+	return &oauth2.Token{
+		AccessToken: fmt.Sprintf("token-%d", n),
+		TokenType:   "Bearer",
+	}, nil
+}
+
+func TestProvider_UserGroupsTokenSource(t *testing.T) {
+	var mu sync.Mutex
+	var authorizations []string
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		r.Header.Set("Authorization", "SSWS APITOKEN")
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithTokenSource(new(rotatingTokenSource)),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+
+	// the group listing has two pages, then the members of the group are listed
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-2", "Bearer token-3"}, authorizations)
+
+	_, err = NewProvider(WithProviderURL(mustParseURL(srv.URL)), WithTokenSource(new(rotatingTokenSource)))
+	assert.NoError(t, err, "a token source should replace the service account")
+}
+
+func TestProvider_UserGroupsReturnPartialOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// cancel once the first page of groups has been received
+		if r.URL.Path == "/api/v1/groups" && r.URL.Query().Get("after") != "" {
+			cancel()
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithReturnPartialOnCancel(true),
+	)
+	groups, users, err := p.UserGroups(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin", Name: "admin-name", AltIds: []string{"admin-name"}},
+	}, groups)
+	assert.Empty(t, users)
+
+	t.Run("without option", func(t *testing.T) {
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+		)
+		_, _, err := p.UserGroups(ctx)
+		assert.True(t, errors.Is(err, context.Canceled))
+	})
+}
+
+func TestProvider_UserGroupsActiveUsersOnly(t *testing.T) {
+	honorFilter := true
+	var filters []string
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users") {
+			filter := r.URL.Query().Get("filter")
+			filters = append(filters, filter)
+
+			result := []M{{"id": "a@example.com", "status": "ACTIVE"}}
+			if !honorFilter || filter != `status eq "ACTIVE"` {
+				result = append(result, M{"id": "b@example.com", "status": "SUSPENDED"})
+			}
+			_ = json.NewEncoder(w).Encode(result)
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithActiveUsersOnly(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`status eq "ACTIVE"`}, filters)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+
+	t.Run("filter ignored", func(t *testing.T) {
+		honorFilter = false
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithActiveUsersOnly(true),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+		}, users)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		filters = nil
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []string{""}, filters)
+		assert.Len(t, users, 2)
+	})
+}
+
+func TestProvider_UserGroupsGroupIDField(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user"},
+	})
+
+	sortGroups := func(groups []*directory.Group) []*directory.Group {
+		sort.Slice(groups, func(i, j int) bool {
+			return groups[i].GetId() < groups[j].GetId()
+		})
+		return groups
+	}
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin", Name: "admin-name", AltIds: []string{"admin-name"}, MemberCount: 1},
+		{Id: "user", Name: "user-name", AltIds: []string{"user-name"}, MemberCount: 2},
+	}, sortGroups(groups))
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithGroupIDField(GroupIDFieldName),
+	)
+	groups, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin-name", Name: "admin-name", AltIds: []string{"admin"}, MemberCount: 1},
+		{Id: "user-name", Name: "user-name", AltIds: []string{"user"}, MemberCount: 2},
+	}, sortGroups(groups))
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin-name", "user-name"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"user-name"}},
+	}, users)
+}
+
+func TestProvider_UserGroupsMembershipTypes(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users") {
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "a@example.com", "membershipType": "DIRECT"},
+				{"id": "b@example.com", "membershipType": "RULE"},
+				{"id": "c@example.com"},
+			})
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMembershipTypes([]string{MembershipTypeDirect}),
+	)
+	_, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+		{Id: "okta/c@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMembershipTypes([]string{MembershipTypeRule}),
+	)
+	_, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+}
+
+func TestProvider_UserGroupsOpaqueCursors(t *testing.T) {
+	// group ids which look like the cursors of other pages, so following a cursor derived from the ids
+	// rather than the next link would list the wrong pages
+	pages := map[string]struct {
+		ids  []string
+		next string
+	}{
+		"":       {ids: []string{"page-2"}, next: "page-1"},
+		"page-1": {ids: []string{"page-3"}, next: "page-2"},
+		"page-2": {ids: []string{"page-1", "?after=page-3"}},
+		"page-3": {ids: []string{"wrong"}},
+	}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users") {
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "a@example.com", "profile": M{"email": "a@example.com"}},
+			})
+			return
+		}
+
+		page, ok := pages[r.URL.Query().Get("after")]
+		if !ok {
+			http.Error(w, "unknown cursor", http.StatusBadRequest)
+			return
+		}
+		if page.next != "" {
+			nextURL := mustParseURL(srv.URL).ResolveReference(r.URL)
+			q := nextURL.Query()
+			q.Set("after", page.next)
+			nextURL.RawQuery = q.Encode()
+			w.Header().Set("Link", linkheader.Link{URL: nextURL.String(), Rel: "next"}.String())
+		}
+		var out []M
+		for _, id := range page.ids {
+			out = append(out, M{"id": id, "profile": M{"name": id}})
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	var groupIDs []string
+	for _, group := range groups {
+		groupIDs = append(groupIDs, group.Id)
+	}
+	assert.ElementsMatch(t, []string{"page-2", "page-3", "page-1", "?after=page-3"}, groupIDs)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, []string{"?after=page-3", "page-1", "page-2", "page-3"}, users[0].GroupIds)
+	}
+}
+
+func TestProvider_UserGroupsPaginatedMembers(t *testing.T) {
+	const memberCount = 2345
+	memberIDs := make([]string, memberCount)
+	for i := range memberIDs {
+		memberIDs[i] = fmt.Sprintf("user%05d", i)
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{{
+				"id":      "everyone",
+				"profile": M{"name": "Everyone"},
+			}})
+		case "/api/v1/groups/everyone/users":
+			limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+			if !assert.NoError(t, err) {
+				return
+			}
+			start := sort.SearchStrings(memberIDs, r.URL.Query().Get("after"))
+			if after := r.URL.Query().Get("after"); after != "" {
+				start++
+			}
+			end := start + limit
+			if end > len(memberIDs) {
+				end = len(memberIDs)
+			}
+
+			var result []M
+			for _, id := range memberIDs[start:end] {
+				result = append(result, M{"id": id, "status": "ACTIVE"})
+			}
+			if end < len(memberIDs) {
+				nextURL := mustParseURL(srv.URL).ResolveReference(r.URL)
+				q := nextURL.Query()
+				q.Set("after", memberIDs[end-1])
+				nextURL.RawQuery = q.Encode()
+				w.Header().Set("Link", linkheader.Link{URL: nextURL.String(), Rel: "next"}.String())
+			}
+			_ = json.NewEncoder(w).Encode(result)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// the group users endpoint caps the batch size at 1000
+	expectMemberPages := map[int]int{200: 12, 1000: 3, memberCount: 3}
+	for _, batchSize := range []int{200, 1000, memberCount} {
+		t.Run(strconv.Itoa(batchSize), func(t *testing.T) {
+			p := New(
+				WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+				WithProviderURL(mustParseURL(srv.URL)),
+				WithQPS(1000),
+				WithBatchSize(batchSize),
+			)
+			groups, users, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+			if assert.Len(t, groups, 1) {
+				assert.Equal(t, int64(memberCount), groups[0].MemberCount)
+			}
+
+			pages := p.SyncReport().Pages
+			assert.Equal(t, directory.PageStats{Pages: 1, Items: 1}, pages["groups"])
+			assert.Equal(t, directory.PageStats{Pages: expectMemberPages[batchSize], Items: memberCount}, pages["group users"])
+			assert.InDelta(t, float64(memberCount)/float64(expectMemberPages[batchSize]), pages["group users"].AveragePageSize(), 0.001)
+
+			seen := map[string]int{}
+			for _, user := range users {
+				seen[user.Id]++
+			}
+			assert.Len(t, seen, memberCount, "every member should be synced")
+			for _, id := range memberIDs {
+				assert.Equal(t, 1, seen["okta/"+id], "member %s should be synced exactly once", id)
+			}
+		})
+	}
+}
+
+func TestProvider_UserGroupsMaxMembersPerGroup(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"everyone", "admin"},
+		"b@example.com": {"everyone"},
+		"c@example.com": {"everyone"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMaxMembersPerGroup(2),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "everyone"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"everyone"}},
+	}, users)
+	assert.Equal(t, []directory.Warning{{
+		Code:      directory.WarningCodeGroupTruncated,
+		Message:   "group everyone has more than 2 members, remaining members were skipped",
+		SubjectID: "everyone",
+	}}, p.SyncReport().Warnings)
+}
+
+func TestProvider_UserGroupsReportLoginEmailMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "admin", "profile": M{"name": "admin-name"}},
+				{"id": "user", "profile": M{"name": "user-name"}},
+			})
+		case "/api/v1/groups/admin/users", "/api/v1/groups/user/users":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "a", "profile": M{"login": "a@example.com", "email": "a@example.com"}},
+				{"id": "b", "profile": M{"login": "bob", "email": "b@example.com"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithReportLoginEmailMismatch(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b", Source: "okta", GroupIds: []string{"admin", "user"}},
+	}, users)
+	assert.Equal(t, []directory.Warning{{
+		Code:      directory.WarningCodeLoginEmailMismatch,
+		Message:   "user b has login bob which differs from email b@example.com",
+		SubjectID: "b",
+	}}, p.SyncReport().Warnings)
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, p.SyncReport().Warnings)
+}
+
+func TestProvider_UserGroupsProfileFieldMap(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "admin", "profile": M{"displayName": "Admins"}},
+			})
+		case "/api/v1/groups/admin/users":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "a", "profile": M{"login": "a@example.com", "email": "a@example.com", "workEmail": "a@corp.example.com"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithReportLoginEmailMismatch(true),
+		WithProfileFieldMap(map[string]string{
+			ProfileFieldEmail: "workEmail",
+			ProfileFieldName:  "displayName",
+		}),
+	)
+	groups, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin", Name: "Admins", AltIds: []string{"Admins"}, MemberCount: 1},
+	}, groups)
+	assert.Equal(t, []directory.Warning{{
+		Code:      directory.WarningCodeLoginEmailMismatch,
+		Message:   "user a has login a@example.com which differs from email a@corp.example.com",
+		SubjectID: "a",
+	}}, p.SyncReport().Warnings, "the email should be read from the mapped field")
+}
+
+func TestProvider_UserGroupsLoginAlias(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" {
+			_ = json.NewEncoder(w).Encode([]M{{"id": "eng", "profile": M{"name": "eng"}}})
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]M{
+			{"id": "00u1", "profile": M{"email": "a@example.com", "login": "alice"}},
+			{"id": "00u2", "profile": M{"email": "b@example.com", "login": "b@example.com"}},
+		})
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		loginAlias bool
+		expect     []*directory.User
+	}{
+		{false, []*directory.User{
+			{Id: "okta/00u1", Source: "okta", GroupIds: []string{"eng"}},
+			{Id: "okta/00u2", Source: "okta", GroupIds: []string{"eng"}},
+		}},
+		{true, []*directory.User{
+			{Id: "okta/00u1", Source: "okta", GroupIds: []string{"eng"}, Aliases: []string{"a@example.com", "alice"}},
+			{Id: "okta/00u2", Source: "okta", GroupIds: []string{"eng"}, Aliases: []string{"b@example.com"}},
+		}},
+	} {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithLoginAlias(tc.loginAlias),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, users, "login alias %t", tc.loginAlias)
+	}
+}
+
+func TestProvider_UserGroupsGroupAttributes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "admin", "profile": M{"name": "admin-name", "env": "prod", "team": "infra", "regions": []string{"us", "eu"}}},
+				{"id": "user", "profile": M{"name": "user-name", "env": "dev"}},
+				{"id": "test", "profile": M{"name": "test-name"}},
+			})
+		default:
+			_ = json.NewEncoder(w).Encode([]M{})
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithGroupAttributes([]string{"env", "team", "regions"}),
+	)
+	groups, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Id < groups[j].Id
+	})
+	assert.Equal(t, []*directory.Group{
+		{
+			Id:         "admin",
+			Name:       "admin-name",
+			AltIds:     []string{"admin-name"},
+			Attributes: map[string]string{"env": "prod", "team": "infra", "regions": `["us","eu"]`},
+		},
+		{Id: "test", Name: "test-name", AltIds: []string{"test-name"}},
+		{
+			Id:         "user",
+			Name:       "user-name",
+			AltIds:     []string{"user-name"},
+			Attributes: map[string]string{"env": "dev"},
+		},
+	}, groups)
+}
+
+func TestProvider_UserGroupsCaseInsensitiveGroups(t *testing.T) {
+	members := map[string][]string{
+		"00g1": {"a@example.com", "b@example.com"},
+		"00g2": {"b@example.com", "c@example.com"},
+		"00g3": {"a@example.com"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" {
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "00g1", "profile": M{"name": "Admins"}},
+				{"id": "00g2", "profile": M{"name": "admins"}},
+				{"id": "00g3", "profile": M{"name": "Users"}},
+			})
+			return
+		}
+		var out []M
+		for _, id := range members[strings.Split(r.URL.Path, "/")[4]] {
+			out = append(out, M{"id": id, "profile": M{"email": id}})
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithGroupIDField(GroupIDFieldName),
+		WithCaseInsensitiveGroups(true),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admins", Name: "admins", AltIds: []string{"00g1", "00g2"}, MemberCount: 3},
+		{Id: "users", Name: "users", AltIds: []string{"00g3"}, MemberCount: 1},
+	}, groups)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admins", "users"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"admins"}},
+		{Id: "okta/c@example.com", Source: "okta", GroupIds: []string{"admins"}},
+	}, users)
+}
+
+func TestProvider_UserGroupsTypeNamespacedGroupIDs(t *testing.T) {
+	members := map[string][]string{
+		"00g1": {"a@example.com"},
+		"00g2": {"b@example.com"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" {
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "00g1", "type": "OKTA_GROUP", "profile": M{"name": "engineering"}},
+				{"id": "00g2", "type": "APP_GROUP", "profile": M{"name": "engineering"}},
+			})
+			return
+		}
+		var out []M
+		for _, id := range members[strings.Split(r.URL.Path, "/")[4]] {
+			out = append(out, M{"id": id, "profile": M{"email": id}})
+		}
+		_ = json.NewEncoder(w).Encode(out)
+	}))
+	defer srv.Close()
+
+	t.Run("disabled", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithGroupIDField(GroupIDFieldName),
+		)
+		groups, _, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, groups, 1, "same-named groups should be merged")
+	})
+	t.Run("enabled", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithGroupIDField(GroupIDFieldName),
+			WithTypeNamespacedGroupIDs(true),
+		)
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.Group{
+			{Id: "APP_GROUP:engineering", Name: "engineering", AltIds: []string{"00g2"}, MemberCount: 1},
+			{Id: "OKTA_GROUP:engineering", Name: "engineering", AltIds: []string{"00g1"}, MemberCount: 1},
+		}, groups)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"OKTA_GROUP:engineering"}},
+			{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"APP_GROUP:engineering"}},
+		}, users)
+	})
+}
+
+func TestProvider_UserGroupsSortBy(t *testing.T) {
+	var mockOkta http.Handler
+	var sortBy []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" {
+			sortBy = append(sortBy, r.URL.Query().Get("sortBy"))
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithSortBy("profile.name"),
+	)
+	groups, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"profile.name", "profile.name", "profile.name", "profile.name"}, sortBy,
+		"every page should be requested with the sort field")
+	if assert.Len(t, groups, 3) {
+		assert.Equal(t, []string{"admin", "test", "user"}, []string{groups[0].Id, groups[1].Id, groups[2].Id})
+	}
+
+	sortBy = nil
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"", "", "", ""}, sortBy)
+}
+
+func TestProvider_UserGroupsBatchSizeClamp(t *testing.T) {
+	var mu sync.Mutex
+	limits := map[string]string{}
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint := "groups"
+		if strings.HasSuffix(r.URL.Path, "/users") {
+			endpoint = "group users"
+		}
+		mu.Lock()
+		limits[endpoint] = r.URL.Query().Get("limit")
+		mu.Unlock()
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+	})
+
+	var buf bytes.Buffer
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithBatchSize(5000),
+	)
+	p.log = zerolog.New(&buf)
+
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"groups":      "5000",
+		"group users": "1000",
+	}, limits)
+	assert.Equal(t, 1, strings.Count(buf.String(), "batch size exceeds the endpoint maximum"),
+		"only the group users endpoint should be clamped, and warned about once")
+	assert.Contains(t, buf.String(), `"endpoint":"group users"`)
+}
+
+func TestProvider_UserGroupsTenant(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	var buf bytes.Buffer
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	p.log = zerolog.New(&buf)
+
+	_, _, err := p.UserGroups(directory.WithTenant(context.Background(), "acme"))
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `"tenant":"acme"`)
+	assert.Equal(t, "acme", p.SyncReport().Tenant)
+
+	buf.Reset()
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.NotContains(t, buf.String(), `"tenant"`)
+	assert.Empty(t, p.SyncReport().Tenant)
+}
+
+func TestProvider_UserGroupsSearchQuery(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"eng-backend", "sales"},
+		"b@example.com": {"eng-frontend"},
+		"c@example.com": {"sales"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithGroupSearchQuery("eng"),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, []string{"eng-backend", "eng-frontend"}, []string{groups[0].Id, groups[1].Id})
+	}
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"eng-backend"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"eng-frontend"}},
+	}, users)
+}
+
+func TestProvider_UserGroupsFilterPrecedence(t *testing.T) {
+	for _, tc := range []struct {
+		name                  string
+		options               []Option
+		firstQ, firstFilter   string
+		secondQ, secondFilter string
+	}{
+		{
+			name:         "incremental",
+			secondFilter: `lastUpdated gt "<since>" or lastMembershipUpdated gt "<since>"`,
+		},
+		{
+			name:         "group filter",
+			options:      []Option{WithGroupFilter(`type eq "OKTA_GROUP"`)},
+			firstFilter:  `type eq "OKTA_GROUP"`,
+			secondFilter: `(type eq "OKTA_GROUP") and (lastUpdated gt "<since>" or lastMembershipUpdated gt "<since>")`,
+		},
+		{
+			name:    "group search query",
+			options: []Option{WithGroupSearchQuery("eng")},
+			firstQ:  "eng",
+			secondQ: "eng",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests []url.Values
+			var mockOkta http.Handler
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v1/groups" && r.URL.Query().Get("after") == "" {
+					requests = append(requests, r.URL.Query())
+				}
+				mockOkta.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+			mockOkta = newMockOkta(srv, map[string][]string{
+				"a@example.com": {"eng"},
+			})
+
+			p := New(append([]Option{
+				WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+				WithProviderURL(mustParseURL(srv.URL)),
+				WithQPS(100),
+			}, tc.options...)...)
+			for i := 0; i < 2; i++ {
+				_, _, err := p.UserGroups(context.Background())
+				assert.NoError(t, err)
+			}
+			since := p.lastUpdated.UTC().Format(filterDateFormat)
+			if assert.Len(t, requests, 2) {
+				assert.Equal(t, tc.firstQ, requests[0].Get("q"))
+				assert.Equal(t, tc.firstFilter, requests[0].Get("filter"))
+				assert.Equal(t, tc.secondQ, requests[1].Get("q"))
+				assert.Equal(t, strings.ReplaceAll(tc.secondFilter, "<since>", since), requests[1].Get("filter"))
+			}
+		})
+	}
+}
+
+func TestProvider_UserGroupsCursorFromBody(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/groups" {
+			mockOkta.ServeHTTP(w, r)
+			return
+		}
+
+		// move the next cursor from the Link header into the body
+		rec := httptest.NewRecorder()
+		mockOkta.ServeHTTP(rec, r)
+		var after string
+		if next := getNextLink(rec.Header()); next != "" {
+			after = mustParseURL(next).Query().Get("after")
+		}
+		_ = json.NewEncoder(w).Encode(M{
+			"data":  json.RawMessage(rec.Body.Bytes()),
+			"after": after,
+		})
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithCursorFromBody(true),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"test", "user"}},
+	}, users)
+}
+
+func TestProvider_UserGroupsClientCertificate(t *testing.T) {
+	cert, leaf := newClientCertificate(t)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(leaf)
+
+	var mockOkta http.Handler
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	srv.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	t.Run("without certificate", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithHTTPClient(srv.Client()),
+		)
+		_, _, err := p.UserGroups(context.Background())
+		assert.Error(t, err)
+	})
+	t.Run("with certificate", func(t *testing.T) {
+		// the test server's client trusts its certificate, so this also checks the CA pool is kept
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithHTTPClient(srv.Client()),
+			WithQPS(100),
+			WithClientCertificate(cert),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"user"}},
+		}, users)
+	})
+}
+
+func newClientCertificate(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "pomerium"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, leaf
+}
+
+func TestProvider_UserGroupsExpandStats(t *testing.T) {
+	var expand []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			expand = append(expand, r.URL.Query().Get("expand"))
+			_ = json.NewEncoder(w).Encode([]M{{
+				"id":        "admin",
+				"profile":   M{"name": "admin-name"},
+				"_embedded": M{"stats": M{"usersCount": 42}},
+			}})
+		default:
+			_ = json.NewEncoder(w).Encode([]M{{"id": "a@example.com"}})
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithExpandStats(true),
+	)
+	groups, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stats"}, expand)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin", Name: "admin-name", AltIds: []string{"admin-name"}, MemberCount: 42},
+	}, groups)
+
+	expand = nil
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	groups, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{""}, expand)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin", Name: "admin-name", AltIds: []string{"admin-name"}, MemberCount: 1},
+	}, groups, "without stats the member count should be counted from the members")
+}
+
+func TestProvider_UserGroupsUseEmbeddedMembers(t *testing.T) {
+	var memberRequests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{
+				{
+					"id":      "admin",
+					"profile": M{"name": "admin-name"},
+					"_embedded": M{"users": []M{
+						{"id": "a@example.com", "status": "ACTIVE"},
+						{"id": "b@example.com", "status": "SUSPENDED"},
+					}},
+				},
+				{
+					"id":      "user",
+					"profile": M{"name": "user-name"},
+				},
+			})
+		default:
+			memberRequests = append(memberRequests, r.URL.Path)
+			_ = json.NewEncoder(w).Encode([]M{{"id": "a@example.com"}, {"id": "c@example.com"}})
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithActiveUsersOnly(true),
+		WithUseEmbeddedMembers(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/api/v1/groups/user/users"}, memberRequests,
+		"only groups without embedded members should be listed separately")
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/c@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}, users)
+}
+
+func TestProvider_UserGroupsFollowServerLinks(t *testing.T) {
+	var mockOkta http.Handler
+	var linkedRequests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v1/groups":
+			// add a users link to the admin group only
+			rec := httptest.NewRecorder()
+			mockOkta.ServeHTTP(rec, r)
+			var groups []M
+			_ = json.Unmarshal(rec.Body.Bytes(), &groups)
+			for _, group := range groups {
+				if group["id"] == "admin" {
+					group["_links"] = M{
+						"users": M{"href": "/links/groups/admin/members?source=link"},
+					}
+				}
+			}
+			w.Header().Set("Link", rec.Header().Get("Link"))
+			_ = json.NewEncoder(w).Encode(groups)
+		case strings.HasPrefix(r.URL.Path, "/links/"):
+			linkedRequests = append(linkedRequests, r.URL.RawQuery)
+			r.URL.Path = "/api/v1/groups/admin/users"
+			mockOkta.ServeHTTP(w, r)
+		case strings.HasSuffix(r.URL.Path, "/admin/users"):
+			http.Error(w, "expected users link to be followed", http.StatusNotFound)
+		default:
+			mockOkta.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"everyone", "admin"},
+		"b@example.com": {"everyone"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithFollowServerLinks(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "everyone"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"everyone"}},
+	}, users)
+	assert.Equal(t, []string{"limit=200&source=link"}, linkedRequests)
+}
+
+func TestProvider_UserGroupsFollowServerLinksForeignHost(t *testing.T) {
+	var foreignRequests int32
+	foreign := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&foreignRequests, 1)
+		http.Error(w, "the users link to another host should not be followed", http.StatusForbidden)
+	}))
+	defer foreign.Close()
+
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/groups" {
+			mockOkta.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		mockOkta.ServeHTTP(rec, r)
+		var groups []M
+		_ = json.Unmarshal(rec.Body.Bytes(), &groups)
+		for _, group := range groups {
+			group["_links"] = M{
+				"users": M{"href": foreign.URL + "/api/v1/groups/" + group["id"].(string) + "/users"},
+			}
+		}
+		w.Header().Set("Link", rec.Header().Get("Link"))
+		_ = json.NewEncoder(w).Encode(groups)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"admin"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithFollowServerLinks(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin"}},
+	}, users)
+	assert.Zero(t, atomic.LoadInt32(&foreignRequests), "the api key should not be sent to another host")
+}
+
+func TestProvider_UserGroupsExcludeGuests(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"everyone", "admin"},
+		"b@example.com": {"everyone", "guests"},
+		"c@partner.com": {"everyone"},
+	})
+
+	t.Run("guest group", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithExcludeGuests(true),
+			WithGuestGroupID("guests"),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "everyone"}},
+			{Id: "okta/c@partner.com", Source: "okta", GroupIds: []string{"everyone"}},
+		}, users)
+	})
+	t.Run("guest predicate", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithExcludeGuests(true),
+			WithGuestPredicate(func(profile map[string]interface{}) bool {
+				email, _ := profile["email"].(string)
+				return strings.HasSuffix(email, "@partner.com")
+			}),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "everyone"}},
+			{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"everyone", "guests"}},
+		}, users)
+	})
+	t.Run("guest group beyond the max members", func(t *testing.T) {
+		var mockOkta http.Handler
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mockOkta.ServeHTTP(w, r)
+		}))
+		defer srv.Close()
+		mockOkta = newMockOkta(srv, map[string][]string{
+			"a@example.com": {"admin"},
+			"b@partner.com": {"guests"},
+			"c@partner.com": {"guests"},
+			"d@partner.com": {"admin", "guests"},
+		})
+
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithExcludeGuests(true),
+			WithGuestGroupID("guests"),
+			WithMaxMembersPerGroup(2),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		userIDs := []string{}
+		for _, user := range users {
+			userIDs = append(userIDs, user.Id)
+		}
+		assert.Equal(t, []string{"okta/a@example.com"}, userIDs, "every member of the guest group should be excluded")
+	})
+}
+
+func TestIsGuestUserType(t *testing.T) {
+	assert.True(t, isGuestUserType(map[string]interface{}{"userType": "Guest"}))
+	assert.False(t, isGuestUserType(map[string]interface{}{"userType": "Employee"}))
+	assert.False(t, isGuestUserType(nil))
+}
+
+func TestProvider_Verify(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+	)
+	assert.NoError(t, p.Verify(context.Background()))
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "INVALID"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+	)
+	assert.Error(t, p.Verify(context.Background()))
+}
+
+func TestProvider_VerifyRetries(t *testing.T) {
+	var mockOkta http.Handler
+	var requests int32
+	var failures int32
+	var status int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			if atomic.LoadInt32(&status) == 0 {
+				// a network error
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				_ = conn.Close()
+				return
+			}
+			http.Error(w, "error", int(atomic.LoadInt32(&status)))
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	newProvider := func(verifyRetries int, options ...Option) *Provider {
+		return New(append([]Option{
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithBackoff(directory.NewConstantBackoff(time.Millisecond)),
+			WithVerifyRetries(verifyRetries),
+		}, options...)...)
+	}
+
+	t.Run("transient then success", func(t *testing.T) {
+		for _, code := range []int32{0, http.StatusServiceUnavailable} {
+			atomic.StoreInt32(&requests, 0)
+			atomic.StoreInt32(&failures, 2)
+			atomic.StoreInt32(&status, code)
+			assert.NoError(t, newProvider(2).Verify(context.Background()))
+			assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+		}
+	})
+	t.Run("retries exhausted", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, 3)
+		atomic.StoreInt32(&status, http.StatusServiceUnavailable)
+		assert.Error(t, newProvider(2).Verify(context.Background()))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	})
+	t.Run("persistent 403", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, 100)
+		atomic.StoreInt32(&status, http.StatusForbidden)
+		err := newProvider(5).Verify(context.Background())
+		var apiErr *apiError
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "a 403 should not be retried")
+	})
+	t.Run("custom retriable status", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, 2)
+		atomic.StoreInt32(&status, 522)
+		assert.NoError(t, newProvider(2, WithRetriableStatuses([]int{520, 522})).Verify(context.Background()))
+		assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+
+		atomic.StoreInt32(&requests, 0)
+		atomic.StoreInt32(&failures, 2)
+		assert.Error(t, newProvider(2).Verify(context.Background()))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&requests), "a 522 should only be retried when configured")
+	})
+}
+
+func TestProvider_UserGroupsRetriableStatuses(t *testing.T) {
+	var mockOkta http.Handler
+	var failures int32
+	var status int32
+	var membersRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users") {
+			atomic.AddInt32(&membersRequests, 1)
+			if atomic.AddInt32(&failures, -1) >= 0 {
+				http.Error(w, "origin unreachable", int(atomic.LoadInt32(&status)))
+				return
+			}
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithBackoff(directory.NewConstantBackoff(time.Millisecond)),
+		WithRetriableStatuses([]int{522}),
+	)
+	for _, code := range []int32{http.StatusServiceUnavailable, 522} {
+		atomic.StoreInt32(&membersRequests, 0)
+		atomic.StoreInt32(&failures, 1)
+		atomic.StoreInt32(&status, code)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err, "a %d should be retried", code)
+		assert.Len(t, users, 1)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&membersRequests))
+	}
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		atomic.StoreInt32(&membersRequests, 0)
+		atomic.StoreInt32(&failures, 100)
+		atomic.StoreInt32(&status, 522)
+		_, _, err := p.UserGroups(context.Background())
+		var apiErr *apiError
+		if assert.True(t, errors.As(err, &apiErr)) {
+			assert.Equal(t, 522, apiErr.StatusCode)
+		}
+		assert.Equal(t, int32(1+maxStatusRetries), atomic.LoadInt32(&membersRequests))
+	})
+	t.Run("other statuses", func(t *testing.T) {
+		atomic.StoreInt32(&membersRequests, 0)
+		atomic.StoreInt32(&failures, 1)
+		atomic.StoreInt32(&status, 520)
+		_, _, err := p.UserGroups(context.Background())
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&membersRequests), "a 520 should only be retried when configured")
+	})
+}
+
+func TestProvider_ProxyURL(t *testing.T) {
+	var mockOkta http.Handler
+	var mu sync.Mutex
+	var proxiedHosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxiedHosts = append(proxiedHosts, r.Host)
+		mu.Unlock()
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+	mockOkta = newMockOkta(proxy, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL("http://okta.invalid")),
+		WithProxyURL(mustParseURL(proxy.URL)),
+		WithQPS(100),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.NotEmpty(t, proxiedHosts) {
+		assert.Equal(t, "okta.invalid", proxiedHosts[0])
+	}
+}
+
+func TestProvider_RequestSigner(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mac := hmac.New(sha256.New, []byte("SECRET"))
+		_, _ = io.WriteString(mac, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("Authorization"))
+		if r.Header.Get("X-Gateway-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	var signed int
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithRequestSigner(func(req *http.Request) error {
+			signed++
+			mac := hmac.New(sha256.New, []byte("SECRET"))
+			_, _ = io.WriteString(mac, req.Method+" "+req.URL.RequestURI()+" "+req.Header.Get("Authorization"))
+			req.Header.Set("X-Gateway-Signature", hex.EncodeToString(mac.Sum(nil)))
+			return nil
+		}),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.NotZero(t, signed)
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithRequestSigner(func(req *http.Request) error {
+			return errors.New("no signing key")
+		}),
+	)
+	err = p.Verify(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to sign request: no signing key")
+	}
+}
+
+func TestProvider_AuthScheme(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a gateway translating the Bearer scheme
+		if r.Header.Get("Authorization") != "Bearer APITOKEN" {
+			http.Error(w, "invalid authorization", http.StatusUnauthorized)
+			return
+		}
+		r.Header.Set("Authorization", "SSWS APITOKEN")
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithAuthScheme("Bearer"),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+}
+
+func TestProvider_RequestIDInErrors(t *testing.T) {
+	var body atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Okta-Request-Id", "X1nFzRHsn5ATsqSZahwtcAAABxE")
+		if body.Load().(string) == "" {
+			http.Error(w, `{"errorCode":"E0000009","errorSummary":"Internal Server Error"}`, http.StatusInternalServerError)
+			return
+		}
+		_, _ = io.WriteString(w, body.Load().(string))
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+
+	body.Store("")
+	_, _, err := p.UserGroups(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "status_code=500 request_id=X1nFzRHsn5ATsqSZahwtcAAABxE")
+	}
+
+	body.Store("<html>bad gateway</html>")
+	_, _, err = p.UserGroups(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "status_code=200 request_id=X1nFzRHsn5ATsqSZahwtcAAABxE")
+	}
+}
+
+func TestProvider_UserGroupsIDPipeline(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"A@Example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithIDPipeline(directory.LowercaseID, directory.HashID),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "okta/"+directory.HashID("a@example.com"), users[0].Id)
+	}
+}
+
+func TestProvider_UserGroupsShouldSync(t *testing.T) {
+	var requests int32
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	var databrokerHealthy int32
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithShouldSync(func() bool { return atomic.LoadInt32(&databrokerHealthy) == 1 }),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	assert.True(t, errors.Is(err, ErrSyncPaused), "expected a sync paused error, got %v", err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests), "okta should not be queried while paused")
+
+	atomic.StoreInt32(&databrokerHealthy, 1)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.NotZero(t, atomic.LoadInt32(&requests))
+}
+
+func TestProvider_UserGroupsSource(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		for _, user := range users {
+			assert.Equal(t, Name, user.GetSource(), "the source of %s should be set", user.Id)
+		}
+	}
+
+	members, err := p.GroupMembers(context.Background(), "user")
+	assert.NoError(t, err)
+	if assert.Len(t, members, 2) {
+		assert.Equal(t, Name, members[0].GetSource())
+	}
+}
+
+func TestProvider_GroupMembers(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/groups/00g1/users" {
+			http.Error(w, "only the group members should be listed", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("after") {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups/00g1/users?after=2>; rel="next"`, srv.URL))
+			_ = json.NewEncoder(w).Encode([]M{{"id": "00u2"}, {"id": "00u1"}})
+		case "2":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/api/v1/groups/00g1/users?after=3>; rel="next"`, srv.URL))
+			_ = json.NewEncoder(w).Encode([]M{{"id": "00u3", "profile": M{"locale": "en_US"}}})
+		default:
+			_ = json.NewEncoder(w).Encode([]M{{"id": "00u4"}})
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	users, err := p.GroupMembers(context.Background(), "00g1")
+	assert.NoError(t, err)
+	var userIDs []string
+	for _, user := range users {
+		userIDs = append(userIDs, user.Id)
+	}
+	assert.Equal(t, []string{"okta/00u1", "okta/00u2", "okta/00u3", "okta/00u4"}, userIDs)
+	if assert.Len(t, users, 4) {
+		assert.Equal(t, "en_US", users[2].Attributes[AttributeLocale])
+	}
+
+	_, err = p.GroupMembers(context.Background(), "00g2")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "status_code=400")
+	}
+}
+
+func TestProvider_MinTLSVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]M{})
+	}))
+	srv.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11}
+	srv.StartTLS()
+	defer srv.Close()
+
+	t.Run("default", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+		)
+		err := p.Verify(context.Background())
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "protocol version")
+		}
+	})
+	t.Run("older version allowed", func(t *testing.T) {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithMinTLSVersion(tls.VersionTLS10),
+		)
+		err := p.Verify(context.Background())
+		if assert.Error(t, err) {
+			assert.NotContains(t, err.Error(), "protocol version", "the handshake should get to verifying the certificate")
+			assert.Contains(t, err.Error(), "certificate")
+		}
+	})
+	t.Run("custom client", func(t *testing.T) {
+		client := srv.Client()
+		client.Transport.(*http.Transport).TLSClientConfig.MinVersion = tls.VersionTLS10
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithHTTPClient(client),
+		)
+		assert.NoError(t, p.Verify(context.Background()), "the custom client's TLS configuration should be used as is")
+	})
+}
+
+func TestProvider_RedactErrors(t *testing.T) {
+	const apiKey = "00secretapikey"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// echo the request back in the error, as some proxies do
+		http.Error(w, fmt.Sprintf("bad request: Authorization=%q token=%s url=%s?client_secret=hunter2",
+			r.Header.Get("Authorization"), apiKey, r.URL.Path), http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: apiKey}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), apiKey)
+		assert.NotContains(t, err.Error(), "hunter2")
+		assert.Contains(t, err.Error(), "status_code=500")
+	}
+
+	err = p.Verify(context.Background())
+	if assert.Error(t, err) {
+		assert.NotContains(t, err.Error(), apiKey)
+	}
+}
+
+func TestProvider_SharedRateLimiter(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	limiter := directory.NewRateLimiter(20, 1)
+	providers := []*Provider{
+		New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithRateLimiter(limiter),
+		),
+		New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithRateLimiter(limiter),
+		),
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, p := range providers {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func(p *Provider) {
+				defer wg.Done()
+				assert.NoError(t, p.Verify(context.Background()))
+			}(p)
+		}
+	}
+	wg.Wait()
+
+	// 6 requests at 20 per second with a burst of 1 take at least 250ms when throttled together
+	assert.True(t, time.Since(start) >= 250*time.Millisecond, "providers should share the rate limiter")
+}
+
+func TestProvider_ConnectionSemaphore(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+	})
+
+	semaphore := make(chan struct{}, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithConnectionSemaphore(semaphore),
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxInFlight), "providers sharing a semaphore should make one request at a time")
+	assert.Len(t, semaphore, 0, "the semaphore should be released after each request")
+}
+
+func TestProvider_RetryDeadline(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(2*time.Second).Unix(), 10))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMinAttemptTime(500*time.Millisecond),
+	)
+
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second)
+	defer clearTimeout()
+
+	start := time.Now()
+	err := p.Verify(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status_code=429")
+	assert.Equal(t, 1, requests, "the retry should be skipped")
+	assert.True(t, time.Since(start) < time.Second, "the provider should not wait for the rate limit reset")
+}
+
+func TestProvider_DecodeError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = io.WriteString(w, "<html><body>Bad Gateway, token APITOKEN"+strings.Repeat(".", 1000)+"</body></html>")
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "status_code=200")
+		assert.Contains(t, err.Error(), "<html><body>Bad Gateway")
+		assert.NotContains(t, err.Error(), "APITOKEN")
+		assert.NotContains(t, err.Error(), "</html>", "the body should be truncated")
+	}
+}
+
+func TestProvider_UserGroupsAllowPartialResults(t *testing.T) {
+	var mockOkta http.Handler
+	var mu sync.Mutex
+	garbage := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n := garbage[r.URL.Path]
+		if n > 0 {
+			garbage[r.URL.Path] = n - 1
+		}
+		mu.Unlock()
+		if n > 0 {
+			_, _ = io.WriteString(w, `[{"id": "a@exa`)
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user"},
+	})
+	setGarbage := func(pathToCount map[string]int) {
+		mu.Lock()
+		garbage = pathToCount
+		mu.Unlock()
+	}
+	newProvider := func(allowPartialResults bool) *Provider {
+		return New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithAllowPartialResults(allowPartialResults),
+		)
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		setGarbage(map[string]int{"/api/v1/groups/user/users": 1})
+		p := newProvider(true)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+			{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"user"}},
+		}, users)
+		assert.Empty(t, p.SyncReport().Warnings)
+	})
+	t.Run("incomplete", func(t *testing.T) {
+		setGarbage(map[string]int{"/api/v1/groups/user/users": 2})
+		p := newProvider(true)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*directory.User{
+			{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin"}},
+		}, users)
+		warnings := p.SyncReport().Warnings
+		if assert.Len(t, warnings, 1) {
+			assert.Equal(t, directory.WarningCodeGroupIncomplete, warnings[0].Code)
+			assert.Equal(t, "user", warnings[0].SubjectID)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		setGarbage(map[string]int{"/api/v1/groups/user/users": 1})
+		_, _, err := newProvider(false).UserGroups(context.Background())
+		var decodeErr *decodeError
+		assert.True(t, errors.As(err, &decodeErr), "expected a decode error, got %v", err)
+	})
+}
+
+func TestProvider_MaxResponseBytes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `[{"id": "`+strings.Repeat("0", 1000)+`"}]`)
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMaxResponseBytes(100),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	assert.True(t, errors.Is(err, errResponseTooLarge), "expected a response too large error, got %v", err)
+
+	p = New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMaxResponseBytes(2000),
+	)
+	assert.NoError(t, p.Verify(context.Background()))
+}
+
+type recordingBackoff struct {
+	attempts []int
+}
+
+func (b *recordingBackoff) NextDelay(attempt int) time.Duration {
+	b.attempts = append(b.attempts, attempt)
+	return time.Millisecond
+}
+
+func TestProvider_Backoff(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 3 {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]M{})
+	}))
+	defer srv.Close()
+
+	backoff := new(recordingBackoff)
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithBackoff(backoff),
+	)
+	assert.NoError(t, p.Verify(context.Background()))
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, []int{1, 2, 3}, backoff.attempts)
+}
+
+func TestProvider_DeadlineBudget(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-Rate-Limit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	start := time.Now()
+	err := p.Verify(directory.WithDeadlineBudget(context.Background(), 5*time.Second))
+	var apiErr *apiError
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	}
+	assert.True(t, time.Since(start) < 5*time.Second, "the rate limit reset is after the budget, so it shouldn't be waited for")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestProvider_RetryMetrics(t *testing.T) {
+	view.Unregister(metrics.DirectoryViews...)
+	assert.NoError(t, view.Register(metrics.DirectoryViews...))
+	defer view.Unregister(metrics.DirectoryViews...)
+
+	var mockOkta http.Handler
+	var membersRequests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/users") && atomic.AddInt32(&membersRequests, 1) <= 2 {
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+
+	rows, err := view.RetrieveData(metrics.DirectoryRetryCountView.Name)
+	assert.NoError(t, err)
+	retries := map[string]int64{}
+	for _, row := range rows {
+		var endpoint string
+		for _, tag := range row.Tags {
+			if tag.Key == metrics.TagKeyDirectoryEndpoint {
+				endpoint = tag.Value
+			}
+		}
+		retries[endpoint] = row.Data.(*view.CountData).Value
+	}
+	assert.Equal(t, map[string]int64{"/api/v1/groups/{id}/users": 2}, retries)
+}
+
+func TestAPIEndpoint(t *testing.T) {
+	for uri, expect := range map[string]string{
+		"https://example.okta.com/api/v1/groups?limit=200":          "/api/v1/groups",
+		"https://example.okta.com/api/v1/groups/00g1/users":         "/api/v1/groups/{id}/users",
+		"https://example.okta.com/api/v1/groups/rules":              "/api/v1/groups/rules",
+		"https://example.okta.com/api/v1/users/00u1/groups?after=x": "/api/v1/users/{id}/groups",
+		"https://example.okta.com/api/v1/users/a%40example.com":     "/api/v1/users/{id}",
+	} {
+		assert.Equal(t, expect, apiEndpoint(uri), uri)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	providerURL := mustParseURL("https://example.okta.com")
+	serviceAccount := &ServiceAccount{APIKey: "APITOKEN"}
+
+	p, err := NewProvider(WithServiceAccount(serviceAccount), WithProviderURL(providerURL))
+	assert.NoError(t, err)
+	assert.NotNil(t, p)
+
+	for _, tc := range []struct {
+		name    string
+		options []Option
+		want    string
+	}{
+		{"no service account", []Option{WithProviderURL(providerURL)}, "service account not defined"},
+		{"no api key", []Option{WithServiceAccount(&ServiceAccount{}), WithProviderURL(providerURL)}, "api key not defined"},
+		{"no provider url", []Option{WithServiceAccount(serviceAccount)}, "provider url not defined"},
+		{"relative provider url", []Option{WithServiceAccount(serviceAccount), WithProviderURL(mustParseURL("example.okta.com"))}, "must be absolute"},
+		{"admin provider url", []Option{WithServiceAccount(serviceAccount), WithProviderURL(mustParseURL("https://example-admin.okta.com"))}, "use the api host example.okta.com instead"},
+		{"invalid auth scheme", []Option{WithServiceAccount(serviceAccount), WithProviderURL(providerURL), WithAuthScheme("Bearer\r\nX-Injected: 1")}, "must be a single token"},
+		{"empty auth scheme", []Option{WithServiceAccount(serviceAccount), WithProviderURL(providerURL), WithAuthScheme("")}, "must be a single token"},
+		{"invalid retriable status", []Option{WithServiceAccount(serviceAccount), WithProviderURL(providerURL), WithRetriableStatuses([]int{522, 1000})}, "retriable status 1000 is not a valid http status"},
+		{"group search query and filter", []Option{WithServiceAccount(serviceAccount), WithProviderURL(providerURL), WithGroupSearchQuery("eng"), WithGroupFilter(`type eq "OKTA_GROUP"`)}, "can't be combined"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := NewProvider(tc.options...)
+			assert.Nil(t, p)
+			assert.True(t, errors.Is(err, directory.ErrConfig), "error should wrap ErrConfig")
+			assert.Contains(t, err.Error(), tc.want)
+		})
+	}
+
+	t.Run("allow admin host", func(t *testing.T) {
+		p, err := NewProvider(
+			WithServiceAccount(serviceAccount),
+			WithProviderURL(mustParseURL("https://example-admin.oktapreview.com")),
+			WithAllowAdminHost(true),
+		)
+		assert.NoError(t, err)
+		assert.NotNil(t, p)
+	})
+}
+
+func TestParseServiceAccount(t *testing.T) {
+	os.Setenv("OKTA_TEST_API_KEY", "APITOKEN")
+	defer os.Unsetenv("OKTA_TEST_API_KEY")
+	os.Unsetenv("OKTA_TEST_MISSING_API_KEY")
+
+	encode := func(apiKey string) string {
+		bs, _ := json.Marshal(M{"api_key": apiKey})
+		return base64.StdEncoding.EncodeToString(bs)
+	}
+
+	serviceAccount, err := ParseServiceAccount(encode("APITOKEN"))
+	assert.NoError(t, err)
+	assert.Equal(t, &ServiceAccount{APIKey: "APITOKEN"}, serviceAccount)
+
+	serviceAccount, err = ParseServiceAccount(encode("${OKTA_TEST_API_KEY}"))
+	assert.NoError(t, err)
+	assert.Equal(t, &ServiceAccount{APIKey: "APITOKEN"}, serviceAccount)
+
+	_, err = ParseServiceAccount(encode("${OKTA_TEST_MISSING_API_KEY}"))
+	assert.EqualError(t, err, "api_key: environment variable OKTA_TEST_MISSING_API_KEY is not set")
+}
+
 func mustParseURL(rawurl string) *url.URL {
 	u, err := url.Parse(rawurl)
 	if err != nil {
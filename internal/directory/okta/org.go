@@ -0,0 +1,29 @@
+package okta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// getOrgInfo returns the metadata of the Okta tenant.
+// https://developer.okta.com/docs/reference/api/org/#get-org-settings
+func (p *Provider) getOrgInfo(ctx context.Context) (*directory.OrgInfo, error) {
+	orgURL := p.cfg.providerURL.ResolveReference(&url.URL{
+		Path: "/api/v1/org",
+	}).String()
+
+	var out struct {
+		CompanyName string `json:"companyName"`
+		Subdomain   string `json:"subdomain"`
+	}
+	if _, err := p.apiGet(ctx, orgURL, &out); err != nil {
+		return nil, fmt.Errorf("okta: error querying for org: %w", err)
+	}
+	return &directory.OrgInfo{
+		CompanyName: out.CompanyName,
+		Subdomain:   out.Subdomain,
+	}, nil
+}
@@ -0,0 +1,69 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsFetchOrgInfo(t *testing.T) {
+	orgRequests := 0
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/org" {
+			orgRequests++
+			_ = json.NewEncoder(w).Encode(M{
+				"id":          "00o1",
+				"companyName": "Example Corp",
+				"subdomain":   "example",
+			})
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithFetchOrgInfo(true),
+	)
+	assert.Nil(t, p.SyncReport())
+
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, orgRequests)
+
+	report := p.SyncReport()
+	if assert.NotNil(t, report) {
+		assert.Equal(t, Name, report.Provider)
+		assert.Equal(t, &directory.OrgInfo{
+			CompanyName: "Example Corp",
+			Subdomain:   "example",
+		}, report.Org)
+		assert.False(t, report.EndTime.Before(report.StartTime))
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		orgRequests = 0
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+		)
+		_, _, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 0, orgRequests)
+		assert.Nil(t, p.SyncReport().Org)
+	})
+}
@@ -0,0 +1,35 @@
+package okta
+
+import "sort"
+
+// syncOrder returns the Okta ids of the known groups in the order their members are retrieved: the
+// priority groups first, then the others, each sorted by id.
+func (p *Provider) syncOrder() []string {
+	groupIDs := make([]string, 0, len(p.groups))
+	for groupID := range p.groups {
+		groupIDs = append(groupIDs, groupID)
+	}
+	sort.Slice(groupIDs, func(i, j int) bool {
+		pi, pj := p.isPriorityGroup(groupIDs[i]), p.isPriorityGroup(groupIDs[j])
+		if pi != pj {
+			return pi
+		}
+		return groupIDs[i] < groupIDs[j]
+	})
+	return groupIDs
+}
+
+// isPriorityGroup reports whether the group with the given Okta id is one of the priority groups, by
+// either its Okta or directory id.
+func (p *Provider) isPriorityGroup(groupID string) bool {
+	directoryGroupID := groupID
+	if group, ok := p.groups[groupID]; ok {
+		directoryGroupID = group.Id
+	}
+	for _, priorityGroupID := range p.cfg.priorityGroups {
+		if priorityGroupID == groupID || priorityGroupID == directoryGroupID {
+			return true
+		}
+	}
+	return false
+}
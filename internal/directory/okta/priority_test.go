@@ -0,0 +1,74 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsPriorityGroups(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" {
+			var out []M
+			for _, id := range []string{"a", "b", "c", "z-admin"} {
+				out = append(out, M{"id": id, "profile": M{"name": id}})
+			}
+			_ = json.NewEncoder(w).Encode(out)
+			return
+		}
+		groupID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/groups/"), "/users")
+		mu.Lock()
+		fetched = append(fetched, groupID)
+		mu.Unlock()
+		_ = json.NewEncoder(w).Encode([]M{
+			{"id": "a@example.com", "profile": M{"email": "a@example.com"}},
+		})
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMinAttemptTime(2*time.Second),
+		WithPriorityGroups([]string{"z-admin"}),
+	)
+
+	// without a deadline every group is retrieved, priority groups first
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"z-admin", "a", "b", "c"}, fetched)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, []string{"a", "b", "c", "z-admin"}, users[0].GroupIds)
+	}
+
+	// with less than the min attempt time left, only the priority groups are retrieved and the others
+	// keep their previous members
+	fetched = nil
+	ctx, clearTimeout := context.WithTimeout(context.Background(), time.Second)
+	defer clearTimeout()
+	_, users, err = p.UserGroups(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"z-admin"}, fetched)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, []string{"a", "b", "c", "z-admin"}, users[0].GroupIds)
+	}
+	var skipped []string
+	for _, warning := range p.SyncReport().Warnings {
+		if warning.Code == directory.WarningCodeGroupSkipped {
+			skipped = append(skipped, warning.SubjectID)
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, skipped)
+}
@@ -0,0 +1,94 @@
+package okta
+
+import (
+	"encoding/json"
+)
+
+// The user attributes read from the Okta profile of each user, when present, for display purposes.
+const (
+	AttributeLocale   = "locale"
+	AttributeTimezone = "timezone"
+)
+
+// profileAttributes maps the user attributes read from Okta profiles to their canonical profile fields.
+var profileAttributes = map[string]string{
+	AttributeLocale:   ProfileFieldLocale,
+	AttributeTimezone: ProfileFieldTimezone,
+}
+
+// setProfileAttribute sets the attribute of a profile value, or the attributes of its fields, as described
+// by WithFlattenNestedAttributes.
+func (p *Provider) setProfileAttribute(attributes map[string]string, name string, value interface{}) {
+	if value == nil {
+		return
+	}
+	if str, ok := value.(string); ok {
+		attributes[name] = str
+		return
+	}
+	if object, ok := value.(map[string]interface{}); ok && p.cfg.flattenAttributes {
+		for field, fieldValue := range object {
+			p.setProfileAttribute(attributes, name+"."+field, fieldValue)
+		}
+		return
+	}
+	if bs, err := json.Marshal(value); err == nil {
+		attributes[name] = string(bs)
+	}
+}
+
+// setUserAttributes keeps the profile attributes of a user's profile, such as their locale, and the
+// attributes of the user attributes option.
+func (p *Provider) setUserAttributes(userID string, profile map[string]interface{}) {
+	attributes := make(map[string]string, len(profileAttributes)+len(p.cfg.userAttributes))
+	for attribute, field := range profileAttributes {
+		if value := p.getProfileField(profile, field); value != "" {
+			attributes[attribute] = value
+		}
+	}
+	for _, name := range p.cfg.userAttributes {
+		p.setProfileAttribute(attributes, name, profile[name])
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(attributes) == 0 {
+		delete(p.userAttributes, userID)
+		return
+	}
+	if p.userAttributes == nil {
+		p.userAttributes = make(map[string]map[string]string)
+	}
+	p.userAttributes[userID] = attributes
+}
+
+// pruneUserAttributes forgets the profile attributes of users which are no longer members of any group.
+func (p *Provider) pruneUserAttributes(groupIDToMemberIDs map[string][]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	userAttributes := make(map[string]map[string]string, len(p.userAttributes))
+	for _, ids := range groupIDToMemberIDs {
+		for _, id := range ids {
+			if attributes, ok := p.userAttributes[id]; ok {
+				userAttributes[id] = attributes
+			}
+		}
+	}
+	p.userAttributes = userAttributes
+}
+
+// getUserAttributes returns a copy of the profile attributes of a user, since user attributes are added to
+// by other options.
+func (p *Provider) getUserAttributes(userID string) map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	attributes, ok := p.userAttributes[userID]
+	if !ok {
+		return nil
+	}
+	cp := make(map[string]string, len(attributes))
+	for k, v := range attributes {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,98 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_UserGroupsProfileAttributes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{{"id": "user", "profile": M{"name": "user-name"}}})
+		case "/api/v1/groups/user/users":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "a", "profile": M{"locale": "fr_FR", "timezone": "Europe/Paris"}},
+				{"id": "b", "profile": M{"login": "b@example.com"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "okta/a", users[0].Id)
+		assert.Equal(t, map[string]string{
+			AttributeLocale:   "fr_FR",
+			AttributeTimezone: "Europe/Paris",
+		}, users[0].Attributes)
+		assert.Empty(t, users[1].Attributes, "attributes missing from the profile should be absent")
+	}
+}
+
+func TestProvider_UserGroupsNestedAttributes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{{"id": "user", "profile": M{"name": "user-name"}}})
+		case "/api/v1/groups/user/users":
+			_ = json.NewEncoder(w).Encode([]M{{"id": "a", "profile": M{
+				"costCenter": "eng",
+				"clearance": M{
+					"level":   3,
+					"regions": []string{"eu", "us"},
+					"site":    M{"code": "PAR"},
+					"expires": nil,
+				},
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name    string
+		flatten bool
+		want    map[string]string
+	}{
+		{"json", false, map[string]string{
+			"costCenter": "eng",
+			"clearance":  `{"expires":null,"level":3,"regions":["eu","us"],"site":{"code":"PAR"}}`,
+		}},
+		{"flatten", true, map[string]string{
+			"costCenter":          "eng",
+			"clearance.level":     "3",
+			"clearance.regions":   `["eu","us"]`,
+			"clearance.site.code": "PAR",
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := New(
+				WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+				WithProviderURL(mustParseURL(srv.URL)),
+				WithQPS(100),
+				WithUserAttributes([]string{"costCenter", "clearance", "missing"}),
+				WithFlattenNestedAttributes(tc.flatten),
+			)
+			_, users, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+			if assert.Len(t, users, 1) {
+				assert.Equal(t, tc.want, users[0].Attributes)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package okta
+
+import (
+	"sort"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// Reconcile returns the ids of the users in the previous snapshot which are missing from the current
+// snapshot. Since users are discovered via their groups, a user removed from every group is only detected
+// by comparing snapshots.
+func Reconcile(previous, current []*directory.User) (removedUserIDs []string) {
+	for _, u := range directory.DiffUsers(previous, current).Removed {
+		removedUserIDs = append(removedUserIDs, u.GetId())
+	}
+	return removedUserIDs
+}
+
+// reconcile records the users removed since the previous sync in the sync report.
+func (p *Provider) reconcile(report *directory.SyncReport, users []*directory.User) {
+	if p.cfg.reconcileUsers && p.previousUsers != nil {
+		report.RemovedUserIDs = Reconcile(p.previousUsers, users)
+	}
+}
+
+// logMembershipChanges calls the membership change logger with the changes to the members of each group
+// since the previous sync.
+func (p *Provider) logMembershipChanges(users []*directory.User) {
+	if p.cfg.membershipLogger == nil || p.previousUsers == nil {
+		return
+	}
+	diffs := directory.DiffMemberships(p.previousUsers, users)
+	groupIDs := make([]string, 0, len(diffs))
+	for groupID := range diffs {
+		groupIDs = append(groupIDs, groupID)
+	}
+	sort.Strings(groupIDs)
+	for _, groupID := range groupIDs {
+		p.cfg.membershipLogger(groupID, diffs[groupID].Added, diffs[groupID].Removed)
+	}
+}
+
+// addRemovedUserIDs adds the ids of users known to be removed, such as deprovisioned users, to the removed
+// user ids found by reconciling.
+func addRemovedUserIDs(removedUserIDs, userIDs []string) []string {
+	if len(userIDs) == 0 {
+		return removedUserIDs
+	}
+	return sortedUnique(append(append([]string(nil), removedUserIDs...), userIDs...))
+}
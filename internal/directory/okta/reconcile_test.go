@@ -0,0 +1,104 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_ReconcileUsers(t *testing.T) {
+	members := []M{{"id": "a@example.com"}, {"id": "b@example.com"}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{{"id": "user", "profile": M{"name": "user-name"}}})
+		case "/api/v1/groups/user/users":
+			_ = json.NewEncoder(w).Encode(members)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithReconcileUsers(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Empty(t, p.SyncReport().RemovedUserIDs, "nothing is removed on the first sync")
+
+	members = []M{{"id": "a@example.com"}}
+	_, users, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, []string{"okta/b@example.com"}, p.SyncReport().RemovedUserIDs)
+
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, p.SyncReport().RemovedUserIDs)
+}
+
+func TestProvider_MembershipChangeLogger(t *testing.T) {
+	members := map[string][]M{
+		"admin": {{"id": "a@example.com"}},
+		"user":  {{"id": "b@example.com"}, {"id": "c@example.com"}},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "admin", "profile": M{"name": "admin-name"}},
+				{"id": "user", "profile": M{"name": "user-name"}},
+			})
+		case "/api/v1/groups/admin/users":
+			_ = json.NewEncoder(w).Encode(members["admin"])
+		case "/api/v1/groups/user/users":
+			_ = json.NewEncoder(w).Encode(members["user"])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	type change struct {
+		groupID        string
+		added, removed []string
+	}
+	var changes []change
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMembershipChangeLogger(func(groupID string, added, removed []string) {
+			changes = append(changes, change{groupID, added, removed})
+		}),
+	)
+	_, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, changes, "nothing is logged on the first sync")
+
+	// b moves from user to admin
+	members = map[string][]M{
+		"admin": {{"id": "a@example.com"}, {"id": "b@example.com"}},
+		"user":  {{"id": "c@example.com"}},
+	}
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []change{
+		{"admin", []string{"okta/b@example.com"}, nil},
+		{"user", nil, []string{"okta/b@example.com"}},
+	}, changes)
+
+	changes = nil
+	_, _, err = p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, changes, "nothing is logged when memberships are unchanged")
+}
@@ -0,0 +1,63 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// A Cursor is the incremental sync state of an Okta provider.
+type Cursor struct {
+	// LastUpdated is the time of the most recent group change seen by the provider.
+	LastUpdated time.Time `json:"last_updated"`
+	// Groups are the groups known to the provider, keyed by Okta group id. Incremental syncs only list the
+	// groups which changed, so the others have to be restored as well.
+	Groups map[string]*directory.Group `json:"groups,omitempty"`
+}
+
+// MarshalBinary marshals the cursor as JSON.
+func (c *Cursor) MarshalBinary() ([]byte, error) {
+	return json.Marshal(c)
+}
+
+// UnmarshalBinary unmarshals a cursor marshaled by MarshalBinary.
+func (c *Cursor) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, c)
+}
+
+// Cursor returns the incremental sync state of the most recent sync, or nil if the provider hasn't synced.
+func (p *Provider) Cursor() directory.Cursor {
+	if p.lastUpdated == nil {
+		return nil
+	}
+	groups := make(map[string]*directory.Group, len(p.groups))
+	for id, group := range p.groups {
+		groups[id] = group
+	}
+	return &Cursor{
+		LastUpdated: *p.lastUpdated,
+		Groups:      groups,
+	}
+}
+
+// resume restores the incremental sync state from the cursor in ctx, if there is one and the provider
+// hasn't synced yet.
+func (p *Provider) resume(ctx context.Context) error {
+	raw := directory.CursorFromContext(ctx)
+	if raw == nil || p.lastUpdated != nil {
+		return nil
+	}
+
+	var cursor Cursor
+	if err := cursor.UnmarshalBinary(raw); err != nil {
+		return fmt.Errorf("okta: invalid cursor: %w", err)
+	}
+	p.lastUpdated = &cursor.LastUpdated
+	for id, group := range cursor.Groups {
+		p.groups[id] = group
+	}
+	return nil
+}
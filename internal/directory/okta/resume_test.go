@@ -0,0 +1,90 @@
+package okta
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestCursor_MarshalBinary(t *testing.T) {
+	cursor := &Cursor{
+		LastUpdated: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Groups: map[string]*directory.Group{
+			"00g1": {Id: "00g1", Name: "admin", AltIds: []string{"admin"}},
+		},
+	}
+	raw, err := cursor.MarshalBinary()
+	assert.NoError(t, err)
+
+	var got Cursor
+	assert.NoError(t, got.UnmarshalBinary(raw))
+	assert.True(t, cursor.LastUpdated.Equal(got.LastUpdated))
+	if assert.Contains(t, got.Groups, "00g1") {
+		assert.Equal(t, "admin", got.Groups["00g1"].GetName())
+		assert.Equal(t, []string{"admin"}, got.Groups["00g1"].GetAltIds())
+	}
+
+	assert.Error(t, got.UnmarshalBinary([]byte("not a cursor")))
+}
+
+func TestProvider_UserGroupsResumeFromCursor(t *testing.T) {
+	var filters []string
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups" && r.URL.Query().Get("after") == "" {
+			filters = append(filters, r.URL.Query().Get("filter"))
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com":       {"user", "admin"},
+		"b@example.com":       {"user", "test"},
+		"updated@example.com": {"user-updated"},
+	})
+
+	newProvider := func() *Provider {
+		return New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+		)
+	}
+
+	p := newProvider()
+	assert.Nil(t, p.Cursor(), "there should be no cursor before the first sync")
+	groups, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, groups, 3)
+	raw, err := p.Cursor().MarshalBinary()
+	assert.NoError(t, err)
+
+	// a new provider, as after a restart, resumes with an incremental sync
+	filters = nil
+	p = newProvider()
+	groups, users, err := p.UserGroups(directory.WithCursor(context.Background(), raw))
+	assert.NoError(t, err)
+	if assert.Len(t, filters, 1) {
+		assert.Contains(t, filters[0], "lastUpdated gt ")
+	}
+	assert.Len(t, groups, 4, "groups from the cursor should be kept")
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"test", "user"}},
+		{Id: "okta/updated@example.com", Source: "okta", GroupIds: []string{"user-updated"}},
+	}, users)
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		filters = nil
+		p := newProvider()
+		_, _, err := p.UserGroups(directory.WithCursor(context.Background(), []byte("not a cursor")))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{""}, filters, "an invalid cursor should result in a full sync")
+	})
+}
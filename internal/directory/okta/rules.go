@@ -0,0 +1,137 @@
+package okta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+const groupRuleCallPattern = `isMemberOf(?:Any)?Group\(\s*"[^"]+"(?:\s*,\s*"[^"]+")*\s*\)`
+
+var (
+	// groupRuleExpressionRE matches an expression which is a single isMemberOfGroup or
+	// isMemberOfAnyGroup call, or an OR of such calls.
+	groupRuleExpressionRE = regexp.MustCompile(`^\s*` + groupRuleCallPattern +
+		`(?:\s*(?:OR|\|\|)\s*` + groupRuleCallPattern + `)*\s*$`)
+	groupRuleGroupIDRE = regexp.MustCompile(`"([^"]+)"`)
+)
+
+// A groupRule is an Okta group rule which assigns members of the source groups to the target groups.
+type groupRule struct {
+	sourceGroupIDs []string
+	targetGroupIDs []string
+}
+
+// getGroupRules returns the active group rules whose conditions are based only on group membership.
+// Other active rules can't be evaluated from group membership alone, so they are skipped with a
+// warning.
+// https://developer.okta.com/docs/reference/api/groups/#list-group-rules
+func (p *Provider) getGroupRules(ctx context.Context, warnings *syncWarnings) ([]groupRule, error) {
+	rulesURL := p.cfg.providerURL.ResolveReference(&url.URL{
+		Path:     "/api/v1/groups/rules",
+		RawQuery: url.Values{"limit": {strconv.Itoa(p.batchSize("group rules", maxGroupRulesBatchSize))}}.Encode(),
+	}).String()
+
+	var rules []groupRule
+	for rulesURL != "" {
+		var out []struct {
+			ID         string `json:"id"`
+			Status     string `json:"status"`
+			Conditions struct {
+				People struct {
+					Users struct {
+						Exclude []string `json:"exclude"`
+					} `json:"users"`
+				} `json:"people"`
+				Expression struct {
+					Value string `json:"value"`
+				} `json:"expression"`
+			} `json:"conditions"`
+			Actions struct {
+				AssignUserToGroups struct {
+					GroupIDs []string `json:"groupIds"`
+				} `json:"assignUserToGroups"`
+			} `json:"actions"`
+		}
+		hdrs, err := p.apiGet(ctx, rulesURL, &out)
+		if err != nil {
+			return nil, fmt.Errorf("okta: error querying for group rules: %w", err)
+		}
+		p.recordPage("group rules", len(out))
+
+		for _, el := range out {
+			if el.Status != "ACTIVE" {
+				continue
+			}
+			if len(el.Actions.AssignUserToGroups.GroupIDs) == 0 {
+				continue
+			}
+			sourceGroupIDs := parseGroupRuleExpression(el.Conditions.Expression.Value)
+			if len(sourceGroupIDs) == 0 || len(el.Conditions.People.Users.Exclude) > 0 {
+				p.log.Warn().Str("rule_id", el.ID).Str("expression", el.Conditions.Expression.Value).
+					Msg("group rule is not based only on group membership, skipping")
+				warnings.add(directory.WarningCodeGroupRuleSkipped, el.ID,
+					"group rule %s is not based only on group membership, so its members were not expanded", el.ID)
+				continue
+			}
+			rules = append(rules, groupRule{
+				sourceGroupIDs: sourceGroupIDs,
+				targetGroupIDs: el.Actions.AssignUserToGroups.GroupIDs,
+			})
+		}
+
+		rulesURL = getNextLink(hdrs)
+	}
+	return rules, nil
+}
+
+// parseGroupRuleExpression returns the group ids referenced by an Okta expression which is made up
+// only of isMemberOfGroup and isMemberOfAnyGroup calls joined by OR. Any other expression, such as
+// one using AND, negation or user attributes, returns nil.
+func parseGroupRuleExpression(expression string) []string {
+	if !groupRuleExpressionRE.MatchString(expression) {
+		return nil
+	}
+	var groupIDs []string
+	for _, arg := range groupRuleGroupIDRE.FindAllStringSubmatch(expression, -1) {
+		groupIDs = append(groupIDs, arg[1])
+	}
+	return groupIDs
+}
+
+// expandGroupRules adds the members of each rule's source groups to its target groups. Rules may
+// chain, so expansion is repeated until no more members are added.
+func expandGroupRules(groupIDToMemberIDs map[string][]string, rules []groupRule) {
+	lookup := make(map[string]map[string]struct{}, len(groupIDToMemberIDs))
+	for groupID, memberIDs := range groupIDToMemberIDs {
+		lookup[groupID] = make(map[string]struct{}, len(memberIDs))
+		for _, memberID := range memberIDs {
+			lookup[groupID][memberID] = struct{}{}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, rule := range rules {
+			for _, targetGroupID := range rule.targetGroupIDs {
+				targetMembers, ok := lookup[targetGroupID]
+				if !ok {
+					continue
+				}
+				for _, sourceGroupID := range rule.sourceGroupIDs {
+					for memberID := range lookup[sourceGroupID] {
+						if _, ok := targetMembers[memberID]; !ok {
+							targetMembers[memberID] = struct{}{}
+							groupIDToMemberIDs[targetGroupID] = append(groupIDToMemberIDs[targetGroupID], memberID)
+							changed = true
+						}
+					}
+				}
+			}
+		}
+	}
+}
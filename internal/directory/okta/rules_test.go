@@ -0,0 +1,169 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsExpandGroupRules(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups/rules" {
+			_ = json.NewEncoder(w).Encode([]M{
+				{
+					"status":     "ACTIVE",
+					"conditions": M{"expression": M{"value": `isMemberOfAnyGroup("test", "contractors")`}},
+					"actions":    M{"assignUserToGroups": M{"groupIds": []string{"admin"}}},
+				},
+				{
+					"status":     "ACTIVE",
+					"conditions": M{"expression": M{"value": `isMemberOfGroup("admin")`}},
+					"actions":    M{"assignUserToGroups": M{"groupIds": []string{"superadmin"}}},
+				},
+				{
+					"status":     "INACTIVE",
+					"conditions": M{"expression": M{"value": `isMemberOfGroup("user")`}},
+					"actions":    M{"assignUserToGroups": M{"groupIds": []string{"test"}}},
+				},
+				{
+					"status":     "ACTIVE",
+					"conditions": M{"expression": M{"value": `user.department == "eng"`}},
+					"actions":    M{"assignUserToGroups": M{"groupIds": []string{"test"}}},
+				},
+			})
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user", "test"},
+		"c@example.com": {"user", "contractors"},
+		"d@example.com": {"superadmin"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithExpandGroupRules(true),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{
+			Id:       "okta/a@example.com",
+			Source:   "okta",
+			GroupIds: []string{"admin", "superadmin", "user"},
+		},
+		{
+			Id:       "okta/b@example.com",
+			Source:   "okta",
+			GroupIds: []string{"admin", "superadmin", "test", "user"},
+		},
+		{
+			Id:       "okta/c@example.com",
+			Source:   "okta",
+			GroupIds: []string{"admin", "contractors", "superadmin", "user"},
+		},
+		{
+			Id:       "okta/d@example.com",
+			Source:   "okta",
+			GroupIds: []string{"superadmin"},
+		},
+	}, users)
+	assert.Len(t, groups, 5)
+}
+
+func TestProvider_UserGroupsSkipGroupRules(t *testing.T) {
+	var mockOkta http.Handler
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/groups/rules" {
+			_ = json.NewEncoder(w).Encode([]M{
+				{
+					"id":     "and",
+					"status": "ACTIVE",
+					"conditions": M{"expression": M{
+						"value": `isMemberOfGroup("test") AND isMemberOfGroup("contractors")`,
+					}},
+					"actions": M{"assignUserToGroups": M{"groupIds": []string{"admin"}}},
+				},
+				{
+					"id":     "excluded",
+					"status": "ACTIVE",
+					"conditions": M{
+						"people":     M{"users": M{"exclude": []string{"b@example.com"}}},
+						"expression": M{"value": `isMemberOfGroup("test")`},
+					},
+					"actions": M{"assignUserToGroups": M{"groupIds": []string{"admin"}}},
+				},
+			})
+			return
+		}
+		mockOkta.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"admin"},
+		"b@example.com": {"test", "contractors"},
+	})
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithExpandGroupRules(true),
+	)
+	_, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.User{
+		{
+			Id:       "okta/a@example.com",
+			Source:   "okta",
+			GroupIds: []string{"admin"},
+		},
+		{
+			Id:       "okta/b@example.com",
+			Source:   "okta",
+			GroupIds: []string{"contractors", "test"},
+		},
+	}, users)
+	assert.Equal(t, []directory.Warning{
+		{
+			Code:      directory.WarningCodeGroupRuleSkipped,
+			Message:   "group rule and is not based only on group membership, so its members were not expanded",
+			SubjectID: "and",
+		},
+		{
+			Code:      directory.WarningCodeGroupRuleSkipped,
+			Message:   "group rule excluded is not based only on group membership, so its members were not expanded",
+			SubjectID: "excluded",
+		},
+	}, p.SyncReport().Warnings)
+}
+
+func TestParseGroupRuleExpression(t *testing.T) {
+	assert.Equal(t, []string{"a", "b", "c"},
+		parseGroupRuleExpression(`isMemberOfAnyGroup("a", "b") OR isMemberOfGroup("c")`))
+	assert.Equal(t, []string{"a", "b"},
+		parseGroupRuleExpression(`isMemberOfGroup("a") || isMemberOfGroup("b")`))
+	for _, expression := range []string{
+		`user.department == "eng"`,
+		`isMemberOfGroup("a") AND isMemberOfGroup("b")`,
+		`isMemberOfGroup("a") && isMemberOfGroup("b")`,
+		`!isMemberOfGroup("a")`,
+		`isMemberOfGroup("a") OR !isMemberOfGroup("b")`,
+		`isMemberOfGroup("a") OR user.department == "eng"`,
+		`isMemberOfGroup("a") AND user.department == "eng"`,
+	} {
+		assert.Empty(t, parseGroupRuleExpression(expression), expression)
+	}
+}
@@ -0,0 +1,79 @@
+package okta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// errGroupsExpansionUnsupported is returned when Okta doesn't expand the groups of a user listing.
+var errGroupsExpansionUnsupported = errors.New("okta: user listing doesn't support expanding groups")
+
+// getMemberIDsByUser lists every user once with their groups expanded, and maps the users to the members
+// of each known group, using the same exclusions as the group member listings. Groups which aren't known,
+// such as those excluded by the group filter, are ignored.
+func (p *Provider) getMemberIDsByUser(ctx context.Context, warnings *syncWarnings) (groupIDToMemberIDs map[string][]string, truncatedGroupIDs map[string]struct{}, err error) {
+	groupIDToMemberIDs = make(map[string][]string, len(p.groups))
+	for groupID := range p.groups {
+		groupIDToMemberIDs[groupID] = nil
+	}
+	truncatedGroupIDs = map[string]struct{}{}
+
+	u := &url.URL{Path: "/api/v1/users"}
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.batchSize("users", maxUsersBatchSize)))
+	q.Set("expand", "groups")
+	if p.cfg.activeUsersOnly {
+		q.Set("filter", activeUserFilter)
+	}
+	u.RawQuery = q.Encode()
+
+	usersURL := p.cfg.providerURL.ResolveReference(u).String()
+	for usersURL != "" {
+		var out []struct {
+			groupMember
+			Embedded *struct {
+				Groups []struct {
+					ID string `json:"id"`
+				} `json:"groups"`
+			} `json:"_embedded"`
+		}
+		hdrs, err := p.apiGet(ctx, usersURL, &out)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			return nil, nil, fmt.Errorf("%w: %s", errGroupsExpansionUnsupported, apiErr.Body)
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("okta: error querying for users: %w", err)
+		}
+		p.recordPage("users", len(out))
+
+		for _, el := range out {
+			if el.Embedded == nil {
+				// Okta ignored the expand parameter
+				return nil, nil, errGroupsExpansionUnsupported
+			}
+			for _, group := range el.Embedded.Groups {
+				ids, ok := groupIDToMemberIDs[group.ID]
+				if !ok {
+					continue
+				}
+				ids, truncated := p.appendMemberIDs(ids, group.ID, []groupMember{el.groupMember}, warnings)
+				if truncated {
+					if _, ok := truncatedGroupIDs[group.ID]; !ok {
+						truncatedGroupIDs[group.ID] = struct{}{}
+						warnings.add(directory.WarningCodeGroupTruncated, group.ID,
+							"group %s has more than %d members, remaining members were skipped", group.ID, p.cfg.maxMembersPerGroup)
+					}
+				}
+				groupIDToMemberIDs[group.ID] = ids
+			}
+		}
+		usersURL = getNextLink(hdrs)
+	}
+	return groupIDToMemberIDs, truncatedGroupIDs, nil
+}
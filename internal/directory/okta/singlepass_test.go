@@ -0,0 +1,93 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsSingleUserPass(t *testing.T) {
+	var mockOkta http.Handler
+	var expandSupported int32 = 1
+	var userListings, memberListings int32
+	r := chi.NewRouter()
+	r.Get("/api/v1/users", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&userListings, 1)
+		if r.URL.Query().Get("expand") != "groups" || atomic.LoadInt32(&expandSupported) == 0 {
+			http.Error(w, `{"errorCode":"E0000031"}`, http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]M{
+			{"id": "a@example.com", "status": "ACTIVE", "_embedded": M{"groups": []M{{"id": "admin"}, {"id": "user"}}}},
+			{"id": "b@example.com", "status": "ACTIVE", "_embedded": M{"groups": []M{{"id": "user"}, {"id": "unknown"}}}},
+			{"id": "c@example.com", "status": "ACTIVE", "_embedded": M{"groups": []M{}}},
+		})
+	})
+	r.Get("/api/v1/groups/{group}/users", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&memberListings, 1)
+		mockOkta.ServeHTTP(w, r)
+	})
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		mockOkta.ServeHTTP(w, r)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+	mockOkta = newMockOkta(srv, map[string][]string{
+		"a@example.com": {"user", "admin"},
+		"b@example.com": {"user"},
+	})
+
+	expectUsers := []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin", "user"}},
+		{Id: "okta/b@example.com", Source: "okta", GroupIds: []string{"user"}},
+	}
+
+	t.Run("expanded groups", func(t *testing.T) {
+		atomic.StoreInt32(&userListings, 0)
+		atomic.StoreInt32(&memberListings, 0)
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithSingleUserPass(true),
+		)
+		groups, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, expectUsers, users)
+		if assert.Len(t, groups, 2) {
+			assert.Equal(t, int64(1), groups[0].MemberCount)
+			assert.Equal(t, int64(2), groups[1].MemberCount)
+		}
+		assert.Equal(t, int32(1), atomic.LoadInt32(&userListings))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&memberListings))
+	})
+	t.Run("fallback", func(t *testing.T) {
+		atomic.StoreInt32(&expandSupported, 0)
+		defer atomic.StoreInt32(&expandSupported, 1)
+		atomic.StoreInt32(&userListings, 0)
+		atomic.StoreInt32(&memberListings, 0)
+		p := New(
+			WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+			WithProviderURL(mustParseURL(srv.URL)),
+			WithQPS(100),
+			WithSingleUserPass(true),
+		)
+		_, users, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, expectUsers, users)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&memberListings))
+
+		// the expansion isn't attempted again
+		_, _, err = p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&userListings))
+	})
+}
@@ -0,0 +1,95 @@
+package okta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A streamDecoder is an API response decoded incrementally from the response body, rather than from a
+// buffered copy of it, so a large page isn't held in memory both as bytes and as values.
+type streamDecoder interface {
+	decodeStream(dec *json.Decoder) error
+}
+
+// A groupMemberPage is a page of group members, decoded one member at a time.
+type groupMemberPage []groupMember
+
+func (page *groupMemberPage) decodeStream(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		// a null page has no members, as with json.Unmarshal
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected an array of group members, got %v", tok)
+	}
+	for dec.More() {
+		var member groupMember
+		if err := dec.Decode(&member); err != nil {
+			return err
+		}
+		*page = append(*page, member)
+	}
+	// the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after the group members")
+	}
+	return nil
+}
+
+// decodeStream decodes a response body into out as it's read. Like readBody, bodies larger than the max
+// response bytes option fail with errResponseTooLarge. Errors reading the body are wrapped like those of
+// readBody, while invalid bodies return a decodeError with the start of the body.
+func (p *Provider) decodeStream(body io.Reader, out streamDecoder, statusCode int, requestID, endpoint string) error {
+	r := &streamReader{r: body, remaining: p.cfg.maxResponseBytes, max: p.cfg.maxResponseBytes}
+	if err := out.decodeStream(json.NewDecoder(r)); err != nil {
+		if r.err != nil && r.err != io.EOF {
+			return fmt.Errorf("okta: error reading response of %s request_id=%s: %w", endpoint, requestID, r.err)
+		}
+		return newDecodeError(statusCode, requestID, r.prefix.Bytes(), err)
+	}
+	return nil
+}
+
+// A streamReader reads a response body of up to max bytes. It keeps the start of the body for decode
+// errors, and the error of the underlying reader, so read errors can be told apart from invalid bodies.
+type streamReader struct {
+	r         io.Reader
+	remaining int64
+	max       int64
+	prefix    bytes.Buffer
+	err       error
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	// read one byte past the limit, to tell a body of exactly max bytes from a larger one
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if keep := maxDecodeErrorBodySize - r.prefix.Len(); keep > 0 {
+		if keep > n {
+			keep = n
+		}
+		r.prefix.Write(p[:keep])
+	}
+	if r.remaining < 0 {
+		err = fmt.Errorf("%w: more than %d bytes", errResponseTooLarge, r.max)
+		n += int(r.remaining)
+	}
+	r.err = err
+	return n, err
+}
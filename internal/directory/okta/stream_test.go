@@ -0,0 +1,115 @@
+package okta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider_GroupMembersStreamingDecode(t *testing.T) {
+	var body atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, body.Load().(string))
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+		WithMaxResponseBytes(200),
+	)
+
+	for _, tc := range []struct {
+		name string
+		body string
+		want []string
+		err  string
+	}{
+		{"members", `[{"id": "00u1"}, {"id": "00u2", "profile": {"login": "b@example.com"}}]` + "\n", []string{"okta/00u1", "okta/00u2"}, ""},
+		{"null", `null`, []string{}, ""},
+		{"too large", `[{"id": "` + strings.Repeat("0", 1000) + `"}]`, nil, "response body too large"},
+		{"malformed member", `[{"id": "00u1"}, {"id": 2}]`, nil, `status_code=200: json: cannot unmarshal number`},
+		{"truncated", `[{"id": "00u1"}, {"id": "00`, nil, `unexpected EOF: "[{\"id\": \"00u1\"}, {\"id\": \"00"`},
+		{"not an array", `{"errorCode": "E0000006"}`, nil, "expected an array of group members"},
+		{"trailing data", `[{"id": "00u1"}] []`, nil, "unexpected data after the group members"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body.Store(tc.body)
+			users, err := p.GroupMembers(context.Background(), "00g1")
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			userIDs := []string{}
+			for _, user := range users {
+				userIDs = append(userIDs, user.Id)
+			}
+			assert.Equal(t, tc.want, userIDs)
+		})
+	}
+
+	body.Store(`[{"id": "` + strings.Repeat("0", 1000) + `"}]`)
+	_, err := p.GroupMembers(context.Background(), "00g1")
+	assert.True(t, errors.Is(err, errResponseTooLarge), "the max response bytes should apply to streamed pages")
+	var decodeErr *decodeError
+	assert.False(t, errors.As(err, &decodeErr), "a page which is too large isn't a decode error")
+}
+
+// BenchmarkDecodeGroupMembers compares the memory used to decode a large page of group members from a
+// buffered copy of the body with decoding it as it's read.
+func BenchmarkDecodeGroupMembers(b *testing.B) {
+	members := make([]M, maxGroupUsersBatchSize)
+	for i := range members {
+		members[i] = M{
+			"id":     fmt.Sprintf("00u%017d", i),
+			"status": userStatusActive,
+			"profile": M{
+				"login": fmt.Sprintf("user%d@example.com", i),
+				"email": fmt.Sprintf("user%d@example.com", i),
+			},
+		}
+	}
+	page, err := json.Marshal(members)
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := New(WithMaxResponseBytes(defaultMaxResponseBytes))
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf, err := ioutil.ReadAll(bytes.NewReader(page))
+			if err != nil {
+				b.Fatal(err)
+			}
+			var out []groupMember
+			if err := json.Unmarshal(buf, &out); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("streaming", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var out groupMemberPage
+			if err := p.decodeStream(bytes.NewReader(page), &out, http.StatusOK, "", "group users"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
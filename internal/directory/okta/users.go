@@ -0,0 +1,227 @@
+package okta
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// A userGroup is a group of which a user is a member.
+type userGroup struct {
+	id        string
+	name      string
+	groupType string
+}
+
+// getUserGroups returns the groups of which a user is a member.
+// https://developer.okta.com/docs/reference/api/users/#get-user-s-groups
+func (p *Provider) getUserGroups(ctx context.Context, userID string) ([]userGroup, error) {
+	u := &url.URL{Path: fmt.Sprintf("/api/v1/users/%s/groups", url.PathEscape(userID))}
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.batchSize("user groups", maxGroupsBatchSize)))
+	u.RawQuery = q.Encode()
+
+	var groups []userGroup
+	groupURL := p.cfg.providerURL.ResolveReference(u).String()
+	for groupURL != "" {
+		var out []struct {
+			ID      string                 `json:"id"`
+			Type    string                 `json:"type"`
+			Profile map[string]interface{} `json:"profile"`
+		}
+		hdrs, err := p.apiGet(ctx, groupURL, &out)
+		if err != nil {
+			return nil, fmt.Errorf("okta: error querying for user groups: %w", err)
+		}
+		p.recordPage("user groups", len(out))
+
+		for _, el := range out {
+			if el.ID == "" {
+				continue
+			}
+			groups = append(groups, userGroup{
+				id:        el.ID,
+				name:      p.getProfileField(el.Profile, ProfileFieldName),
+				groupType: el.Type,
+			})
+		}
+		groupURL = getNextLink(hdrs)
+	}
+	return groups, nil
+}
+
+// An updatedUser is a user whose Okta record changed since the previous sync.
+type updatedUser struct {
+	ID      string                 `json:"id"`
+	Status  string                 `json:"status"`
+	Profile map[string]interface{} `json:"profile"`
+}
+
+// getUpdatedUsers returns the users updated since the given time. Deprovisioned users are listed
+// explicitly, since Okta may omit them from listings which don't filter by status.
+// https://developer.okta.com/docs/reference/api/users/#list-users-with-a-filter
+func (p *Provider) getUpdatedUsers(ctx context.Context, since time.Time) ([]updatedUser, error) {
+	lastUpdated := fmt.Sprintf(`lastUpdated gt "%s"`, since.UTC().Format(filterDateFormat))
+	users, err := p.listUsers(ctx, lastUpdated)
+	if err != nil {
+		return nil, err
+	}
+	deprovisioned, err := p.listUsers(ctx, fmt.Sprintf(`status eq "%s" and %s`, userStatusDeprovisioned, lastUpdated))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(users))
+	for _, user := range users {
+		seen[user.ID] = struct{}{}
+	}
+	for _, user := range deprovisioned {
+		if _, ok := seen[user.ID]; !ok {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// listUsers returns the users matching a filter.
+func (p *Provider) listUsers(ctx context.Context, filter string) ([]updatedUser, error) {
+	u := &url.URL{Path: "/api/v1/users"}
+	q := u.Query()
+	q.Set("limit", strconv.Itoa(p.batchSize("users", maxUsersBatchSize)))
+	q.Set("filter", filter)
+	u.RawQuery = q.Encode()
+
+	var users []updatedUser
+	usersURL := p.cfg.providerURL.ResolveReference(u).String()
+	for usersURL != "" {
+		var out []updatedUser
+		hdrs, err := p.apiGet(ctx, usersURL, &out)
+		if err != nil {
+			return nil, fmt.Errorf("okta: error querying for updated users: %w", err)
+		}
+		p.recordPage("users", len(out))
+		for _, el := range out {
+			if el.ID != "" {
+				users = append(users, el)
+			}
+		}
+		usersURL = getNextLink(hdrs)
+	}
+	return users, nil
+}
+
+// mergeUpdatedUsers merges the users updated since the given time into the members of each group. Updated
+// users are removed from every group, then added back to the known groups they are currently members of,
+// unless they are excluded by the active users only or exclude guests options. Deprovisioned users aren't
+// added back, and their ids are returned as tombstones, since they would otherwise only be noticed by
+// reconciling snapshots.
+func (p *Provider) mergeUpdatedUsers(ctx context.Context, since time.Time, groupIDToMemberIDs map[string][]string) (deprovisionedUserIDs []string, err error) {
+	users, err := p.getUpdatedUsers(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, len(users))
+	for i, user := range users {
+		userIDs[i] = user.ID
+	}
+	excludeMembers(groupIDToMemberIDs, userIDs)
+
+	for _, user := range users {
+		if user.Status == userStatusDeprovisioned {
+			deprovisionedUserIDs = append(deprovisionedUserIDs, p.getUserID(user.ID))
+			continue
+		}
+		if p.cfg.activeUsersOnly && user.Status != "" && user.Status != userStatusActive {
+			continue
+		}
+		if p.cfg.excludeGuests && p.cfg.guestPredicate != nil && p.cfg.guestPredicate(user.Profile) {
+			continue
+		}
+
+		groups, err := p.getUserGroups(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			if ids, ok := groupIDToMemberIDs[group.id]; ok {
+				groupIDToMemberIDs[group.id] = append(ids, user.ID)
+			}
+		}
+	}
+	return deprovisionedUserIDs, nil
+}
+
+// saveGroupMemberIDs keeps the members of each group for the next incremental sync, or for groups skipped by
+// the next sync because of the priority groups option. Truncated groups are not kept, so they are always
+// listed again.
+func (p *Provider) saveGroupMemberIDs(groupIDToMemberIDs map[string][]string, truncatedGroupIDs map[string]struct{}) {
+	p.groupMemberIDs = make(map[string][]string, len(groupIDToMemberIDs))
+	for groupID, ids := range groupIDToMemberIDs {
+		if _, truncated := truncatedGroupIDs[groupID]; !truncated {
+			p.groupMemberIDs[groupID] = append([]string(nil), ids...)
+		}
+	}
+}
+
+// getOnlyUsers resolves the users of the only users option and returns them with the groups they are
+// members of.
+func (p *Provider) getOnlyUsers(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	groups := map[string]*directory.Group{}
+	var users []*directory.User
+	for _, idOrLogin := range p.cfg.onlyUsers {
+		var out struct {
+			ID      string                 `json:"id"`
+			Profile map[string]interface{} `json:"profile"`
+		}
+		userURL := p.cfg.providerURL.ResolveReference(&url.URL{
+			Path: fmt.Sprintf("/api/v1/users/%s", url.PathEscape(idOrLogin)),
+		}).String()
+		if _, err := p.apiGet(ctx, userURL, &out); err != nil {
+			return nil, nil, fmt.Errorf("okta: error querying for user %s: %w", idOrLogin, err)
+		}
+
+		userGroups, err := p.getUserGroups(ctx, out.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		groupIDs := make([]string, 0, len(userGroups))
+		for _, userGroup := range userGroups {
+			group := p.newGroup(userGroup.id, userGroup.name, userGroup.groupType)
+			groups[group.Id] = group
+			groupIDs = append(groupIDs, group.Id)
+		}
+		if p.cfg.loginAlias {
+			p.setUserAliases(out.ID, out.Profile)
+		}
+		users = append(users, &directory.User{
+			Id:       p.getUserID(out.ID),
+			Source:   Name,
+			GroupIds: sortedUnique(groupIDs),
+			Aliases:  p.getUserAliases(out.ID),
+		})
+	}
+
+	if p.cfg.resolveMFAStatus {
+		if err := p.resolveMFAStatus(ctx, users); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sortedGroups := make([]*directory.Group, 0, len(groups))
+	for _, group := range groups {
+		sortedGroups = append(sortedGroups, group)
+	}
+	sort.Slice(sortedGroups, func(i, j int) bool {
+		return sortedGroups[i].Id < sortedGroups[j].Id
+	})
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Id < users[j].Id
+	})
+	return sortedGroups, users, nil
+}
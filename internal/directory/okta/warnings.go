@@ -0,0 +1,70 @@
+package okta
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+type warningKey struct {
+	code      directory.WarningCode
+	subjectID string
+}
+
+// syncWarnings collects the warnings of a sync. A warning with the same code and subject as an earlier
+// one is ignored, and a nil syncWarnings ignores every warning.
+type syncWarnings struct {
+	warnings map[warningKey]directory.Warning
+}
+
+func newSyncWarnings() *syncWarnings {
+	return &syncWarnings{
+		warnings: make(map[warningKey]directory.Warning),
+	}
+}
+
+func (w *syncWarnings) add(code directory.WarningCode, subjectID, format string, args ...interface{}) {
+	if w == nil {
+		return
+	}
+	key := warningKey{code: code, subjectID: subjectID}
+	if _, ok := w.warnings[key]; ok {
+		return
+	}
+	w.warnings[key] = directory.Warning{
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+		SubjectID: subjectID,
+	}
+}
+
+// merge adds the warnings of other.
+func (w *syncWarnings) merge(other *syncWarnings) {
+	if w == nil || other == nil {
+		return
+	}
+	for key, warning := range other.warnings {
+		if _, ok := w.warnings[key]; !ok {
+			w.warnings[key] = warning
+		}
+	}
+}
+
+// list returns the warnings sorted by code and subject.
+func (w *syncWarnings) list() []directory.Warning {
+	if len(w.warnings) == 0 {
+		return nil
+	}
+	warnings := make([]directory.Warning, 0, len(w.warnings))
+	for _, warning := range w.warnings {
+		warnings = append(warnings, warning)
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Code != warnings[j].Code {
+			return warnings[i].Code < warnings[j].Code
+		}
+		return warnings[i].SubjectID < warnings[j].SubjectID
+	})
+	return warnings
+}
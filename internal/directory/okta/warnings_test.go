@@ -0,0 +1,61 @@
+package okta
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+func TestProvider_UserGroupsWarnings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/groups":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "admin", "profile": M{"name": "admin-name"}},
+				{"id": "deleted", "profile": M{"name": "deleted-name"}},
+				{"profile": M{"name": "malformed-name"}},
+			})
+		case "/api/v1/groups/admin/users":
+			_ = json.NewEncoder(w).Encode([]M{
+				{"id": "a@example.com"},
+				{"profile": M{"email": "malformed@example.com"}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := New(
+		WithServiceAccount(&ServiceAccount{APIKey: "APITOKEN"}),
+		WithProviderURL(mustParseURL(srv.URL)),
+		WithQPS(100),
+	)
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*directory.Group{
+		{Id: "admin", Name: "admin-name", AltIds: []string{"admin-name"}, MemberCount: 1},
+	}, groups)
+	assert.Equal(t, []*directory.User{
+		{Id: "okta/a@example.com", Source: "okta", GroupIds: []string{"admin"}},
+	}, users)
+
+	var codes []directory.WarningCode
+	var subjectIDs []string
+	for _, warning := range p.SyncReport().Warnings {
+		codes = append(codes, warning.Code)
+		subjectIDs = append(subjectIDs, warning.SubjectID)
+	}
+	assert.Equal(t, []directory.WarningCode{
+		directory.WarningCodeGroupNotFound,
+		directory.WarningCodeMalformedRecord,
+		directory.WarningCodeMalformedRecord,
+	}, codes)
+	assert.Equal(t, []string{"deleted", "", "admin"}, subjectIDs)
+}
@@ -122,6 +122,7 @@ func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*direc
 		sort.Strings(groupIDs)
 		users = append(users, &directory.User{
 			Id:       databroker.GetUserID(Name, strconv.Itoa(userID)),
+			Source:   Name,
 			GroupIds: groupIDs,
 		})
 	}
@@ -299,6 +300,11 @@ func ParseServiceAccount(rawServiceAccount string) (*ServiceAccount, error) {
 		return nil, err
 	}
 
+	serviceAccount.ClientSecret, err = directory.ExpandEnv(serviceAccount.ClientSecret)
+	if err != nil {
+		return nil, fmt.Errorf("client_secret: %w", err)
+	}
+
 	if serviceAccount.ClientID == "" {
 		return nil, fmt.Errorf("client_id is required")
 	}
@@ -150,9 +150,9 @@ func TestProvider_UserGroups(t *testing.T) {
 	groups, users, err := p.UserGroups(context.Background())
 	assert.NoError(t, err)
 	testutil.AssertProtoJSONEqual(t, `[
-		{ "id": "onelogin/111", "groupIds": ["0"] },
-		{ "id": "onelogin/222", "groupIds": ["1"] },
-		{ "id": "onelogin/333", "groupIds": ["2"] }
+		{ "id": "onelogin/111", "source": "onelogin", "groupIds": ["0"] },
+		{ "id": "onelogin/222", "source": "onelogin", "groupIds": ["1"] },
+		{ "id": "onelogin/333", "source": "onelogin", "groupIds": ["2"] }
 	]`, users)
 	testutil.AssertProtoJSONEqual(t, `[
 		{ "id": "0", "name": "admin" },
@@ -0,0 +1,166 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// defaultSyncInterval is the default amount of time between the syncs of a provider run by a SyncOrchestrator.
+const defaultSyncInterval = 10 * time.Minute
+
+// ErrSuspiciousEmptyResult is returned when a provider syncs no users or no groups after a sync which had
+// some, and the reject empty results option is enabled.
+var ErrSuspiciousEmptyResult = errors.New("directory: refusing to replace the previous sync with an empty result")
+
+// CheckEmptyResult returns an error wrapping ErrSuspiciousEmptyResult if a sync of a provider has no groups
+// or no users, but its previous sync had some.
+func CheckEmptyResult(previousGroups, previousUsers, groups, users int) error {
+	if (groups == 0 && previousGroups > 0) || (users == 0 && previousUsers > 0) {
+		return fmt.Errorf("%w: synced %d groups and %d users, previously %d groups and %d users",
+			ErrSuspiciousEmptyResult, groups, users, previousGroups, previousUsers)
+	}
+	return nil
+}
+
+type syncConfig struct {
+	interval           time.Duration
+	rejectEmptyResults bool
+}
+
+// A SyncOption customizes how a SyncOrchestrator syncs a provider.
+type SyncOption func(cfg *syncConfig)
+
+// WithRejectEmptyResults sets the reject empty results option. When enabled, a sync without any users or
+// without any groups, such as one caused by a transient permission problem, doesn't replace the previous
+// result of the provider if it had some, so access isn't revoked en masse. It defaults to true.
+func WithRejectEmptyResults(rejectEmptyResults bool) SyncOption {
+	return func(cfg *syncConfig) {
+		cfg.rejectEmptyResults = rejectEmptyResults
+	}
+}
+
+// WithSyncInterval sets the amount of time between the syncs of a provider, so each provider can be synced
+// at a cadence its rate limits allow. It defaults to 10 minutes.
+func WithSyncInterval(interval time.Duration) SyncOption {
+	return func(cfg *syncConfig) {
+		cfg.interval = interval
+	}
+}
+
+type orchestratedProvider struct {
+	provider Provider
+	cfg      *syncConfig
+}
+
+type syncResult struct {
+	groups []*Group
+	users  []*User
+}
+
+// A SyncOrchestrator syncs several providers, each on its own interval, into a shared Sink.
+type SyncOrchestrator struct {
+	sink      Sink
+	providers []*orchestratedProvider
+
+	mu      sync.Mutex
+	results map[*orchestratedProvider]*syncResult
+}
+
+// NewSyncOrchestrator creates a new SyncOrchestrator which writes to sink.
+func NewSyncOrchestrator(sink Sink) *SyncOrchestrator {
+	return &SyncOrchestrator{
+		sink:    sink,
+		results: make(map[*orchestratedProvider]*syncResult),
+	}
+}
+
+// Add adds a provider to the orchestrator. It must be called before Run.
+func (o *SyncOrchestrator) Add(provider Provider, options ...SyncOption) {
+	cfg := new(syncConfig)
+	WithRejectEmptyResults(true)(cfg)
+	WithSyncInterval(defaultSyncInterval)(cfg)
+	for _, option := range options {
+		option(cfg)
+	}
+	o.providers = append(o.providers, &orchestratedProvider{provider: provider, cfg: cfg})
+}
+
+// Run syncs each provider right away and then on its interval, until ctx is done. Since a Sink replaces
+// the records of the previous write, every sync writes the most recent users and groups of all the
+// providers, in the order they were added. A provider which fails to sync, whose empty result is
+// rejected, or whose result couldn't be written to the sink, keeps its previous result.
+func (o *SyncOrchestrator) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, p := range o.providers {
+		wg.Add(1)
+		go func(p *orchestratedProvider) {
+			defer wg.Done()
+			o.run(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (o *SyncOrchestrator) run(ctx context.Context, p *orchestratedProvider) {
+	ticker := time.NewTicker(p.cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := o.sync(ctx, p); err != nil {
+			log.Warn().Err(err).
+				Str("service", "directory").
+				Str("provider", ProviderName(p.provider)).
+				Msg("failed to sync directory users and groups")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (o *SyncOrchestrator) sync(ctx context.Context, p *orchestratedProvider) error {
+	groups, users, err := p.provider.UserGroups(ctx)
+	if err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if previous, ok := o.results[p]; ok && p.cfg.rejectEmptyResults {
+		if err := CheckEmptyResult(len(previous.groups), len(previous.users), len(groups), len(users)); err != nil {
+			return err
+		}
+	}
+
+	result := &syncResult{groups: groups, users: users}
+	var allGroups []*Group
+	var allUsers []*User
+	for _, other := range o.providers {
+		otherResult, ok := o.results[other]
+		if other == p {
+			otherResult, ok = result, true
+		}
+		if ok {
+			allGroups = append(allGroups, otherResult.groups...)
+			allUsers = append(allUsers, otherResult.users...)
+		}
+	}
+	if err := o.sink.PutGroups(ctx, allGroups); err != nil {
+		return fmt.Errorf("directory: error storing groups: %w", err)
+	}
+	if err := o.sink.PutUsers(ctx, allUsers); err != nil {
+		return fmt.Errorf("directory: error storing users: %w", err)
+	}
+	o.results[p] = result
+	return nil
+}
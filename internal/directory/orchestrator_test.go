@@ -0,0 +1,138 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncOrchestrator(t *testing.T) {
+	var fastSyncs, slowSyncs int32
+	fast := mockProvider{
+		name: "fast",
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			if atomic.AddInt32(&fastSyncs, 1) == 2 {
+				return nil, nil, errors.New("unavailable")
+			}
+			return []*Group{{Id: "fast/group"}}, []*User{{Id: "fast/user"}}, nil
+		},
+	}
+	slow := mockProvider{
+		name: "slow",
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			atomic.AddInt32(&slowSyncs, 1)
+			return []*Group{{Id: "slow/group"}}, []*User{{Id: "slow/user"}}, nil
+		},
+	}
+
+	sink := NewMemorySink()
+	o := NewSyncOrchestrator(sink)
+	o.Add(slow, WithSyncInterval(time.Hour))
+	o.Add(fast, WithSyncInterval(10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- o.Run(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&fastSyncs) >= 3
+	}, 5*time.Second, 10*time.Millisecond, "the fast provider should sync on its own interval")
+	cancel()
+	assert.True(t, errors.Is(<-errc, context.Canceled))
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowSyncs), "the slow provider should only have synced once")
+	var groupIDs, userIDs []string
+	for _, group := range sink.Groups() {
+		groupIDs = append(groupIDs, group.Id)
+	}
+	for _, user := range sink.Users() {
+		userIDs = append(userIDs, user.Id)
+	}
+	assert.Equal(t, []string{"slow/group", "fast/group"}, groupIDs, "the sink should have the groups of both providers")
+	assert.Equal(t, []string{"slow/user", "fast/user"}, userIDs, "the sink should have the users of both providers")
+}
+
+func TestSyncOrchestrator_RejectEmptyResults(t *testing.T) {
+	ctx := context.Background()
+	var groups []*Group
+	var users []*User
+	provider := mockProvider{
+		name: "flaky",
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			return groups, users, nil
+		},
+	}
+
+	t.Run("rejected", func(t *testing.T) {
+		sink := NewMemorySink()
+		o := NewSyncOrchestrator(sink)
+		o.Add(provider)
+		p := o.providers[0]
+
+		groups, users = nil, nil
+		assert.NoError(t, o.sync(ctx, p), "an empty first sync should be accepted")
+
+		groups, users = []*Group{{Id: "user"}}, []*User{{Id: "okta/user1", GroupIds: []string{"user"}}}
+		assert.NoError(t, o.sync(ctx, p))
+
+		groups, users = nil, nil
+		err := o.sync(ctx, p)
+		assert.True(t, errors.Is(err, ErrSuspiciousEmptyResult), "expected a suspicious empty result error, got %v", err)
+		assert.Len(t, sink.Groups(), 1, "the previous groups should be kept")
+		assert.Len(t, sink.Users(), 1, "the previous users should be kept")
+	})
+	t.Run("allowed", func(t *testing.T) {
+		sink := NewMemorySink()
+		o := NewSyncOrchestrator(sink)
+		o.Add(provider, WithRejectEmptyResults(false))
+		p := o.providers[0]
+
+		groups, users = []*Group{{Id: "user"}}, []*User{{Id: "okta/user1", GroupIds: []string{"user"}}}
+		assert.NoError(t, o.sync(ctx, p))
+
+		groups, users = nil, nil
+		assert.NoError(t, o.sync(ctx, p))
+		assert.Empty(t, sink.Groups())
+		assert.Empty(t, sink.Users())
+	})
+}
+
+type failingSink struct {
+	*MemorySink
+	err error
+}
+
+func (sink *failingSink) PutUsers(ctx context.Context, users []*User) error {
+	if sink.err != nil {
+		return sink.err
+	}
+	return sink.MemorySink.PutUsers(ctx, users)
+}
+
+func TestSyncOrchestrator_SinkError(t *testing.T) {
+	ctx := context.Background()
+	var groups []*Group
+	var users []*User
+	provider := mockProvider{
+		name: "flaky",
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			return groups, users, nil
+		},
+	}
+	errUnavailable := errors.New("unavailable")
+	sink := &failingSink{MemorySink: NewMemorySink(), err: errUnavailable}
+	o := NewSyncOrchestrator(sink)
+	o.Add(provider)
+	p := o.providers[0]
+
+	groups, users = []*Group{{Id: "user"}}, []*User{{Id: "okta/user1", GroupIds: []string{"user"}}}
+	assert.True(t, errors.Is(o.sync(ctx, p), errUnavailable), "the sink error should be returned")
+
+	sink.err = nil
+	groups, users = nil, nil
+	assert.NoError(t, o.sync(ctx, p), "a result which wasn't stored should not count as the previous sync")
+}
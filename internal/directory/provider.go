@@ -3,17 +3,11 @@ package directory
 
 import (
 	"context"
-	"net/url"
 	"sync"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
-	"github.com/pomerium/pomerium/internal/directory/azure"
-	"github.com/pomerium/pomerium/internal/directory/github"
-	"github.com/pomerium/pomerium/internal/directory/gitlab"
-	"github.com/pomerium/pomerium/internal/directory/google"
-	"github.com/pomerium/pomerium/internal/directory/okta"
-	"github.com/pomerium/pomerium/internal/directory/onelogin"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/pkg/grpc/directory"
 )
@@ -27,11 +21,137 @@ type User = directory.User
 // Options are the options specific to the provider.
 type Options = directory.Options
 
+// A RateLimiter is a token bucket rate limiter which can be shared by providers.
+type RateLimiter = directory.RateLimiter
+
+// NewRateLimiter creates a new RateLimiter which allows qps requests per second with bursts of up to burst
+// requests.
+func NewRateLimiter(qps float64, burst int) *RateLimiter {
+	return directory.NewRateLimiter(qps, burst)
+}
+
+// A BackoffStrategy decides how long a provider waits before retrying a request.
+type BackoffStrategy = directory.BackoffStrategy
+
+// NewConstantBackoff creates a BackoffStrategy which waits the same delay before every attempt.
+func NewConstantBackoff(delay time.Duration) BackoffStrategy {
+	return directory.NewConstantBackoff(delay)
+}
+
+// NewExponentialBackoff creates a BackoffStrategy whose jittered delay doubles with every attempt, starting
+// at base and capped at max.
+func NewExponentialBackoff(base, max time.Duration) BackoffStrategy {
+	return directory.NewExponentialBackoff(base, max)
+}
+
+// ErrConfig is wrapped by the errors returned when a provider is created with missing or invalid options.
+var ErrConfig = directory.ErrConfig
+
+// Redact masks token-like substrings in an error's message, as well as any of the given secrets, so they
+// aren't leaked to callers or logs.
+func Redact(err error, secrets ...string) error {
+	return directory.Redact(err, secrets...)
+}
+
+// WithTenant returns a copy of ctx carrying the tenant or route which requested a sync. Providers may
+// include it in their logs and sync reports.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return directory.WithTenant(ctx, tenant)
+}
+
+// TenantFromContext returns the tenant or route which requested a sync, or "" if it isn't known.
+func TenantFromContext(ctx context.Context) string {
+	return directory.TenantFromContext(ctx)
+}
+
+// WithDeadlineBudget returns a copy of ctx carrying a budget for the rest of a sync, starting now. The
+// budget doesn't cancel ctx, but providers don't retry or start requests which wouldn't complete within it.
+// When ctx also has a deadline, whichever is earlier applies.
+func WithDeadlineBudget(ctx context.Context, budget time.Duration) context.Context {
+	return directory.WithDeadlineBudget(ctx, budget)
+}
+
+// DeadlineFromContext returns the earlier of the deadline of ctx and the end of its deadline budget.
+func DeadlineFromContext(ctx context.Context) (deadline time.Time, ok bool) {
+	return directory.DeadlineFromContext(ctx)
+}
+
+// A Cursor is the incremental sync state of a provider, which is persisted so incremental syncs resume after
+// a restart.
+type Cursor = directory.Cursor
+
+// WithCursor returns a copy of ctx carrying the marshaled cursor of a previous sync. Providers which support
+// cursors resume from it if they haven't synced yet.
+func WithCursor(ctx context.Context, cursor []byte) context.Context {
+	return directory.WithCursor(ctx, cursor)
+}
+
+// CursorFromContext returns the marshaled cursor of a previous sync, or nil if there is none.
+func CursorFromContext(ctx context.Context) []byte {
+	return directory.CursorFromContext(ctx)
+}
+
+// A UserDiff describes the changes between two snapshots of directory users.
+type UserDiff = directory.UserDiff
+
+// DiffUsers compares two snapshots of directory users by id.
+func DiffUsers(previous, current []*User) UserDiff {
+	return directory.DiffUsers(previous, current)
+}
+
+// A MembershipDiff describes the changes to the members of a group between two snapshots of directory users.
+type MembershipDiff = directory.MembershipDiff
+
+// DiffMemberships compares the group memberships of two snapshots of directory users.
+func DiffMemberships(previous, current []*User) map[string]MembershipDiff {
+	return directory.DiffMemberships(previous, current)
+}
+
+// A SyncReport describes the most recent sync performed by a provider.
+type SyncReport = directory.SyncReport
+
+// A Warning is a problem which did not prevent a sync from completing.
+type Warning = directory.Warning
+
 // A Provider provides user group directory information.
 type Provider interface {
 	UserGroups(ctx context.Context) ([]*Group, []*User, error)
 }
 
+// A SyncReporter is a Provider which reports details about its most recent sync.
+type SyncReporter interface {
+	SyncReport() *SyncReport
+}
+
+// A CursorProvider is a Provider which can resume incremental syncs from a Cursor.
+type CursorProvider interface {
+	// Cursor returns the state of the most recent sync, or nil if there hasn't been one.
+	Cursor() Cursor
+}
+
+// A UserRefresher is a Provider which can retrieve the groups of a single user without a full sync, such as
+// right after the user first authenticates.
+type UserRefresher interface {
+	RefreshUser(ctx context.Context, userID string) (*User, error)
+}
+
+// A MembershipChecker is a Provider which can check whether a user is a member of a group without a full
+// sync, such as to answer a single policy evaluation with an up to date membership.
+type MembershipChecker interface {
+	IsMember(ctx context.Context, userID, groupID string) (bool, error)
+}
+
+// A GroupMembersLister is a Provider which can retrieve the members of a single group without a full sync,
+// such as to answer an admin query about who is in a group.
+type GroupMembersLister interface {
+	GroupMembers(ctx context.Context, groupID string) ([]*User, error)
+}
+
+// A GroupLister is a Provider which can list its groups without retrieving their members.
+type GroupLister interface {
+	ListGroups(ctx context.Context) ([]*Group, error)
+}
+
 var globalProvider = struct {
 	sync.Mutex
 	provider Provider
@@ -52,82 +172,34 @@ func GetProvider(options Options) (provider Provider) {
 		globalProvider.options = options
 	}()
 
-	switch options.Provider {
-	case azure.Name:
-		serviceAccount, err := azure.ParseServiceAccount(options)
-		if err == nil {
-			return azure.New(azure.WithServiceAccount(serviceAccount))
-		}
-		log.Warn().
-			Str("service", "directory").
-			Str("provider", options.Provider).
-			Err(err).
-			Msg("invalid service account for azure directory provider")
-	case github.Name:
-		serviceAccount, err := github.ParseServiceAccount(options.ServiceAccount)
-		if err == nil {
-			return github.New(github.WithServiceAccount(serviceAccount))
-		}
-		log.Warn().
-			Str("service", "directory").
-			Str("provider", options.Provider).
-			Err(err).
-			Msg("invalid service account for github directory provider")
-	case gitlab.Name:
-		serviceAccount, err := gitlab.ParseServiceAccount(options.ServiceAccount)
-		if err == nil {
-			return gitlab.New(gitlab.WithServiceAccount(serviceAccount))
-		}
-		log.Warn().
-			Str("service", "directory").
-			Str("provider", options.Provider).
-			Err(err).
-			Msg("invalid service account for gitlab directory provider")
-	case google.Name:
-		serviceAccount, err := google.ParseServiceAccount(options.ServiceAccount)
+	if factory, ok := getFactory(options.Provider); ok {
+		provider, err := factory(options)
 		if err == nil {
-			return google.New(google.WithServiceAccount(serviceAccount))
+			return provider
 		}
 		log.Warn().
 			Str("service", "directory").
 			Str("provider", options.Provider).
 			Err(err).
-			Msg("invalid service account for google directory provider")
-	case okta.Name:
-		providerURL, _ := url.Parse(options.ProviderURL)
-		serviceAccount, err := okta.ParseServiceAccount(options.ServiceAccount)
-		if err == nil {
-			return okta.New(
-				okta.WithProviderURL(providerURL),
-				okta.WithServiceAccount(serviceAccount),
-				okta.WithQPS(options.QPS),
-			)
-		}
-		log.Warn().
-			Str("service", "directory").
-			Str("provider", options.Provider).
-			Err(err).
-			Msg("invalid service account for okta directory provider")
-	case onelogin.Name:
-		serviceAccount, err := onelogin.ParseServiceAccount(options.ServiceAccount)
-		if err == nil {
-			return onelogin.New(onelogin.WithServiceAccount(serviceAccount))
-		}
-		log.Warn().
-			Str("service", "directory").
-			Str("provider", options.Provider).
-			Err(err).
-			Msg("invalid service account for onelogin directory provider")
+			Msg("failed to create directory provider")
 	}
 
 	log.Warn().
 		Str("provider", options.Provider).
 		Msg("no directory provider implementation found, disabling support for groups")
-	return nullProvider{}
+	return NoopProvider{}
 }
 
-type nullProvider struct{}
+// A NoopProvider is a Provider for when no directory is configured. It has no users or groups, and is
+// always healthy. Verifier is the only optional provider interface it implements.
+type NoopProvider struct{}
 
-func (nullProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+// UserGroups returns no users or groups.
+func (NoopProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
 	return nil, nil, nil
 }
+
+// Verify always succeeds.
+func (NoopProvider) Verify(ctx context.Context) error {
+	return nil
+}
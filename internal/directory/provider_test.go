@@ -0,0 +1,26 @@
+package directory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoopProvider(t *testing.T) {
+	var p Provider = NoopProvider{}
+
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, groups)
+	assert.Empty(t, users)
+
+	assert.NoError(t, HealthCheck(context.Background(), []Provider{p})["directory.NoopProvider"])
+
+	_, ok := p.(SyncReporter)
+	assert.False(t, ok, "should not report syncs")
+	_, ok = p.(UserRefresher)
+	assert.False(t, ok, "should not refresh users")
+	_, ok = p.(MembershipChecker)
+	assert.False(t, ok, "should not check memberships")
+}
@@ -0,0 +1,115 @@
+package directory
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/pomerium/pomerium/internal/directory/azure"
+	"github.com/pomerium/pomerium/internal/directory/github"
+	"github.com/pomerium/pomerium/internal/directory/gitlab"
+	"github.com/pomerium/pomerium/internal/directory/google"
+	"github.com/pomerium/pomerium/internal/directory/okta"
+	"github.com/pomerium/pomerium/internal/directory/onelogin"
+)
+
+// A Factory creates a Provider from the provider options.
+type Factory func(options Options) (Provider, error)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[string]Factory
+}{
+	factories: make(map[string]Factory),
+}
+
+// Register makes a provider available by name to GetProvider. If Register is called twice with the same
+// name or if factory is nil, it panics.
+func Register(name string, factory Factory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if factory == nil {
+		panic("directory: Register factory is nil")
+	}
+	if _, dup := registry.factories[name]; dup {
+		panic("directory: Register called twice for provider " + name)
+	}
+	registry.factories[name] = factory
+}
+
+// Providers returns the sorted names of the registered providers.
+func Providers() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]string, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func getFactory(name string) (Factory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	factory, ok := registry.factories[name]
+	return factory, ok
+}
+
+func init() {
+	Register(azure.Name, func(options Options) (Provider, error) {
+		serviceAccount, err := azure.ParseServiceAccount(options)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account for azure directory provider: %w", err)
+		}
+		return azure.New(azure.WithServiceAccount(serviceAccount)), nil
+	})
+	Register(github.Name, func(options Options) (Provider, error) {
+		serviceAccount, err := github.ParseServiceAccount(options.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account for github directory provider: %w", err)
+		}
+		return github.New(github.WithServiceAccount(serviceAccount)), nil
+	})
+	Register(gitlab.Name, func(options Options) (Provider, error) {
+		serviceAccount, err := gitlab.ParseServiceAccount(options.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account for gitlab directory provider: %w", err)
+		}
+		return gitlab.New(gitlab.WithServiceAccount(serviceAccount)), nil
+	})
+	Register(google.Name, func(options Options) (Provider, error) {
+		serviceAccount, err := google.ParseServiceAccount(options.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account for google directory provider: %w", err)
+		}
+		return google.New(google.WithServiceAccount(serviceAccount)), nil
+	})
+	Register(okta.Name, func(options Options) (Provider, error) {
+		providerURL, _ := url.Parse(options.ProviderURL)
+		serviceAccount, err := okta.ParseServiceAccount(options.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account for okta directory provider: %w", err)
+		}
+		provider, err := okta.NewProvider(
+			okta.WithProviderURL(providerURL),
+			okta.WithServiceAccount(serviceAccount),
+			okta.WithQPS(options.QPS),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return provider, nil
+	})
+	Register(onelogin.Name, func(options Options) (Provider, error) {
+		serviceAccount, err := onelogin.ParseServiceAccount(options.ServiceAccount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid service account for onelogin directory provider: %w", err)
+		}
+		return onelogin.New(onelogin.WithServiceAccount(serviceAccount)), nil
+	})
+}
@@ -0,0 +1,40 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegister(t *testing.T) {
+	Register("registry-test", func(options Options) (Provider, error) {
+		if options.ServiceAccount == "" {
+			return nil, errors.New("service account is required")
+		}
+		return mockProvider{
+			name: options.ServiceAccount,
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return []*Group{{Id: "group1"}}, nil, nil
+			},
+		}, nil
+	})
+	assert.Contains(t, Providers(), "registry-test")
+	assert.Contains(t, Providers(), "okta")
+
+	p := GetProvider(Options{Provider: "registry-test", ServiceAccount: "SERVICE_ACCOUNT"})
+	if assert.IsType(t, mockProvider{}, p) {
+		assert.Equal(t, "SERVICE_ACCOUNT", p.(mockProvider).Name())
+	}
+	groups, _, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*Group{{Id: "group1"}}, groups)
+
+	p = GetProvider(Options{Provider: "registry-test"})
+	assert.Equal(t, NoopProvider{}, p)
+
+	assert.Panics(t, func() {
+		Register("registry-test", func(options Options) (Provider, error) { return nil, nil })
+	})
+}
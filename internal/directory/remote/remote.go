@@ -0,0 +1,86 @@
+// Package remote contains a directory provider which retrieves users and groups from an out-of-process
+// directory service over gRPC.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog"
+
+	"github.com/pomerium/pomerium/internal/log"
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// Name is the provider name.
+const Name = "remote"
+
+type config struct {
+	client directory.DirectoryServiceClient
+}
+
+// An Option updates the remote configuration.
+type Option func(cfg *config)
+
+// WithClient sets the directory service client in the config.
+func WithClient(client directory.DirectoryServiceClient) Option {
+	return func(cfg *config) {
+		cfg.client = client
+	}
+}
+
+func getConfig(options ...Option) *config {
+	cfg := new(config)
+	for _, option := range options {
+		option(cfg)
+	}
+	return cfg
+}
+
+// The Provider retrieves users and groups from a remote directory service.
+type Provider struct {
+	cfg *config
+	log zerolog.Logger
+}
+
+// New creates a new Provider.
+func New(options ...Option) *Provider {
+	return &Provider{
+		cfg: getConfig(options...),
+		log: log.With().Str("service", "directory").Str("provider", "remote").Logger(),
+	}
+}
+
+// UserGroups gets the directory user groups from the remote directory service.
+func (p *Provider) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	if p.cfg.client == nil {
+		return nil, nil, fmt.Errorf("remote: client not defined")
+	}
+
+	p.log.Info().Msg("getting user groups")
+
+	stream, err := p.cfg.client.UserGroups(ctx, new(directory.UserGroupsRequest))
+	if err != nil {
+		return nil, nil, fmt.Errorf("remote: error querying user groups: %w", err)
+	}
+
+	var groups []*directory.Group
+	var users []*directory.User
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("remote: error receiving user groups: %w", err)
+		}
+
+		switch result := res.GetResult().(type) {
+		case *directory.UserGroupsResponse_Group:
+			groups = append(groups, result.Group)
+		case *directory.UserGroupsResponse_User:
+			users = append(users, result.User)
+		}
+	}
+	return groups, users, nil
+}
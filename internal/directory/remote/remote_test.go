@@ -0,0 +1,79 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+type mockBackend func(ctx context.Context) ([]*directory.Group, []*directory.User, error)
+
+func (mock mockBackend) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	return mock(ctx)
+}
+
+func newTestClient(t *testing.T, backend Backend) directory.DirectoryServiceClient {
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	directory.RegisterDirectoryServiceServer(srv, NewServer(backend))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return lis.Dial()
+		}),
+		grpc.WithInsecure())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return directory.NewDirectoryServiceClient(conn)
+}
+
+func TestProvider_UserGroups(t *testing.T) {
+	expectedGroups := []*directory.Group{
+		{Id: "admin", Name: "admin-name"},
+		{Id: "user", Name: "user-name"},
+	}
+	expectedUsers := []*directory.User{
+		{Id: "remote/a@example.com", GroupIds: []string{"admin", "user"}},
+		{Id: "remote/b@example.com", GroupIds: []string{"user"}},
+	}
+
+	p := New(WithClient(newTestClient(t, mockBackend(func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+		return expectedGroups, expectedUsers, nil
+	}))))
+	groups, users, err := p.UserGroups(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, groups, len(expectedGroups)) {
+		for i := range groups {
+			assert.True(t, proto.Equal(expectedGroups[i], groups[i]))
+		}
+	}
+	if assert.Len(t, users, len(expectedUsers)) {
+		for i := range users {
+			assert.True(t, proto.Equal(expectedUsers[i], users[i]))
+		}
+	}
+
+	t.Run("error", func(t *testing.T) {
+		p := New(WithClient(newTestClient(t, mockBackend(func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+			return nil, nil, errors.New("unavailable")
+		}))))
+		_, _, err := p.UserGroups(context.Background())
+		assert.Error(t, err)
+	})
+
+	t.Run("no client", func(t *testing.T) {
+		_, _, err := New().UserGroups(context.Background())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"context"
+
+	"github.com/pomerium/pomerium/pkg/grpc/directory"
+)
+
+// A Backend provides the users and groups served by a Server.
+type Backend interface {
+	UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error)
+}
+
+// A Server implements the directory service using a Backend.
+type Server struct {
+	backend Backend
+}
+
+// NewServer creates a new Server.
+func NewServer(backend Backend) *Server {
+	return &Server{backend: backend}
+}
+
+// UserGroups streams all of the groups, followed by all of the users, from the backend.
+func (srv *Server) UserGroups(req *directory.UserGroupsRequest, stream directory.DirectoryService_UserGroupsServer) error {
+	groups, users, err := srv.backend.UserGroups(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		err := stream.Send(&directory.UserGroupsResponse{
+			Result: &directory.UserGroupsResponse_Group{Group: group},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, user := range users {
+		err := stream.Send(&directory.UserGroupsResponse{
+			Result: &directory.UserGroupsResponse_User{User: user},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
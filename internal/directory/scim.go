@@ -0,0 +1,271 @@
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// SCIM 2.0 schema URNs, see https://tools.ietf.org/html/rfc7643 and https://tools.ietf.org/html/rfc7644
+const (
+	scimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// The default and maximum number of resources returned in a page of a SCIM listing.
+const (
+	defaultSCIMPageSize = 100
+	maxSCIMPageSize     = 1000
+)
+
+// scimFilterRE matches the SCIM filters supported by the SCIM handler: a single attribute compared for
+// equality with a string, such as `displayName eq "admin"`.
+var scimFilterRE = regexp.MustCompile(`(?i)^\s*([a-z]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// scimFilterAttributes are the lowercased attributes of each resource type which can be filtered on.
+var scimFilterAttributes = map[string]map[string]bool{
+	"Users":  {"id": true, "username": true},
+	"Groups": {"id": true, "displayname": true},
+}
+
+// SCIMHandler returns an http.Handler which exposes the users and groups of a provider through the
+// read-only SCIM 2.0 /Users and /Groups endpoints, relative to wherever it is mounted. Listings support
+// the startIndex and count pagination parameters, and filters on a single attribute with the eq
+// operator. Every request calls UserGroups, so slow providers should be wrapped in a CachingProvider.
+func SCIMHandler(provider Provider) http.Handler {
+	return &scimHandler{provider: provider}
+}
+
+type scimHandler struct {
+	provider Provider
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int           `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Version      string `json:"version,omitempty"`
+}
+
+type scimUser struct {
+	Schemas []string     `json:"schemas"`
+	ID      string       `json:"id"`
+	Name    string       `json:"userName"`
+	Groups  []scimMember `json:"groups,omitempty"`
+	Meta    scimMeta     `json:"meta"`
+}
+
+type scimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []scimMember `json:"members,omitempty"`
+	Meta        scimMeta     `json:"meta"`
+}
+
+type scimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+type scimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	SCIMType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
+
+// ServeHTTP serves an http request.
+func (h *scimHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeSCIMError(w, http.StatusMethodNotAllowed, "", "the directory is read-only")
+		return
+	}
+
+	// the ids of users, such as okta/00u1, are escaped in the path
+	segments := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	resourceType, id := segments[len(segments)-1], ""
+	if len(segments) > 1 && (segments[len(segments)-2] == "Users" || segments[len(segments)-2] == "Groups") {
+		resourceType = segments[len(segments)-2]
+		var err error
+		if id, err = url.PathUnescape(segments[len(segments)-1]); err != nil {
+			writeSCIMError(w, http.StatusBadRequest, "", "invalid resource id")
+			return
+		}
+	}
+	if resourceType != "Users" && resourceType != "Groups" {
+		writeSCIMError(w, http.StatusNotFound, "", "unknown endpoint")
+		return
+	}
+
+	groups, users, err := h.provider.UserGroups(r.Context())
+	if err != nil {
+		log.Warn().Err(err).Str("service", "directory").Msg("failed to get user groups for scim")
+		writeSCIMError(w, http.StatusInternalServerError, "", "the directory is unavailable")
+		return
+	}
+
+	var resources []interface{}
+	var attributes []map[string]string
+	if resourceType == "Users" {
+		for _, user := range newSCIMUsers(groups, users) {
+			resources = append(resources, user)
+			attributes = append(attributes, map[string]string{"id": user.ID, "username": user.Name})
+		}
+	} else {
+		for _, group := range newSCIMGroups(groups, users) {
+			resources = append(resources, group)
+			attributes = append(attributes, map[string]string{"id": group.ID, "displayname": group.DisplayName})
+		}
+	}
+
+	if id != "" {
+		for i := range resources {
+			if attributes[i]["id"] == id {
+				writeSCIM(w, http.StatusOK, resources[i])
+				return
+			}
+		}
+		writeSCIMError(w, http.StatusNotFound, "", fmt.Sprintf("resource %s not found", id))
+		return
+	}
+
+	if filter := r.URL.Query().Get("filter"); filter != "" {
+		m := scimFilterRE.FindStringSubmatch(filter)
+		if m == nil {
+			writeSCIMError(w, http.StatusBadRequest, "invalidFilter", "only filters of the form `attribute eq \"value\"` are supported")
+			return
+		}
+		attribute, value := strings.ToLower(m[1]), strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(m[2])
+		if !scimFilterAttributes[resourceType][attribute] {
+			writeSCIMError(w, http.StatusBadRequest, "invalidFilter", fmt.Sprintf("unsupported filter attribute %s", m[1]))
+			return
+		}
+		var filtered []interface{}
+		for i := range resources {
+			if attributes[i][attribute] == value {
+				filtered = append(filtered, resources[i])
+			}
+		}
+		resources = filtered
+	}
+
+	startIndex, count := getSCIMPagination(r.URL.Query())
+	page := []interface{}{}
+	if startIndex <= len(resources) {
+		end := startIndex - 1 + count
+		if end > len(resources) {
+			end = len(resources)
+		}
+		page = resources[startIndex-1 : end]
+	}
+	writeSCIM(w, http.StatusOK, &scimListResponse{
+		Schemas:      []string{scimSchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// getSCIMPagination returns the 1-based start index and the page size of a listing. Invalid values are
+// replaced by the defaults, as recommended by RFC 7644.
+func getSCIMPagination(q url.Values) (startIndex, count int) {
+	startIndex, err := strconv.Atoi(q.Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err = strconv.Atoi(q.Get("count"))
+	if err != nil || count < 0 {
+		count = defaultSCIMPageSize
+	}
+	if count > maxSCIMPageSize {
+		count = maxSCIMPageSize
+	}
+	return startIndex, count
+}
+
+// newSCIMUsers returns the users as SCIM resources sorted by id, so pages are stable.
+func newSCIMUsers(groups []*Group, users []*User) []*scimUser {
+	groupNames := make(map[string]string, len(groups))
+	for _, group := range groups {
+		groupNames[group.Id] = group.Name
+	}
+
+	resources := make([]*scimUser, len(users))
+	for i, user := range users {
+		resources[i] = &scimUser{
+			Schemas: []string{scimSchemaUser},
+			ID:      user.Id,
+			Name:    user.Id,
+			Meta:    scimMeta{ResourceType: "User", Version: user.Version},
+		}
+		for _, groupID := range user.GroupIds {
+			resources[i].Groups = append(resources[i].Groups, scimMember{Value: groupID, Display: groupNames[groupID]})
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ID < resources[j].ID
+	})
+	return resources
+}
+
+// newSCIMGroups returns the groups as SCIM resources sorted by id, with the users which are their members.
+func newSCIMGroups(groups []*Group, users []*User) []*scimGroup {
+	members := make(map[string][]scimMember, len(groups))
+	for _, user := range users {
+		for _, groupID := range user.GroupIds {
+			members[groupID] = append(members[groupID], scimMember{Value: user.Id, Type: "User"})
+		}
+	}
+
+	resources := make([]*scimGroup, len(groups))
+	for i, group := range groups {
+		groupMembers := members[group.Id]
+		sort.Slice(groupMembers, func(i, j int) bool {
+			return groupMembers[i].Value < groupMembers[j].Value
+		})
+		resources[i] = &scimGroup{
+			Schemas:     []string{scimSchemaGroup},
+			ID:          group.Id,
+			DisplayName: group.Name,
+			Members:     groupMembers,
+			Meta:        scimMeta{ResourceType: "Group", Version: group.Version},
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		return resources[i].ID < resources[j].ID
+	})
+	return resources
+}
+
+func writeSCIM(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeSCIMError(w http.ResponseWriter, status int, scimType, detail string) {
+	writeSCIM(w, status, &scimError{
+		Schemas:  []string{scimSchemaError},
+		Status:   strconv.Itoa(status),
+		SCIMType: scimType,
+		Detail:   detail,
+	})
+}
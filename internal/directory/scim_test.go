@@ -0,0 +1,147 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSCIMHandler(t *testing.T) {
+	var groups []*Group
+	var users []*User
+	for i := 0; i < 5; i++ {
+		users = append(users, &User{Id: fmt.Sprintf("okta/user%d", i), GroupIds: []string{"user"}})
+	}
+	users[0].GroupIds = []string{"admin", "user"}
+	groups = append(groups,
+		&Group{Id: "user", Name: "Users"},
+		&Group{Id: "admin", Name: "Admins"},
+	)
+	h := SCIMHandler(mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			return groups, users, nil
+		},
+	})
+
+	get := func(t *testing.T, path string, out interface{}) int {
+		r := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, "application/scim+json", w.Header().Get("Content-Type"))
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+		return w.Code
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var ids []string
+		for startIndex := 1; startIndex <= len(users); startIndex += 2 {
+			var res struct {
+				TotalResults int
+				StartIndex   int
+				ItemsPerPage int
+				Resources    []struct {
+					ID string
+				}
+			}
+			code := get(t, fmt.Sprintf("/scim/v2/Users?startIndex=%d&count=2", startIndex), &res)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, 5, res.TotalResults)
+			assert.Equal(t, startIndex, res.StartIndex)
+			assert.Equal(t, len(res.Resources), res.ItemsPerPage)
+			for _, resource := range res.Resources {
+				ids = append(ids, resource.ID)
+			}
+		}
+		assert.Equal(t, []string{"okta/user0", "okta/user1", "okta/user2", "okta/user3", "okta/user4"}, ids)
+
+		var res struct {
+			TotalResults int
+			ItemsPerPage int
+			Resources    []interface{}
+		}
+		get(t, "/scim/v2/Users?startIndex=10", &res)
+		assert.Equal(t, 5, res.TotalResults)
+		assert.Equal(t, 0, res.ItemsPerPage)
+		assert.Empty(t, res.Resources)
+	})
+	t.Run("filter", func(t *testing.T) {
+		var res struct {
+			TotalResults int
+			Resources    []struct {
+				ID          string
+				DisplayName string
+				Members     []struct {
+					Value string
+				}
+			}
+		}
+		code := get(t, "/scim/v2/Groups?filter="+url.QueryEscape(`displayName eq "Admins"`), &res)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, res.TotalResults)
+		if assert.Len(t, res.Resources, 1) {
+			assert.Equal(t, "admin", res.Resources[0].ID)
+			if assert.Len(t, res.Resources[0].Members, 1) {
+				assert.Equal(t, "okta/user0", res.Resources[0].Members[0].Value)
+			}
+		}
+
+		var scimErr struct {
+			Status   string
+			SCIMType string
+		}
+		code = get(t, "/scim/v2/Groups?filter="+url.QueryEscape(`displayName co "Adm"`), &scimErr)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "400", scimErr.Status)
+		assert.Equal(t, "invalidFilter", scimErr.SCIMType)
+
+		code = get(t, "/scim/v2/Users?filter="+url.QueryEscape(`displayName eq "Admins"`), &scimErr)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, "invalidFilter", scimErr.SCIMType)
+	})
+	t.Run("resource", func(t *testing.T) {
+		var user struct {
+			ID       string
+			UserName string
+			Groups   []struct {
+				Value   string
+				Display string
+			}
+		}
+		code := get(t, "/scim/v2/Users/"+url.PathEscape("okta/user0"), &user)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "okta/user0", user.ID)
+		if assert.Len(t, user.Groups, 2) {
+			assert.Equal(t, "admin", user.Groups[0].Value)
+			assert.Equal(t, "Admins", user.Groups[0].Display)
+		}
+
+		var scimErr struct{ Status string }
+		code = get(t, "/scim/v2/Users/unknown", &scimErr)
+		assert.Equal(t, http.StatusNotFound, code)
+		assert.Equal(t, "404", scimErr.Status)
+	})
+	t.Run("read-only", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/scim/v2/Users", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+	t.Run("provider error", func(t *testing.T) {
+		h := SCIMHandler(mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return nil, nil, errors.New("unavailable")
+			},
+		})
+		r := httptest.NewRequest("GET", "/scim/v2/Groups", nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
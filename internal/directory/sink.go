@@ -0,0 +1,142 @@
+package directory
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// A Sink stores the users and groups of a sync. Each call replaces the users or groups stored by the
+// previous one, so records which are no longer present are removed.
+type Sink interface {
+	PutGroups(ctx context.Context, groups []*Group) error
+	PutUsers(ctx context.Context, users []*User) error
+}
+
+// A CursorSink is a Sink which also stores the cursors of providers, keyed by provider name.
+type CursorSink interface {
+	// GetCursor returns the stored cursor of a provider, or nil if there is none.
+	GetCursor(ctx context.Context, provider string) ([]byte, error)
+	PutCursor(ctx context.Context, provider string, cursor []byte) error
+}
+
+// A MemorySink is a Sink which keeps the users, groups and cursors in memory, indexed by id so they can be
+// queried as a lightweight alternative to the databroker for a single process. It is safe for concurrent
+// use: each write replaces the stored records at once, so readers see either the previous or the new
+// records.
+type MemorySink struct {
+	mu         sync.RWMutex
+	groups     []*Group
+	users      []*User
+	groupsByID map[string]*Group
+	usersByID  map[string]*User
+	cursors    map[string][]byte
+}
+
+// NewMemorySink creates a new MemorySink.
+func NewMemorySink() *MemorySink {
+	return &MemorySink{
+		groupsByID: make(map[string]*Group),
+		usersByID:  make(map[string]*User),
+		cursors:    make(map[string][]byte),
+	}
+}
+
+// PutGroups replaces the stored groups.
+func (s *MemorySink) PutGroups(ctx context.Context, groups []*Group) error {
+	lookup := make(map[string]*Group, len(groups))
+	for _, group := range groups {
+		lookup[group.GetId()] = group
+	}
+	s.mu.Lock()
+	s.groups = groups
+	s.groupsByID = lookup
+	s.mu.Unlock()
+	return nil
+}
+
+// PutUsers replaces the stored users.
+func (s *MemorySink) PutUsers(ctx context.Context, users []*User) error {
+	lookup := make(map[string]*User, len(users))
+	for _, user := range users {
+		lookup[user.GetId()] = user
+	}
+	s.mu.Lock()
+	s.users = users
+	s.usersByID = lookup
+	s.mu.Unlock()
+	return nil
+}
+
+// Groups returns the stored groups in the order they were written.
+func (s *MemorySink) Groups() []*Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups
+}
+
+// Users returns the stored users in the order they were written.
+func (s *MemorySink) Users() []*User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users
+}
+
+// GetGroup returns the group with the given id, or nil if there is none.
+func (s *MemorySink) GetGroup(id string) *Group {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groupsByID[id]
+}
+
+// GetUser returns the user with the given id, or nil if there is none.
+func (s *MemorySink) GetUser(id string) *User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.usersByID[id]
+}
+
+// ListGroups returns the stored groups sorted by id.
+func (s *MemorySink) ListGroups() []*Group {
+	s.mu.RLock()
+	groups := make([]*Group, 0, len(s.groupsByID))
+	for _, group := range s.groupsByID {
+		groups = append(groups, group)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].GetId() < groups[j].GetId()
+	})
+	return groups
+}
+
+// ListUsers returns the stored users sorted by id.
+func (s *MemorySink) ListUsers() []*User {
+	s.mu.RLock()
+	users := make([]*User, 0, len(s.usersByID))
+	for _, user := range s.usersByID {
+		users = append(users, user)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].GetId() < users[j].GetId()
+	})
+	return users
+}
+
+// GetCursor returns the stored cursor of a provider.
+func (s *MemorySink) GetCursor(ctx context.Context, provider string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cursors[provider], nil
+}
+
+// PutCursor stores the cursor of a provider.
+func (s *MemorySink) PutCursor(ctx context.Context, provider string, cursor []byte) error {
+	s.mu.Lock()
+	s.cursors[provider] = cursor
+	s.mu.Unlock()
+	return nil
+}
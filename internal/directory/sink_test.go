@@ -0,0 +1,90 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemorySink(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemorySink()
+	assert.Nil(t, s.GetUser("okta/user1"))
+	assert.Empty(t, s.ListUsers())
+
+	assert.NoError(t, s.PutGroups(ctx, []*Group{{Id: "user", Name: "Users"}, {Id: "admin", Name: "Admins"}}))
+	assert.NoError(t, s.PutUsers(ctx, []*User{
+		{Id: "okta/user2", GroupIds: []string{"user"}},
+		{Id: "okta/user1", GroupIds: []string{"admin", "user"}},
+	}))
+	if user := s.GetUser("okta/user1"); assert.NotNil(t, user) {
+		assert.Equal(t, []string{"admin", "user"}, user.GroupIds)
+	}
+	if group := s.GetGroup("admin"); assert.NotNil(t, group) {
+		assert.Equal(t, "Admins", group.Name)
+	}
+	users := s.ListUsers()
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "okta/user1", users[0].Id)
+		assert.Equal(t, "okta/user2", users[1].Id)
+	}
+	groups := s.ListGroups()
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "admin", groups[0].Id)
+	}
+
+	assert.NoError(t, s.PutUsers(ctx, []*User{{Id: "okta/user2"}}))
+	assert.Nil(t, s.GetUser("okta/user1"), "users missing from a write should be removed")
+	assert.Len(t, s.ListUsers(), 1)
+}
+
+func TestMemorySink_Concurrency(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemorySink()
+
+	const syncs, users = 100, 10
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= syncs; i++ {
+			version := strconv.Itoa(i)
+			var snapshot []*User
+			for j := 0; j < users; j++ {
+				snapshot = append(snapshot, &User{Id: fmt.Sprintf("okta/user%d", j), Version: version})
+			}
+			_ = s.PutGroups(ctx, []*Group{{Id: "user", Version: version}})
+			_ = s.PutUsers(ctx, snapshot)
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < syncs; i++ {
+				snapshot := s.ListUsers()
+				if len(snapshot) == 0 {
+					continue
+				}
+				assert.Len(t, snapshot, users)
+				for _, user := range snapshot {
+					assert.Equal(t, snapshot[0].Version, user.Version, "a listing should come from a single write")
+				}
+				if user := s.GetUser("okta/user0"); assert.NotNil(t, user) {
+					assert.NotEmpty(t, user.Version)
+				}
+				_ = s.GetGroup("user")
+				_ = s.ListGroups()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if user := s.GetUser("okta/user0"); assert.NotNil(t, user) {
+		assert.Equal(t, strconv.Itoa(syncs), user.Version)
+	}
+}
@@ -0,0 +1,63 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// A ThrottleProvider is a Provider which enforces a minimum interval between syncs of an inner provider.
+// Calls made before the interval has elapsed since the last sync started return that sync's result,
+// including its error, without querying the inner provider. A sync which ended because its context was
+// canceled or timed out isn't reused. Unlike a DebounceProvider, concurrent calls wait for each other,
+// until their own context is done, so the inner provider is never queried more often than the interval
+// allows.
+type ThrottleProvider struct {
+	inner       Provider
+	minInterval time.Duration
+	now         func() time.Time
+
+	// sem is held while a sync is checked or started, and guards started and last.
+	sem     chan struct{}
+	started time.Time
+	last    *userGroupsResult
+}
+
+// NewThrottleProvider creates a new ThrottleProvider.
+func NewThrottleProvider(inner Provider, minInterval time.Duration) *ThrottleProvider {
+	return &ThrottleProvider{
+		inner:       inner,
+		minInterval: minInterval,
+		now:         time.Now,
+		sem:         make(chan struct{}, 1),
+	}
+}
+
+// UserGroups returns the result of the last sync if it started less than the minimum interval ago,
+// otherwise it queries the inner provider.
+func (p *ThrottleProvider) UserGroups(ctx context.Context) ([]*Group, []*User, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	defer func() { <-p.sem }()
+
+	if p.last != nil && p.now().Sub(p.started) < p.minInterval {
+		return p.last.groups, p.last.users, p.last.err
+	}
+
+	started := p.now()
+	groups, users, err := p.inner.UserGroups(ctx)
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return groups, users, err
+	}
+	p.started = started
+	p.last = &userGroupsResult{
+		groups:    groups,
+		users:     users,
+		err:       err,
+		completed: p.now(),
+	}
+	return groups, users, err
+}
@@ -0,0 +1,94 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleProvider(t *testing.T) {
+	var calls int32
+	var err error
+	p := NewThrottleProvider(mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			atomic.AddInt32(&calls, 1)
+			if err != nil {
+				return nil, nil, err
+			}
+			return []*Group{{Id: "group1"}}, []*User{{Id: "user1"}}, nil
+		},
+	}, time.Minute)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			groups, users, err := p.UserGroups(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, []*Group{{Id: "group1"}}, groups)
+			assert.Equal(t, []*User{{Id: "user1"}}, users)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "calls within the interval should reuse the last result")
+
+	now = now.Add(time.Minute)
+	err = errors.New("unavailable")
+	_, _, gotErr := p.UserGroups(context.Background())
+	assert.Equal(t, err, gotErr)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "calls after the interval should start a new sync")
+
+	_, _, gotErr = p.UserGroups(context.Background())
+	assert.Equal(t, err, gotErr, "failed syncs should also be throttled")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestThrottleProviderContext(t *testing.T) {
+	var calls int32
+	block := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewThrottleProvider(mockProvider{
+		userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				cancel()
+			}
+			select {
+			case <-block:
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			}
+			return []*Group{{Id: "group1"}}, []*User{{Id: "user1"}}, nil
+		},
+	}, time.Minute)
+
+	_, _, err := p.UserGroups(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		groups, _, err := p.UserGroups(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []*Group{{Id: "group1"}}, groups)
+	}()
+	for atomic.LoadInt32(&calls) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err = p.UserGroups(ctx)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "waiting calls should return when their context is done")
+
+	close(block)
+	<-done
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "canceled syncs should not be reused")
+}
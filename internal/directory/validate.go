@@ -0,0 +1,37 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+)
+
+// ValidateGroupRefs returns the group ids of refs which aren't the id or an alternative id of any group of
+// the provider, such as typos in a policy, in the order of refs. Providers which implement GroupLister list
+// their groups, others perform a full sync.
+func ValidateGroupRefs(ctx context.Context, provider Provider, refs []string) (missing []string, err error) {
+	var groups []*Group
+	if lister, ok := provider.(GroupLister); ok {
+		groups, err = lister.ListGroups(ctx)
+	} else {
+		groups, _, err = provider.UserGroups(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("directory: failed to list groups: %w", err)
+	}
+
+	known := make(map[string]struct{}, len(groups))
+	for _, group := range groups {
+		known[group.GetId()] = struct{}{}
+		for _, id := range group.GetAltIds() {
+			known[id] = struct{}{}
+		}
+	}
+	for _, ref := range refs {
+		if _, ok := known[ref]; !ok {
+			missing = append(missing, ref)
+			// report each missing id once
+			known[ref] = struct{}{}
+		}
+	}
+	return missing, nil
+}
@@ -0,0 +1,65 @@
+package directory
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockGroupLister struct {
+	mockProvider
+	listGroups func(ctx context.Context) ([]*Group, error)
+}
+
+func (mock mockGroupLister) ListGroups(ctx context.Context) ([]*Group, error) {
+	return mock.listGroups(ctx)
+}
+
+func TestValidateGroupRefs(t *testing.T) {
+	ctx := context.Background()
+	groups := []*Group{
+		{Id: "00g1", Name: "admins", AltIds: []string{"admins"}},
+		{Id: "00g2", Name: "users"},
+	}
+
+	t.Run("group lister", func(t *testing.T) {
+		provider := mockGroupLister{
+			mockProvider: mockProvider{
+				userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+					return nil, nil, errors.New("a full sync should not be performed")
+				},
+			},
+			listGroups: func(ctx context.Context) ([]*Group, error) {
+				return groups, nil
+			},
+		}
+		missing, err := ValidateGroupRefs(ctx, provider, []string{"00g1", "00g3", "admins", "00g3"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"00g3"}, missing)
+	})
+	t.Run("provider", func(t *testing.T) {
+		provider := mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return groups, nil, nil
+			},
+		}
+		missing, err := ValidateGroupRefs(ctx, provider, []string{"00g2", "bogus"})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"bogus"}, missing)
+
+		missing, err = ValidateGroupRefs(ctx, provider, []string{"00g2"})
+		assert.NoError(t, err)
+		assert.Empty(t, missing)
+	})
+	t.Run("error", func(t *testing.T) {
+		provider := mockProvider{
+			userGroups: func(ctx context.Context) ([]*Group, []*User, error) {
+				return nil, nil, errors.New("unavailable")
+			},
+		}
+		_, err := ValidateGroupRefs(ctx, provider, []string{"00g2"})
+		assert.EqualError(t, err, "directory: failed to list groups: unavailable")
+	})
+}
@@ -0,0 +1,68 @@
+package directory
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+// maxWebhookBodySize is the maximum size of a webhook request body which will be read.
+const maxWebhookBodySize = 1 << 20
+
+// A WebhookVerifier verifies that a webhook request was sent by the identity provider.
+type WebhookVerifier interface {
+	VerifyWebhook(r *http.Request, body []byte) error
+}
+
+// A WebhookChallenger is a WebhookVerifier which also responds to the identity provider's endpoint
+// verification requests. HandleWebhookChallenge returns true if the request was a challenge and a response
+// was written.
+type WebhookChallenger interface {
+	WebhookVerifier
+	HandleWebhookChallenge(w http.ResponseWriter, r *http.Request) bool
+}
+
+// A WebhookHandler is an http.Handler which receives identity provider event hooks and triggers a
+// directory sync for every verified event.
+type WebhookHandler struct {
+	verifier WebhookVerifier
+	trigger  func()
+}
+
+// NewWebhookHandler creates a new WebhookHandler. trigger is called for every verified event and should
+// not block.
+func NewWebhookHandler(verifier WebhookVerifier, trigger func()) *WebhookHandler {
+	return &WebhookHandler{
+		verifier: verifier,
+		trigger:  trigger,
+	}
+}
+
+// ServeHTTP serves an http request.
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if challenger, ok := h.verifier.(WebhookChallenger); ok && challenger.HandleWebhookChallenge(w, r) {
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verifier.VerifyWebhook(r, body); err != nil {
+		log.Warn().Err(err).Str("service", "directory").Msg("invalid webhook request")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+
+	h.trigger()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,43 @@
+package directory
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/directory/okta"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	var triggered int
+	h := NewWebhookHandler(okta.NewEventHookVerifier("", "SECRET"), func() {
+		triggered++
+	})
+
+	event := `{"eventType":"com.okta.event_hook","data":{"events":[{"eventType":"group.user_membership.add"}]}}`
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(event))
+	r.Header.Set("Authorization", "SECRET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 1, triggered)
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(event))
+	r.Header.Set("Authorization", "INVALID")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, 1, triggered)
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "SECRET")
+	r.Header.Set("X-Okta-Verification-Challenge", "CHALLENGE")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, triggered)
+}
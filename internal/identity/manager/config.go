@@ -18,17 +18,22 @@ var (
 type config struct {
 	authenticator                 Authenticator
 	directory                     directory.Provider
+	directorySink                 directory.Sink
 	dataBrokerClient              databroker.DataBrokerServiceClient
 	groupRefreshInterval          time.Duration
 	groupRefreshTimeout           time.Duration
+	rejectEmptyDirectoryResults   bool
 	sessionRefreshGracePeriod     time.Duration
 	sessionRefreshCoolOffDuration time.Duration
+	syncLeader                    directory.SyncLeader
 }
 
 func newConfig(options ...Option) *config {
 	cfg := new(config)
+	WithDirectoryProvider(directory.NoopProvider{})(cfg)
 	WithGroupRefreshInterval(defaultGroupRefreshInterval)(cfg)
 	WithGroupRefreshTimeout(defaultGroupRefreshTimeout)(cfg)
+	WithRejectEmptyDirectoryResults(true)(cfg)
 	WithSessionRefreshGracePeriod(defaultSessionRefreshGracePeriod)(cfg)
 	WithSessionRefreshCoolOffDuration(defaultSessionRefreshCoolOffDuration)(cfg)
 	for _, option := range options {
@@ -54,6 +59,14 @@ func WithDirectoryProvider(directoryProvider directory.Provider) Option {
 	}
 }
 
+// WithDirectorySink sets the sink directory users and groups are written to after each refresh. By
+// default they are written to the databroker.
+func WithDirectorySink(directorySink directory.Sink) Option {
+	return func(cfg *config) {
+		cfg.directorySink = directorySink
+	}
+}
+
 // WithDataBrokerClient sets the databroker client in the config.
 func WithDataBrokerClient(dataBrokerClient databroker.DataBrokerServiceClient) Option {
 	return func(cfg *config) {
@@ -75,6 +88,15 @@ func WithGroupRefreshTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithRejectEmptyDirectoryResults sets whether a directory refresh without any users or without any groups
+// is rejected when the previous refresh had some, so a transient provider problem doesn't remove every
+// directory user and group. It defaults to true.
+func WithRejectEmptyDirectoryResults(rejectEmptyDirectoryResults bool) Option {
+	return func(cfg *config) {
+		cfg.rejectEmptyDirectoryResults = rejectEmptyDirectoryResults
+	}
+}
+
 // WithSessionRefreshGracePeriod sets the session refresh grace period used by the manager.
 func WithSessionRefreshGracePeriod(dur time.Duration) Option {
 	return func(cfg *config) {
@@ -89,6 +111,14 @@ func WithSessionRefreshCoolOffDuration(dur time.Duration) Option {
 	}
 }
 
+// WithSyncLeader sets the sync leader used by the manager. When set, directory users and groups are only
+// refreshed while the manager holds the sync lease.
+func WithSyncLeader(syncLeader directory.SyncLeader) Option {
+	return func(cfg *config) {
+		cfg.syncLeader = syncLeader
+	}
+}
+
 type atomicConfig struct {
 	value atomic.Value
 }
@@ -9,14 +9,18 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/btree"
 	"github.com/rs/zerolog"
 	"golang.org/x/oauth2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"gopkg.in/tomb.v2"
 
 	"github.com/pomerium/pomerium/internal/directory"
 	"github.com/pomerium/pomerium/internal/log"
 	"github.com/pomerium/pomerium/internal/scheduler"
+	"github.com/pomerium/pomerium/internal/telemetry/metrics"
 	"github.com/pomerium/pomerium/pkg/grpc/databroker"
 	"github.com/pomerium/pomerium/pkg/grpc/session"
 	"github.com/pomerium/pomerium/pkg/grpc/user"
@@ -60,6 +64,9 @@ type Manager struct {
 	directoryGroupsRecordVersion string
 
 	directoryNextRefresh time.Time
+	// the number of groups and users of the previous directory refresh
+	directoryPreviousGroups int
+	directoryPreviousUsers  int
 }
 
 // New creates a new identity manager.
@@ -206,22 +213,136 @@ func (mgr *Manager) refreshLoop(
 }
 
 func (mgr *Manager) refreshDirectoryUserGroups(ctx context.Context) {
+	if syncLeader := mgr.cfg.Load().syncLeader; syncLeader != nil {
+		acquired, release := syncLeader.AcquireLease(ctx)
+		defer release()
+		if !acquired {
+			mgr.log.Debug().Msg("directory sync lease held by another replica, skipping refresh")
+			return
+		}
+	}
+
 	mgr.log.Info().Msg("refreshing directory users")
 
 	ctx, clearTimeout := context.WithTimeout(ctx, mgr.cfg.Load().groupRefreshTimeout)
 	defer clearTimeout()
 
-	directoryGroups, directoryUsers, err := mgr.cfg.Load().directory.UserGroups(ctx)
+	provider := mgr.cfg.Load().directory
+	sink := mgr.cfg.Load().directorySink
+	if sink == nil {
+		sink = databrokerSink{mgr: mgr}
+	}
+
+	cursorProvider, _ := provider.(directory.CursorProvider)
+	cursorSink, _ := sink.(directory.CursorSink)
+	canResume := cursorProvider != nil && cursorSink != nil
+	if canResume {
+		cursor, err := cursorSink.GetCursor(ctx, directory.ProviderName(provider))
+		if err != nil {
+			mgr.log.Warn().Err(err).Msg("failed to load directory cursor")
+		} else if cursor != nil {
+			ctx = directory.WithCursor(ctx, cursor)
+		}
+	}
+
+	directoryGroups, directoryUsers, err := provider.UserGroups(ctx)
 	if err != nil {
 		mgr.log.Warn().Err(err).Msg("failed to refresh directory users and groups")
 		return
 	}
+	if mgr.cfg.Load().rejectEmptyDirectoryResults {
+		err := directory.CheckEmptyResult(mgr.directoryPreviousGroups, mgr.directoryPreviousUsers,
+			len(directoryGroups), len(directoryUsers))
+		if err != nil {
+			mgr.log.Warn().Err(err).Msg("rejected directory users and groups")
+			return
+		}
+	}
+	if err := sink.PutGroups(ctx, directoryGroups); err != nil {
+		mgr.log.Warn().Err(err).Msg("failed to store directory groups")
+		return
+	}
+	if err := sink.PutUsers(ctx, directoryUsers); err != nil {
+		mgr.log.Warn().Err(err).Msg("failed to store directory users")
+		return
+	}
+	mgr.directoryPreviousGroups, mgr.directoryPreviousUsers = len(directoryGroups), len(directoryUsers)
+	metrics.SetDirectoryLastSync(directory.ProviderName(provider), time.Now())
 
-	mgr.mergeGroups(ctx, directoryGroups)
-	mgr.mergeUsers(ctx, directoryUsers)
+	// the cursor is only stored once the users and groups it describes are, so a failed write is
+	// retried by a full sync rather than resumed past
+	if canResume {
+		if err := mgr.saveDirectoryCursor(ctx, cursorSink, provider, cursorProvider.Cursor()); err != nil {
+			mgr.log.Warn().Err(err).Msg("failed to store directory cursor")
+		}
+	}
 }
 
-func (mgr *Manager) mergeGroups(ctx context.Context, directoryGroups []*directory.Group) {
+func (mgr *Manager) saveDirectoryCursor(ctx context.Context, sink directory.CursorSink, provider directory.Provider, cursor directory.Cursor) error {
+	if cursor == nil {
+		return nil
+	}
+	raw, err := cursor.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("failed to marshal directory cursor: %w", err)
+	}
+	return sink.PutCursor(ctx, directory.ProviderName(provider), raw)
+}
+
+// A databrokerSink is a directory.Sink which stores users and groups in the databroker. Only the records
+// which differ from those the manager has seen in the databroker are written.
+type databrokerSink struct {
+	mgr *Manager
+}
+
+func (sink databrokerSink) PutGroups(ctx context.Context, groups []*directory.Group) error {
+	return sink.mgr.mergeGroups(ctx, groups)
+}
+
+func (sink databrokerSink) PutUsers(ctx context.Context, users []*directory.User) error {
+	return sink.mgr.mergeUsers(ctx, users)
+}
+
+// directoryCursorIDPrefix is the prefix of the databroker ids of directory cursors, which are stored as
+// bytes values.
+const directoryCursorIDPrefix = "directory-cursor/"
+
+func (sink databrokerSink) GetCursor(ctx context.Context, provider string) ([]byte, error) {
+	any, _ := ptypes.MarshalAny(new(wrappers.BytesValue))
+	res, err := sink.mgr.cfg.Load().dataBrokerClient.Get(ctx, &databroker.GetRequest{
+		Type: any.GetTypeUrl(),
+		Id:   directoryCursorIDPrefix + provider,
+	})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get directory cursor: %w", err)
+	}
+
+	var cursor wrappers.BytesValue
+	if err := ptypes.UnmarshalAny(res.GetRecord().GetData(), &cursor); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal directory cursor: %w", err)
+	}
+	return cursor.GetValue(), nil
+}
+
+func (sink databrokerSink) PutCursor(ctx context.Context, provider string, cursor []byte) error {
+	any, err := ptypes.MarshalAny(&wrappers.BytesValue{Value: cursor})
+	if err != nil {
+		return fmt.Errorf("failed to marshal directory cursor: %w", err)
+	}
+	_, err = sink.mgr.cfg.Load().dataBrokerClient.Set(ctx, &databroker.SetRequest{
+		Type: any.GetTypeUrl(),
+		Id:   directoryCursorIDPrefix + provider,
+		Data: any,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update directory cursor: %w", err)
+	}
+	return nil
+}
+
+func (mgr *Manager) mergeGroups(ctx context.Context, directoryGroups []*directory.Group) error {
 	lookup := map[string]*directory.Group{}
 	for _, dg := range directoryGroups {
 		lookup[dg.GetId()] = dg
@@ -232,8 +353,7 @@ func (mgr *Manager) mergeGroups(ctx context.Context, directoryGroups []*director
 		if !ok || !proto.Equal(newDG, curDG) {
 			any, err := ptypes.MarshalAny(newDG)
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to marshal directory group")
-				return
+				return fmt.Errorf("failed to marshal directory group: %w", err)
 			}
 			_, err = mgr.cfg.Load().dataBrokerClient.Set(ctx, &databroker.SetRequest{
 				Type: any.GetTypeUrl(),
@@ -241,8 +361,7 @@ func (mgr *Manager) mergeGroups(ctx context.Context, directoryGroups []*director
 				Data: any,
 			})
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to update directory group")
-				return
+				return fmt.Errorf("failed to update directory group: %w", err)
 			}
 		}
 	}
@@ -252,22 +371,21 @@ func (mgr *Manager) mergeGroups(ctx context.Context, directoryGroups []*director
 		if !ok {
 			any, err := ptypes.MarshalAny(curDG)
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to marshal directory group")
-				return
+				return fmt.Errorf("failed to marshal directory group: %w", err)
 			}
 			_, err = mgr.cfg.Load().dataBrokerClient.Delete(ctx, &databroker.DeleteRequest{
 				Type: any.GetTypeUrl(),
 				Id:   curDG.GetId(),
 			})
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to delete directory group")
-				return
+				return fmt.Errorf("failed to delete directory group: %w", err)
 			}
 		}
 	}
+	return nil
 }
 
-func (mgr *Manager) mergeUsers(ctx context.Context, directoryUsers []*directory.User) {
+func (mgr *Manager) mergeUsers(ctx context.Context, directoryUsers []*directory.User) error {
 	lookup := map[string]*directory.User{}
 	for _, du := range directoryUsers {
 		lookup[du.GetId()] = du
@@ -278,8 +396,7 @@ func (mgr *Manager) mergeUsers(ctx context.Context, directoryUsers []*directory.
 		if !ok || !proto.Equal(newDU, curDU) {
 			any, err := ptypes.MarshalAny(newDU)
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to marshal directory user")
-				return
+				return fmt.Errorf("failed to marshal directory user: %w", err)
 			}
 			_, err = mgr.cfg.Load().dataBrokerClient.Set(ctx, &databroker.SetRequest{
 				Type: any.GetTypeUrl(),
@@ -287,8 +404,7 @@ func (mgr *Manager) mergeUsers(ctx context.Context, directoryUsers []*directory.
 				Data: any,
 			})
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to update directory user")
-				return
+				return fmt.Errorf("failed to update directory user: %w", err)
 			}
 		}
 	}
@@ -298,19 +414,18 @@ func (mgr *Manager) mergeUsers(ctx context.Context, directoryUsers []*directory.
 		if !ok {
 			any, err := ptypes.MarshalAny(curDU)
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to marshal directory user")
-				return
+				return fmt.Errorf("failed to marshal directory user: %w", err)
 			}
 			_, err = mgr.cfg.Load().dataBrokerClient.Delete(ctx, &databroker.DeleteRequest{
 				Type: any.GetTypeUrl(),
 				Id:   curDU.GetId(),
 			})
 			if err != nil {
-				mgr.log.Warn().Err(err).Msg("failed to delete directory user")
-				return
+				return fmt.Errorf("failed to delete directory user: %w", err)
 			}
 		}
 	}
+	return nil
 }
 
 func (mgr *Manager) refreshSession(ctx context.Context, userID, sessionID string) {
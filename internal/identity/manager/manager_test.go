@@ -0,0 +1,202 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/pomerium/pomerium/internal/directory"
+	"github.com/pomerium/pomerium/internal/directory/directorytest"
+)
+
+type mockProvider struct {
+	userGroups func(ctx context.Context) ([]*directory.Group, []*directory.User, error)
+}
+
+func (mock mockProvider) UserGroups(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+	return mock.userGroups(ctx)
+}
+
+type mockCursor []byte
+
+func (c mockCursor) MarshalBinary() ([]byte, error) {
+	return c, nil
+}
+
+func (c *mockCursor) UnmarshalBinary(data []byte) error {
+	*c = data
+	return nil
+}
+
+type mockCursorProvider struct {
+	mockProvider
+	cursor directory.Cursor
+}
+
+func (mock mockCursorProvider) Cursor() directory.Cursor {
+	return mock.cursor
+}
+
+type failingSink struct {
+	*directory.MemorySink
+	err error
+}
+
+func (sink failingSink) PutUsers(ctx context.Context, users []*directory.User) error {
+	return sink.err
+}
+
+func TestManager_refreshDirectoryUserGroups(t *testing.T) {
+	groups := []*directory.Group{{Id: "group1"}}
+	users := []*directory.User{{Id: "user1", GroupIds: []string{"group1"}}}
+	sink := directory.NewMemorySink()
+	mgr := New(
+		WithDirectoryProvider(mockProvider{
+			userGroups: func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+				return groups, users, nil
+			},
+		}),
+		WithDirectorySink(sink),
+	)
+
+	mgr.refreshDirectoryUserGroups(context.Background())
+	assert.Equal(t, groups, sink.Groups())
+	assert.Equal(t, users, sink.Users())
+
+	users = []*directory.User{{Id: "user2", GroupIds: []string{"group1"}}}
+	mgr.refreshDirectoryUserGroups(context.Background())
+	assert.Equal(t, groups, sink.Groups())
+	assert.Equal(t, users, sink.Users(), "users which are no longer synced should be removed")
+}
+
+func TestManager_refreshDirectoryUserGroupsRejectEmpty(t *testing.T) {
+	groups := []*directory.Group{{Id: "group1"}}
+	users := []*directory.User{{Id: "user1", GroupIds: []string{"group1"}}}
+	provider := mockProvider{
+		userGroups: func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+			return groups, users, nil
+		},
+	}
+
+	sink := directory.NewMemorySink()
+	mgr := New(WithDirectoryProvider(provider), WithDirectorySink(sink))
+	mgr.refreshDirectoryUserGroups(context.Background())
+
+	groups, users = nil, nil
+	mgr.refreshDirectoryUserGroups(context.Background())
+	assert.Len(t, sink.Groups(), 1, "an empty refresh should not replace the previous one")
+	assert.Len(t, sink.Users(), 1, "an empty refresh should not replace the previous one")
+
+	groups, users = []*directory.Group{{Id: "group1"}}, nil
+	mgr.refreshDirectoryUserGroups(context.Background())
+	assert.Len(t, sink.Users(), 1, "a refresh without users should not replace the previous one")
+
+	t.Run("disabled", func(t *testing.T) {
+		groups, users = []*directory.Group{{Id: "group1"}}, []*directory.User{{Id: "user1"}}
+		sink := directory.NewMemorySink()
+		mgr := New(WithDirectoryProvider(provider), WithDirectorySink(sink), WithRejectEmptyDirectoryResults(false))
+		mgr.refreshDirectoryUserGroups(context.Background())
+
+		groups, users = nil, nil
+		mgr.refreshDirectoryUserGroups(context.Background())
+		assert.Empty(t, sink.Groups())
+		assert.Empty(t, sink.Users())
+	})
+}
+
+func TestManager_refreshDirectoryUserGroupsCursor(t *testing.T) {
+	sink := directory.NewMemorySink()
+	var resumedFrom []string
+	newProvider := func(cursor string) mockCursorProvider {
+		c := mockCursor(cursor)
+		return mockCursorProvider{
+			mockProvider: mockProvider{
+				userGroups: func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+					resumedFrom = append(resumedFrom, string(directory.CursorFromContext(ctx)))
+					return nil, nil, nil
+				},
+			},
+			cursor: &c,
+		}
+	}
+
+	New(WithDirectoryProvider(newProvider("cursor1")), WithDirectorySink(sink)).
+		refreshDirectoryUserGroups(context.Background())
+	// a new manager, as after a restart, passes the stored cursor to the provider
+	New(WithDirectoryProvider(newProvider("cursor2")), WithDirectorySink(sink)).
+		refreshDirectoryUserGroups(context.Background())
+
+	assert.Equal(t, []string{"", "cursor1"}, resumedFrom)
+	cursor, err := sink.GetCursor(context.Background(), "manager.mockCursorProvider")
+	assert.NoError(t, err)
+	assert.Equal(t, "cursor2", string(cursor))
+}
+
+func TestManager_refreshDirectoryUserGroupsSinkError(t *testing.T) {
+	c := mockCursor("cursor1")
+	provider := mockCursorProvider{
+		mockProvider: mockProvider{
+			userGroups: func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+				return []*directory.Group{{Id: "group1"}}, []*directory.User{{Id: "user1"}}, nil
+			},
+		},
+		cursor: &c,
+	}
+	sink := failingSink{MemorySink: directory.NewMemorySink(), err: errors.New("unavailable")}
+	mgr := New(WithDirectoryProvider(provider), WithDirectorySink(sink))
+	mgr.refreshDirectoryUserGroups(context.Background())
+
+	cursor, err := sink.GetCursor(context.Background(), "manager.mockCursorProvider")
+	assert.NoError(t, err)
+	assert.Nil(t, cursor, "the cursor should not be stored when the users couldn't be")
+	assert.Zero(t, mgr.directoryPreviousUsers)
+}
+
+func TestManager_refreshDirectoryUserGroupsSyncLeader(t *testing.T) {
+	var calls int32
+	provider := mockProvider{
+		userGroups: func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+			atomic.AddInt32(&calls, 1)
+			return []*directory.Group{{Id: "group1"}}, []*directory.User{{Id: "user1"}}, nil
+		},
+	}
+	syncLeader := directory.NewInMemorySyncLeader(time.Minute)
+	leader := directory.NewMemorySink()
+	follower := directory.NewMemorySink()
+
+	New(WithDirectoryProvider(provider), WithDirectorySink(leader), WithSyncLeader(syncLeader)).
+		refreshDirectoryUserGroups(context.Background())
+	New(WithDirectoryProvider(provider), WithDirectorySink(follower), WithSyncLeader(syncLeader)).
+		refreshDirectoryUserGroups(context.Background())
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "only the lease holder should sync")
+	assert.Len(t, leader.Users(), 1)
+	assert.Empty(t, follower.Users())
+}
+
+func TestManager_refreshDirectoryUserGroupsRecovers(t *testing.T) {
+	groups := []*directory.Group{{Id: "group1"}}
+	users := []*directory.User{{Id: "user1", GroupIds: []string{"group1"}}}
+	chaos := directorytest.NewChaosProvider(mockProvider{
+		userGroups: func(ctx context.Context) ([]*directory.Group, []*directory.User, error) {
+			return groups, users, nil
+		},
+	}, directorytest.ChaosConfig{Seed: 2, ErrorRate: 0.75})
+	sink := directory.NewMemorySink()
+	mgr := New(
+		WithDirectoryProvider(chaos),
+		WithDirectorySink(sink),
+	)
+
+	for i := 0; i < 20 && len(sink.Users()) == 0; i++ {
+		assert.Equal(t, i, chaos.InjectedErrors(), "failed refreshes should not store anything")
+		mgr.refreshDirectoryUserGroups(context.Background())
+	}
+	assert.NotZero(t, chaos.InjectedErrors())
+	assert.Equal(t, groups, sink.Groups())
+	assert.Equal(t, users, sink.Users())
+}
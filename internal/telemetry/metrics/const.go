@@ -18,6 +18,9 @@ var (
 	TagKeyStorageOperation = tag.MustNewKey("operation")
 	TagKeyStorageResult    = tag.MustNewKey("result")
 	TagKeyStorageBackend   = tag.MustNewKey("backend")
+
+	TagKeyDirectoryProvider = tag.MustNewKey("provider")
+	TagKeyDirectoryEndpoint = tag.MustNewKey("endpoint")
 )
 
 // Default distributions used by views in this package.
@@ -42,6 +45,7 @@ var (
 		GRPCServerViews,
 		HTTPClientViews,
 		HTTPServerViews,
+		DirectoryViews,
 		InfoViews,
 		StorageViews,
 	}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+
+	"github.com/pomerium/pomerium/internal/log"
+)
+
+var (
+	// DirectoryViews contains opencensus views for directory provider metrics
+	DirectoryViews = []*view.View{DirectoryRetryCountView}
+
+	directoryRetryCount = stats.Int64(
+		"directory_retry_count",
+		"Number of requests to an identity provider which were retried",
+		stats.UnitDimensionless)
+
+	// DirectoryRetryCountView is an OpenCensus view that counts directory provider
+	// request retries by provider and endpoint
+	DirectoryRetryCountView = &view.View{
+		Name:        directoryRetryCount.Name(),
+		Description: directoryRetryCount.Description(),
+		Measure:     directoryRetryCount,
+		TagKeys:     []tag.Key{TagKeyDirectoryProvider, TagKeyDirectoryEndpoint},
+		Aggregation: view.Count(),
+	}
+)
+
+// RecordDirectoryRetry records a retry of a request made by a directory provider to an endpoint of its
+// identity provider, such as "/api/v1/groups".
+func RecordDirectoryRetry(ctx context.Context, provider, endpoint string) {
+	err := stats.RecordWithTags(ctx,
+		[]tag.Mutator{
+			tag.Upsert(TagKeyDirectoryProvider, provider),
+			tag.Upsert(TagKeyDirectoryEndpoint, endpoint),
+		},
+		directoryRetryCount.M(1),
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("internal/telemetry/metrics: failed to record")
+	}
+}
@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+)
+
+func Test_RecordDirectoryRetry(t *testing.T) {
+	view.Unregister(DirectoryViews...)
+	view.Register(DirectoryViews...)
+
+	RecordDirectoryRetry(context.Background(), "okta", "/api/v1/groups")
+	RecordDirectoryRetry(context.Background(), "okta", "/api/v1/groups")
+
+	testDataRetrieval(DirectoryRetryCountView, t, "{ { {endpoint /api/v1/groups}{provider okta} }&{2")
+}
@@ -96,3 +96,10 @@ func SetConfigChecksum(service string, checksum uint64) {
 func AddPolicyCountCallback(service string, f func() int64) {
 	registry.addPolicyCountCallback(service, f)
 }
+
+// SetDirectoryLastSync records the time of the last successful directory sync of a provider. The
+// exported gauge is the number of seconds since then. You must call RegisterInfoMetrics to have this
+// exported
+func SetDirectoryLastSync(provider string, lastSync time.Time) {
+	registry.setDirectoryLastSync(provider, lastSync)
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/pomerium/pomerium/internal/version"
 
@@ -71,6 +72,41 @@ func Test_SetConfigChecksum(t *testing.T) {
 	testMetricRetrieval(registry.registry.Read(), t, wantLabels, float64(wantValue), "config_checksum_decimal")
 }
 
+func Test_SetDirectoryLastSync(t *testing.T) {
+	registry = newMetricRegistry()
+
+	lastSyncAge := func() float64 {
+		for _, metric := range registry.registry.Read() {
+			if metric.Descriptor.Name == "directory_last_sync_age_seconds" {
+				return metric.TimeSeries[0].Points[0].Value.(float64)
+			}
+		}
+		t.Fatal("Could not find metric directory_last_sync_age_seconds")
+		return 0
+	}
+
+	SetDirectoryLastSync("okta", time.Now().Add(-time.Hour))
+	before := lastSyncAge()
+	if before < time.Hour.Seconds() {
+		t.Errorf("Expected last sync age of at least an hour, got %f", before)
+	}
+
+	SetDirectoryLastSync("okta", time.Now())
+	after := lastSyncAge()
+	if after >= before {
+		t.Errorf("Expected last sync age to decrease after a sync, got %f then %f", before, after)
+	}
+
+	wantLabels := []metricdata.LabelValue{{Value: "okta", Present: true}}
+	for _, metric := range registry.registry.Read() {
+		if metric.Descriptor.Name == "directory_last_sync_age_seconds" {
+			if len(metric.TimeSeries) != 1 || metric.TimeSeries[0].LabelValues[0] != wantLabels[0] {
+				t.Errorf("Unexpected time series %v", metric.TimeSeries)
+			}
+		}
+	}
+}
+
 func Test_RegisterInfoMetrics(t *testing.T) {
 	metricproducer.GlobalManager().DeleteProducer(registry.registry)
 	RegisterInfoMetrics()
@@ -3,6 +3,7 @@ package metrics
 import (
 	"runtime"
 	"sync"
+	"time"
 
 	"go.opencensus.io/metric"
 	"go.opencensus.io/metric/metricdata"
@@ -26,6 +27,10 @@ type metricRegistry struct {
 	policyCount    *metric.Int64DerivedGauge
 	configChecksum *metric.Float64Gauge
 	sync.Once
+
+	directoryLastSyncAge *metric.Float64DerivedGauge
+	directoryLastSyncMu  sync.Mutex
+	directoryLastSync    map[string]time.Time
 }
 
 func newMetricRegistry() *metricRegistry {
@@ -62,6 +67,16 @@ func (r *metricRegistry) init() {
 			if err != nil {
 				log.Error().Err(err).Msg("telemetry/metrics: failed to register policy count metric")
 			}
+
+			r.directoryLastSync = make(map[string]time.Time)
+			r.directoryLastSyncAge, err = r.registry.AddFloat64DerivedGauge("directory_last_sync_age_seconds",
+				metric.WithDescription("Seconds since the last successful directory sync"),
+				metric.WithLabelKeys("provider"),
+				metric.WithUnit(metricdata.UnitDimensionless),
+			)
+			if err != nil {
+				log.Error().Err(err).Msg("telemetry/metrics: failed to register directory last sync age metric")
+			}
 		})
 }
 
@@ -96,6 +111,30 @@ func (r *metricRegistry) addPolicyCountCallback(service string, f func() int64)
 	}
 }
 
+func (r *metricRegistry) setDirectoryLastSync(provider string, lastSync time.Time) {
+	if r.directoryLastSyncAge == nil {
+		return
+	}
+
+	r.directoryLastSyncMu.Lock()
+	_, exists := r.directoryLastSync[provider]
+	r.directoryLastSync[provider] = lastSync
+	r.directoryLastSyncMu.Unlock()
+	if exists {
+		return
+	}
+
+	err := r.directoryLastSyncAge.UpsertEntry(func() float64 {
+		r.directoryLastSyncMu.Lock()
+		lastSync := r.directoryLastSync[provider]
+		r.directoryLastSyncMu.Unlock()
+		return time.Since(lastSync).Seconds()
+	}, metricdata.NewLabelValue(provider))
+	if err != nil {
+		log.Error().Err(err).Msg("telemetry/metrics: failed to update directory last sync age metric")
+	}
+}
+
 func (r *metricRegistry) setConfigChecksum(service string, checksum uint64) {
 	if r.configChecksum == nil {
 		return
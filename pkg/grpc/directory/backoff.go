@@ -0,0 +1,52 @@
+package directory
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A BackoffStrategy decides how long to wait before retrying a request.
+type BackoffStrategy interface {
+	// NextDelay returns the delay before the given retry attempt, starting at 1.
+	NextDelay(attempt int) time.Duration
+}
+
+type constantBackoff time.Duration
+
+// NewConstantBackoff creates a BackoffStrategy which waits the same delay before every attempt.
+func NewConstantBackoff(delay time.Duration) BackoffStrategy {
+	return constantBackoff(delay)
+}
+
+func (b constantBackoff) NextDelay(attempt int) time.Duration {
+	return time.Duration(b)
+}
+
+type exponentialBackoff struct {
+	base, max time.Duration
+}
+
+// NewExponentialBackoff creates a BackoffStrategy whose delay doubles with every attempt, starting at base
+// and capped at max. Each delay is jittered to between half and all of its value, so clients retrying at
+// the same time spread out.
+func NewExponentialBackoff(base, max time.Duration) BackoffStrategy {
+	return exponentialBackoff{base: base, max: max}
+}
+
+func (b exponentialBackoff) NextDelay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := b.max
+	// stop doubling before the delay could overflow
+	if attempt <= 32 {
+		if d := b.base << uint(attempt-1); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
@@ -0,0 +1,36 @@
+package directory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	b := NewConstantBackoff(time.Second)
+	for attempt := 1; attempt <= 5; attempt++ {
+		assert.Equal(t, time.Second, b.NextDelay(attempt))
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := NewExponentialBackoff(time.Second, 10*time.Second)
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	} {
+		for i := 0; i < 100; i++ {
+			delay := b.NextDelay(tc.attempt)
+			assert.GreaterOrEqual(t, int64(delay), int64(tc.max/2), "attempt %d", tc.attempt)
+			assert.LessOrEqual(t, int64(delay), int64(tc.max), "attempt %d", tc.attempt)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package directory
+
+import (
+	"context"
+	"encoding"
+)
+
+// A Cursor is the incremental sync state of a provider, such as the time of the last change it has seen.
+// The sync loop persists it so incremental syncs resume where they left off after a restart.
+type Cursor interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+}
+
+type cursorKey struct{}
+
+// WithCursor returns a copy of ctx carrying the marshaled cursor of a previous sync. Providers which support
+// cursors resume from it if they haven't synced yet.
+func WithCursor(ctx context.Context, cursor []byte) context.Context {
+	return context.WithValue(ctx, cursorKey{}, cursor)
+}
+
+// CursorFromContext returns the marshaled cursor of a previous sync, or nil if there is none.
+func CursorFromContext(ctx context.Context) []byte {
+	cursor, _ := ctx.Value(cursorKey{}).([]byte)
+	return cursor
+}
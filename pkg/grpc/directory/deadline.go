@@ -0,0 +1,28 @@
+package directory
+
+import (
+	"context"
+	"time"
+)
+
+type deadlineBudgetKey struct{}
+
+// WithDeadlineBudget returns a copy of ctx carrying a budget for the rest of a sync, starting now. Unlike
+// a context deadline, the budget doesn't cancel ctx: providers and CanRetry use it to decide whether there
+// is time to retry a request or start another one. When ctx also has a deadline, whichever is earlier
+// applies, so a budget never extends a context deadline.
+func WithDeadlineBudget(ctx context.Context, budget time.Duration) context.Context {
+	return context.WithValue(ctx, deadlineBudgetKey{}, time.Now().Add(budget))
+}
+
+// DeadlineFromContext returns the time by which the work of ctx should be done: the earlier of the
+// context deadline and the end of its deadline budget. ok is false when ctx has neither.
+func DeadlineFromContext(ctx context.Context) (deadline time.Time, ok bool) {
+	deadline, ok = ctx.Deadline()
+	if budgetDeadline, hasBudget := ctx.Value(deadlineBudgetKey{}).(time.Time); hasBudget {
+		if !ok || budgetDeadline.Before(deadline) {
+			deadline, ok = budgetDeadline, true
+		}
+	}
+	return deadline, ok
+}
@@ -0,0 +1,52 @@
+package directory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadlineFromContext(t *testing.T) {
+	_, ok := DeadlineFromContext(context.Background())
+	assert.False(t, ok)
+
+	start := time.Now()
+	deadline, ok := DeadlineFromContext(WithDeadlineBudget(context.Background(), time.Minute))
+	if assert.True(t, ok) {
+		assert.WithinDuration(t, start.Add(time.Minute), deadline, time.Second)
+	}
+
+	t.Run("earlier context deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		contextDeadline, _ := ctx.Deadline()
+		deadline, ok := DeadlineFromContext(WithDeadlineBudget(ctx, time.Hour))
+		assert.True(t, ok)
+		assert.Equal(t, contextDeadline, deadline)
+	})
+	t.Run("earlier budget", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		defer cancel()
+		deadline, ok := DeadlineFromContext(WithDeadlineBudget(ctx, time.Second))
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Second), deadline, time.Second)
+	})
+}
+
+func TestCanRetry(t *testing.T) {
+	assert.True(t, CanRetry(context.Background(), time.Hour, time.Hour))
+
+	ctx := WithDeadlineBudget(context.Background(), time.Minute)
+	assert.True(t, CanRetry(ctx, time.Second, time.Second))
+	assert.False(t, CanRetry(ctx, time.Minute, time.Second), "the budget should be respected")
+	assert.NoError(t, ctx.Err(), "the budget should not cancel the context")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.False(t, CanRetry(WithDeadlineBudget(ctx, time.Hour), 2*time.Second, 0), "the earlier context deadline should apply")
+
+	cancel()
+	assert.False(t, CanRetry(ctx, 0, 0))
+}
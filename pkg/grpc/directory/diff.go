@@ -0,0 +1,116 @@
+package directory
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// A UserDiff describes the changes between two snapshots of directory users.
+type UserDiff struct {
+	// Added are the users which are only in the current snapshot.
+	Added []*User
+	// Removed are the users which are only in the previous snapshot.
+	Removed []*User
+	// Changed are the users from the current snapshot which differ from the previous snapshot.
+	Changed []*User
+}
+
+// DiffUsers compares two snapshots of directory users by id. The users in each list of the diff are sorted
+// by id.
+func DiffUsers(previous, current []*User) UserDiff {
+	lookup := make(map[string]*User, len(previous))
+	for _, u := range previous {
+		lookup[u.GetId()] = u
+	}
+
+	var diff UserDiff
+	for _, u := range current {
+		prev, ok := lookup[u.GetId()]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, u)
+		case !proto.Equal(prev, u):
+			diff.Changed = append(diff.Changed, u)
+		}
+		delete(lookup, u.GetId())
+	}
+	for _, u := range lookup {
+		diff.Removed = append(diff.Removed, u)
+	}
+
+	sortUsers(diff.Added)
+	sortUsers(diff.Removed)
+	sortUsers(diff.Changed)
+	return diff
+}
+
+// A MembershipDiff describes the changes to the members of a group between two snapshots of directory users.
+type MembershipDiff struct {
+	// Added are the ids of the users which are only members in the current snapshot.
+	Added []string
+	// Removed are the ids of the users which are only members in the previous snapshot.
+	Removed []string
+}
+
+// DiffMemberships compares the group memberships of two snapshots of directory users, and returns the diffs
+// of the groups whose members changed, keyed by group id. The user ids of each diff are sorted.
+func DiffMemberships(previous, current []*User) map[string]MembershipDiff {
+	lookup := make(map[string]*User, len(previous))
+	for _, u := range previous {
+		lookup[u.GetId()] = u
+	}
+
+	diffs := make(map[string]MembershipDiff)
+	add := func(userID string, groupIDs []string, removed bool) {
+		for _, groupID := range groupIDs {
+			diff := diffs[groupID]
+			if removed {
+				diff.Removed = append(diff.Removed, userID)
+			} else {
+				diff.Added = append(diff.Added, userID)
+			}
+			diffs[groupID] = diff
+		}
+	}
+
+	userDiff := DiffUsers(previous, current)
+	for _, u := range userDiff.Added {
+		add(u.GetId(), u.GetGroupIds(), false)
+	}
+	for _, u := range userDiff.Removed {
+		add(u.GetId(), u.GetGroupIds(), true)
+	}
+	for _, u := range userDiff.Changed {
+		prev := lookup[u.GetId()]
+		add(u.GetId(), differenceStrings(u.GetGroupIds(), prev.GetGroupIds()), false)
+		add(u.GetId(), differenceStrings(prev.GetGroupIds(), u.GetGroupIds()), true)
+	}
+	// the ids are appended by kind of user change, so they aren't sorted yet
+	for _, diff := range diffs {
+		sort.Strings(diff.Added)
+		sort.Strings(diff.Removed)
+	}
+	return diffs
+}
+
+// differenceStrings returns the strings of a which aren't in b.
+func differenceStrings(a, b []string) []string {
+	exclude := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		exclude[s] = struct{}{}
+	}
+	var diff []string
+	for _, s := range a {
+		if _, ok := exclude[s]; !ok {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+func sortUsers(users []*User) {
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].GetId() < users[j].GetId()
+	})
+}
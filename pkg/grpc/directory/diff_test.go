@@ -0,0 +1,50 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffUsers(t *testing.T) {
+	previous := []*User{
+		{Id: "a", GroupIds: []string{"admin"}},
+		{Id: "b", GroupIds: []string{"user"}},
+		{Id: "c", GroupIds: []string{"user"}},
+	}
+	current := []*User{
+		{Id: "d", GroupIds: []string{"user"}},
+		{Id: "b", GroupIds: []string{"admin", "user"}},
+		{Id: "c", GroupIds: []string{"user"}},
+	}
+	diff := DiffUsers(previous, current)
+	assert.Equal(t, []string{"d"}, userIDs(diff.Added))
+	assert.Equal(t, []string{"a"}, userIDs(diff.Removed))
+	assert.Equal(t, []string{"b"}, userIDs(diff.Changed))
+}
+
+func TestDiffMemberships(t *testing.T) {
+	previous := []*User{
+		{Id: "a", GroupIds: []string{"admin"}},
+		{Id: "b", GroupIds: []string{"user"}},
+		{Id: "c", GroupIds: []string{"user"}, Version: "1"},
+	}
+	current := []*User{
+		{Id: "z", GroupIds: []string{"admin", "user"}},
+		{Id: "b", GroupIds: []string{"admin"}},
+		{Id: "c", GroupIds: []string{"user"}, Version: "2"},
+	}
+	assert.Equal(t, map[string]MembershipDiff{
+		"admin": {Added: []string{"b", "z"}, Removed: []string{"a"}},
+		"user":  {Added: []string{"z"}, Removed: []string{"b"}},
+	}, DiffMemberships(previous, current))
+	assert.Empty(t, DiffMemberships(current, current))
+}
+
+func userIDs(users []*User) []string {
+	var ids []string
+	for _, u := range users {
+		ids = append(ids, u.GetId())
+	}
+	return ids
+}
@@ -0,0 +1,24 @@
+package directory
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var envReferenceRE = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)\}$`)
+
+// ExpandEnv expands a credential value of the form ${NAME} to the value of the NAME environment variable.
+// Any other value is returned unchanged. An error is returned if the referenced variable is not set.
+func ExpandEnv(value string) (string, error) {
+	m := envReferenceRE.FindStringSubmatch(value)
+	if m == nil {
+		return value, nil
+	}
+
+	expanded, ok := os.LookupEnv(m[1])
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", m[1])
+	}
+	return expanded, nil
+}
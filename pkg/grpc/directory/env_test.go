@@ -0,0 +1,37 @@
+package directory
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("DIRECTORY_TEST_SECRET", "SECRET")
+	defer os.Unsetenv("DIRECTORY_TEST_SECRET")
+	os.Unsetenv("DIRECTORY_TEST_MISSING")
+
+	for _, tt := range []struct {
+		name      string
+		value     string
+		expect    string
+		expectErr bool
+	}{
+		{"plain", "SECRET", "SECRET", false},
+		{"present", "${DIRECTORY_TEST_SECRET}", "SECRET", false},
+		{"missing", "${DIRECTORY_TEST_MISSING}", "", true},
+		{"embedded", "prefix-${DIRECTORY_TEST_SECRET}", "prefix-${DIRECTORY_TEST_SECRET}", false},
+		{"unbraced", "$DIRECTORY_TEST_SECRET", "$DIRECTORY_TEST_SECRET", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := ExpandEnv(tt.value)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expect, actual)
+		})
+	}
+}
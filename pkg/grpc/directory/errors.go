@@ -0,0 +1,6 @@
+package directory
+
+import "errors"
+
+// ErrConfig is wrapped by the errors returned when a provider is created with missing or invalid options.
+var ErrConfig = errors.New("invalid directory provider configuration")
@@ -0,0 +1,36 @@
+package directory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// An IDTransform canonicalizes the raw id of a user, as returned by the identity provider, before it is
+// prefixed with the provider name. Transforms are composed with ApplyIDTransforms.
+type IDTransform func(id string) string
+
+// ApplyIDTransforms applies the transforms to id in order, so each one receives the result of the
+// previous one.
+func ApplyIDTransforms(id string, transforms ...IDTransform) string {
+	for _, transform := range transforms {
+		id = transform(id)
+	}
+	return id
+}
+
+// LowercaseID lowercases an id.
+func LowercaseID(id string) string {
+	return strings.ToLower(id)
+}
+
+// TrimSpaceID removes the leading and trailing whitespace of an id.
+func TrimSpaceID(id string) string {
+	return strings.TrimSpace(id)
+}
+
+// HashID replaces an id by its hex encoded SHA-256 hash, so raw ids, such as emails, aren't stored.
+func HashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,19 @@
+package directory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyIDTransforms(t *testing.T) {
+	assert.Equal(t, " User@Example.com", ApplyIDTransforms(" User@Example.com"))
+	assert.Equal(t, "user@example.com", ApplyIDTransforms(" User@Example.com ", TrimSpaceID, LowercaseID))
+
+	// hashing first makes later transforms apply to the hash rather than the raw id
+	lowercased := ApplyIDTransforms("User@Example.com", LowercaseID, HashID)
+	assert.Equal(t, HashID("user@example.com"), lowercased)
+	hashed := ApplyIDTransforms("User@Example.com", HashID, LowercaseID)
+	assert.Equal(t, HashID("User@Example.com"), hashed)
+	assert.NotEqual(t, lowercased, hashed, "the order of transforms should matter")
+}
@@ -0,0 +1,16 @@
+package directory
+
+import "golang.org/x/time/rate"
+
+// A RateLimiter is a token bucket rate limiter. A single RateLimiter can be shared by several providers
+// to enforce a combined ceiling on requests to an identity provider.
+type RateLimiter = rate.Limiter
+
+// NewRateLimiter creates a new RateLimiter which allows qps requests per second with bursts of up to burst
+// requests.
+func NewRateLimiter(qps float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
+}
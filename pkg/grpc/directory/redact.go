@@ -0,0 +1,59 @@
+package directory
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+var redactPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	// authorization header values, ie. "SSWS <token>" or "Bearer <token>"
+	{regexp.MustCompile(`\b(SSWS|Bearer|Basic)\s+[A-Za-z0-9._~+/=-]{8,}`), "$1 " + redacted},
+	// secrets in query strings and form bodies
+	{regexp.MustCompile(`(?i)\b((?:access_|refresh_|id_|private_)?token|api_?key|client_secret|password|secret)=[^&\s"']+`), "$1=" + redacted},
+	// secrets in JSON documents
+	{regexp.MustCompile(`(?i)"((?:access_|refresh_|id_|private_)?token|api_?key|client_secret|password|secret)"\s*:\s*"[^"]*"`), `"$1":"` + redacted + `"`},
+}
+
+// Redact masks token-like substrings in an error's message, as well as any of the given secrets. The
+// returned error wraps err so errors.Is and errors.As continue to work. A nil error returns nil.
+func Redact(err error, secrets ...string) error {
+	if err == nil {
+		return nil
+	}
+	msg := RedactString(err.Error(), secrets...)
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+// RedactString masks token-like substrings in s, as well as any of the given secrets.
+func RedactString(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, redacted)
+		}
+	}
+	for _, pattern := range redactPatterns {
+		s = pattern.re.ReplaceAllString(s, pattern.repl)
+	}
+	return s
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,82 @@
+package directory
+
+import "time"
+
+// A SyncReport describes the most recent sync performed by a directory provider.
+type SyncReport struct {
+	// Provider is the name of the provider which performed the sync.
+	Provider string
+	// Tenant is the tenant or route which requested the sync, if known.
+	Tenant string
+	// StartTime is when the sync started.
+	StartTime time.Time
+	// EndTime is when the sync completed.
+	EndTime time.Time
+	// Org is the metadata of the tenant the provider synced from, if it was requested.
+	Org *OrgInfo
+	// Warnings are problems which did not prevent the sync from completing.
+	Warnings []Warning
+	// RemovedUserIDs are the ids of users which were in the previous sync but not in this one, if the
+	// provider reconciles users, and of users the provider knows were removed, such as deprovisioned
+	// users found by an incremental sync.
+	RemovedUserIDs []string
+	// Pages are the pages of results fetched from each paginated endpoint of the identity provider during
+	// the sync, keyed by endpoint, if the provider reports them. They help to tune batch sizes.
+	Pages map[string]PageStats
+}
+
+// PageStats are the pages of results fetched from an endpoint during a sync.
+type PageStats struct {
+	// Pages is the number of pages fetched.
+	Pages int
+	// Items is the total number of results in the pages.
+	Items int
+}
+
+// AveragePageSize returns the average number of results per page, or 0 if no pages were fetched.
+func (stats PageStats) AveragePageSize() float64 {
+	if stats.Pages == 0 {
+		return 0
+	}
+	return float64(stats.Items) / float64(stats.Pages)
+}
+
+// A WarningCode identifies the kind of a Warning.
+type WarningCode string
+
+// Warning codes reported by providers.
+const (
+	// WarningCodeGroupIncomplete is reported when some of the members of a group couldn't be retrieved,
+	// such as because a page of members couldn't be decoded.
+	WarningCodeGroupIncomplete WarningCode = "group_incomplete"
+	// WarningCodeGroupNotFound is reported when a listed group no longer exists by the time its
+	// members are retrieved.
+	WarningCodeGroupNotFound WarningCode = "group_not_found"
+	// WarningCodeGroupRuleSkipped is reported when a group rule isn't based only on group membership,
+	// so the members it assigns weren't added to its target groups.
+	WarningCodeGroupRuleSkipped WarningCode = "group_rule_skipped"
+	// WarningCodeGroupSkipped is reported when the members of a group weren't retrieved before the sync
+	// deadline, so the members of the previous sync were used, if any.
+	WarningCodeGroupSkipped WarningCode = "group_skipped"
+	// WarningCodeGroupTruncated is reported when only some of the members of a group were retrieved.
+	WarningCodeGroupTruncated WarningCode = "group_truncated"
+	// WarningCodeLoginEmailMismatch is reported when a user's login differs from their email.
+	WarningCodeLoginEmailMismatch WarningCode = "login_email_mismatch"
+	// WarningCodeMalformedRecord is reported when a record returned by the identity provider is skipped
+	// because it can't be used.
+	WarningCodeMalformedRecord WarningCode = "malformed_record"
+)
+
+// A Warning is a problem which did not prevent a sync from completing.
+type Warning struct {
+	Code    WarningCode
+	Message string
+	// SubjectID is the id of the group or user the warning is about, if any.
+	SubjectID string
+}
+
+// OrgInfo is the metadata of an identity provider tenant.
+type OrgInfo struct {
+	CompanyName string
+	Subdomain   string
+}
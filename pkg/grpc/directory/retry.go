@@ -0,0 +1,20 @@
+package directory
+
+import (
+	"context"
+	"time"
+)
+
+// CanRetry reports whether there is enough time left before the deadline of ctx, as returned by
+// DeadlineFromContext, to wait for backoff and then make another attempt taking at least minAttemptTime.
+// Contexts without a deadline or a deadline budget can always be retried unless they are done.
+func CanRetry(ctx context.Context, backoff, minAttemptTime time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	deadline, ok := DeadlineFromContext(ctx)
+	if !ok {
+		return true
+	}
+	return time.Until(deadline) >= backoff+minAttemptTime
+}
@@ -0,0 +1,148 @@
+package directory
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// NewHTTP2Transport creates an HTTP transport which prefers HTTP/2. Requests to a host are multiplexed over
+// at most maxConnsPerHost connections, and idle connections are kept so they can be reused by later syncs.
+// The limit also applies to HTTP/1.1 connections when a server doesn't support HTTP/2, so concurrent
+// requests beyond it wait for a connection. A maxConnsPerHost of 0 means no limit.
+func NewHTTP2Transport(tlsConfig *tls.Config, maxConnsPerHost int) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxConnsPerHost:       maxConnsPerHost,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost(maxConnsPerHost),
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func maxIdleConnsPerHost(maxConnsPerHost int) int {
+	if maxConnsPerHost <= 0 {
+		return http.DefaultMaxIdleConnsPerHost
+	}
+	return maxConnsPerHost
+}
+
+// NewClientCertificateClient returns a copy of client whose transport presents the given certificates when
+// a server requests a client certificate. The rest of the transport's TLS configuration, such as a custom CA
+// pool, is kept. A nil transport is replaced by a copy of http.DefaultTransport. Clients whose transport
+// isn't an *http.Transport can't be configured and are returned unchanged.
+func NewClientCertificateClient(client *http.Client, certs ...tls.Certificate) *http.Client {
+	return withTLSConfig(client, func(tlsConfig *tls.Config) {
+		tlsConfig.Certificates = append(tlsConfig.Certificates, certs...)
+	})
+}
+
+// NewMinTLSVersionClient returns a copy of client whose transport refuses TLS versions older than version,
+// such as tls.VersionTLS12. Like NewClientCertificateClient, the rest of the transport's TLS configuration
+// is kept, and clients whose transport isn't an *http.Transport are returned unchanged.
+func NewMinTLSVersionClient(client *http.Client, version uint16) *http.Client {
+	return withTLSConfig(client, func(tlsConfig *tls.Config) {
+		tlsConfig.MinVersion = version
+	})
+}
+
+// NewProxyClient returns a copy of client whose transport sends every request through the proxy at
+// proxyURL, instead of the proxy from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables used by
+// default. Like NewClientCertificateClient, clients whose transport isn't an *http.Transport are returned
+// unchanged.
+func NewProxyClient(client *http.Client, proxyURL *url.URL) *http.Client {
+	return withTransport(client, func(transport *http.Transport) {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	})
+}
+
+// withTLSConfig returns a copy of client whose transport's TLS configuration is changed by configure.
+func withTLSConfig(client *http.Client, configure func(tlsConfig *tls.Config)) *http.Client {
+	return withTransport(client, func(transport *http.Transport) {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = new(tls.Config)
+		}
+		configure(transport.TLSClientConfig)
+	})
+}
+
+// withTransport returns a copy of client whose transport is a copy changed by configure. The copy of
+// http.DefaultTransport used for a nil transport keeps its proxy from the environment.
+func withTransport(client *http.Client, configure func(transport *http.Transport)) *http.Client {
+	roundTripper := client.Transport
+	if roundTripper == nil {
+		roundTripper = http.DefaultTransport
+	}
+	transport, ok := roundTripper.(*http.Transport)
+	if !ok {
+		return client
+	}
+
+	transport = transport.Clone()
+	configure(transport)
+
+	configured := *client
+	configured.Transport = transport
+	return &configured
+}
+
+// NewSemaphoreClient returns a copy of client which acquires the semaphore for the duration of every
+// request, until the response body is closed. Clients sharing a semaphore make at most cap(semaphore)
+// requests at a time.
+func NewSemaphoreClient(client *http.Client, semaphore chan struct{}) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	withSemaphore := *client
+	withSemaphore.Transport = &semaphoreTransport{base: base, semaphore: semaphore}
+	return &withSemaphore
+}
+
+type semaphoreTransport struct {
+	base      http.RoundTripper
+	semaphore chan struct{}
+}
+
+func (t *semaphoreTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case t.semaphore <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	release := func() { <-t.semaphore }
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	res.Body = &releasingBody{ReadCloser: res.Body, release: release}
+	return res, nil
+}
+
+// A releasingBody releases the semaphore the first time it is closed.
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (body *releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.release)
+	return err
+}